@@ -148,7 +148,7 @@ func testLoadScenario(loader *mocks.Loader) {
 }
 
 func testBuildCustom(loader *mocks.Loader) {
-	customScenario, err := loader.BuildCustomScenario(
+	customScenario, warnings, err := loader.BuildCustomScenario(
 		"test-custom-onboard-001",
 		[]string{
 			"investment-manager-001.json",
@@ -163,6 +163,9 @@ func testBuildCustom(loader *mocks.Loader) {
 		log.Printf("  ❌ Error: %v", err)
 		return
 	}
+	for _, w := range warnings {
+		log.Printf("  ⚠️  %s", w)
+	}
 
 	fmt.Printf("  ✅ Built custom scenario:\n")
 	fmt.Printf("     Request ID: %s\n", customScenario.RequestID)
@@ -236,6 +239,7 @@ func testGenerateDSL(loader *mocks.Loader) {
 		log.Printf("  ❌ Error creating manager: %v", err)
 		return
 	}
+	defer mgr.Close()
 
 	version, hash, err := mgr.CreateRequest(response.RequestID, response.DSL)
 	if err != nil {
@@ -13,7 +13,7 @@ import (
 // to generate onboarding DSL instances without a database
 
 func main() {
-	fmt.Println("=== Mock Data Loader Examples ===\n")
+	fmt.Print("=== Mock Data Loader Examples ===\n\n")
 
 	// Create a mock data loader
 	loader := mocks.NewDefaultLoader()
@@ -110,7 +110,7 @@ func loadCompleteScenario(loader *mocks.Loader) {
 
 func buildCustomScenario(loader *mocks.Loader) {
 	// Build a custom scenario by selecting specific entities and products
-	customScenario, err := loader.BuildCustomScenario(
+	customScenario, warnings, err := loader.BuildCustomScenario(
 		"custom-onboard-example-001",
 		[]string{
 			"investment-manager-001.json",
@@ -125,6 +125,9 @@ func buildCustomScenario(loader *mocks.Loader) {
 		log.Printf("Error building custom scenario: %v", err)
 		return
 	}
+	for _, w := range warnings {
+		log.Printf("Warning: %s", w)
+	}
 
 	fmt.Printf("  Custom scenario created:\n")
 	fmt.Printf("    Request ID: %s\n", customScenario.RequestID)
@@ -177,6 +180,7 @@ func generateDSLFromScenario(loader *mocks.Loader) {
 		log.Printf("Error creating manager: %v", err)
 		return
 	}
+	defer mgr.Close()
 
 	version, hash, err := mgr.CreateRequest(response.RequestID, response.DSL)
 	if err != nil {
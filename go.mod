@@ -3,3 +3,5 @@ module github.com/example/dsl-go
 go 1.25.1
 
 require github.com/alecthomas/participle/v2 v2.0.0
+
+require gopkg.in/yaml.v3 v3.0.1
@@ -6,202 +6,303 @@ import (
 	"github.com/alecthomas/participle/v2/lexer"
 )
 
+// TimestampPrecision is the resolution meta timestamps are kept at. The
+// parser and printer both truncate to it, so parse→print→parse is stable.
+const TimestampPrecision = time.Second
+
+// CanonicalTime returns t in UTC truncated to TimestampPrecision.
+func CanonicalTime(t time.Time) time.Time {
+	return t.UTC().Truncate(TimestampPrecision)
+}
+
 type Request struct {
 	Pos lexer.Position
 
-	Meta         *Meta         `parser:"'(' 'onboarding-request' @@"`
-	Orchestrator *Orchestrator `parser:"@@"`
-	Catalog      *Catalog      `parser:"@@? ')'"`
+	Meta         *Meta
+	Orchestrator *Orchestrator
+	Catalog      *Catalog
+
+	// Comments are the comment lines before the document, each with its
+	// leading ';'. Entities, attributes, resources, flows and steps keep the
+	// comment lines directly before them the same way.
+	Comments []string
 }
 
 type Meta struct {
 	Pos lexer.Position
 
-	RequestID string    `parser:"'(' ':meta' '(' 'request-id' @String ')'"`
-	Version   uint64    `parser:"'(' 'version' @Number ')'"`
-	CreatedAt time.Time `parser:"('(' 'created-at' @String ')')?"`
-	UpdatedAt time.Time `parser:"('(' 'updated-at' @String ')')? ')'"`
+	RequestID string
+	Version   uint64
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 type Orchestrator struct {
 	Pos lexer.Position
 
-	Lifecycle *Lifecycle  `parser:"'(' ':orchestrator' @@"`
-	Entities  []*Entity   `parser:"@@*"`
-	Resources []*Resource `parser:"@@*"`
-	Flows     []*Flow     `parser:"@@*"`
-	Policies  []*Policy   `parser:"@@* ')'"`
+	Lifecycle *Lifecycle
+	Entities  []*Entity
+	Resources []*Resource
+	Flows     []*Flow
+	Policies  []*Policy
+
+	ProductServiceMappings []*ProductServiceMapping
 }
 
 type Lifecycle struct {
 	Pos lexer.Position
 
-	States      []string      `parser:"'(' ':lifecycle' '(' 'states' @Ident* ')'"`
-	Initial     string        `parser:"'(' 'initial' @Ident ')'"`
-	Transitions []*Transition `parser:"'(' 'transitions' @@* ')' ')'"`
+	States      []string
+	Initial     string
+	Transitions []*Transition
 }
 
 type Transition struct {
 	Pos lexer.Position
 
-	From    string        `parser:"'(' '->' @Ident"`
-	To      string        `parser:"@Ident"`
-	Guard   *Expr         `parser:"@@?"`
-	Effects []*ActionCall `parser:"'(' 'do' @@* ')'? ')'"`
+	From    string
+	To      string
+	Guard   *Expr
+	Effects []*ActionCall
 }
 
 type ActionCall struct {
 	Pos lexer.Position
 
-	Name string    `parser:"'(' @Ident"`
-	Args []*KVPair `parser:"@@* ')'"`
+	Name string
+	Args []*KVPair
 }
 
 type Entity struct {
 	Pos lexer.Position
 
-	ID    string     `parser:"'(' ':entities' '(' 'entity' ':id' @String"`
-	Typ   string     `parser:"':type' @Ident"`
-	Attrs []*AttrVal `parser:"'(' 'attrs' @@* ')' ')' ')'"`
+	ID    string
+	Typ   string
+	Tags  []string
+	Attrs []*AttrVal
+
+	Comments []string
 }
 
 type AttrVal struct {
 	Pos lexer.Position
 
-	Key        string   `parser:"'(' @Ident"`
-	Value      *Value   `parser:"@@"`
-	Provenance *string  `parser:"(':provenance' @String)?"`
-	NeededBy   []string `parser:"(':needed-by' '(' @Ident* ')')? ')'"`
+	Key          string
+	Value        *Value
+	Provenance   *string
+	NeededBy     []string
+	SupersededAt *time.Time
+
+	Comments []string
+}
+
+// Superseded reports whether a later value of the same key replaced a.
+func (a *AttrVal) Superseded() bool {
+	return a.SupersededAt != nil
+}
+
+// GetAttr returns the current value of key on e, ignoring superseded values.
+func GetAttr(e *Entity, key string) (*AttrVal, bool) {
+	for _, a := range e.Attrs {
+		if a.Key == key && !a.Superseded() {
+			return a, true
+		}
+	}
+	return nil, false
+}
+
+// SetAttr sets key on e to v with the given provenance. The current value of
+// key is updated in place, keeping its position, comments and :needed-by; if
+// there is none, a new attribute is appended.
+func SetAttr(e *Entity, key string, v *Value, provenance *string) {
+	if a, ok := GetAttr(e, key); ok {
+		a.Value = v
+		a.Provenance = provenance
+		return
+	}
+	e.Attrs = append(e.Attrs, &AttrVal{Key: key, Value: v, Provenance: provenance})
 }
 
 type Resource struct {
 	Pos lexer.Position
 
-	ID       string         `parser:"'(' ':resources' '(' 'resource' ':id' @String"`
-	Typ      string         `parser:"':type' @Ident"`
-	Requires []*RequireItem `parser:"('(' 'requires' @@* ')')?"`
-	Config   []*KVPair      `parser:"('(' 'config' @@* ')')? ')' ')'"`
+	ID       string
+	Typ      string
+	Requires []*RequireItem
+	Config   []*KVPair
+
+	Comments []string
 }
 
 type RequireItem struct {
 	Pos lexer.Position
 
-	Kind string `parser:"'(' @'entity'"`
-	ID   string `parser:"@String ')'"`
+	Kind string
+	ID   string
 }
 
 type Flow struct {
 	Pos lexer.Position
 
-	ID    string  `parser:"'(' ':flows' '(' 'flow' ':id' @String"`
-	Doc   *string `parser:"(@String)?"`
-	Steps []*Step `parser:"'(' 'steps' @@* ')' ')' ')'"`
+	ID    string
+	Doc   *string
+	Steps []*Step
+
+	Comments []string
 }
 
 type Step struct {
 	Pos lexer.Position
 
-	Task *Task `parser:"( @@"`
-	Gate *Gate `parser:"| @@"`
-	Fork *Fork `parser:"| @@"`
-	Join *Join `parser:"| @@ )"`
+	Task *Task
+	Gate *Gate
+	Fork *Fork
+	Join *Join
+
+	Comments []string
 }
 
 type Task struct {
 	Pos lexer.Position
 
-	ID       string    `parser:"'task' ':id' @String"`
-	On       string    `parser:"':on' @String"`
-	Op       string    `parser:"':op' @Ident"`
-	Args     []*KVPair `parser:"'(' 'args' @@* ')'"`
-	Needs    []string  `parser:"('(' 'needs' @String* ')')?"`
-	Produces []string  `parser:"('(' 'produces' @String* ')')?"`
-	Labels   []string  `parser:"('(' 'labels' @Ident* ')')?"`
+	ID       string
+	On       string
+	Op       string
+	Args     []*KVPair
+	Needs    []string
+	Produces []string
+	Labels   []string
 }
 
 type Gate struct {
 	Pos lexer.Position
 
-	ID        string `parser:"'gate' ':id' @String"`
-	Condition string `parser:"'(' 'when' @String ')'"`
+	ID        string
+	Condition string
 }
 
 type Fork struct {
 	Pos lexer.Position
 
-	ID       string   `parser:"'fork' ':id' @String"`
-	Branches []string `parser:"'(' 'branches' @String* ')'"`
+	ID       string
+	Branches []string
 }
 
 type Join struct {
 	Pos lexer.Position
 
-	ID    string   `parser:"'join' ':id' @String"`
-	After []string `parser:"'(' 'after' @String* ')'"`
+	ID    string
+	After []string
 }
 
 type Policy struct {
 	Pos lexer.Position
 
-	Name string    `parser:"'(' ':policies' '(' 'policy' @Ident"`
-	KV   []*KVPair `parser:"@@* ')' ')'"`
+	Name string
+	KV   []*KVPair
+}
+
+// ProductServiceMapping connects a product to the services and resources it
+// unlocks.
+type ProductServiceMapping struct {
+	Pos lexer.Position
+
+	Product   string
+	Services  []string
+	Resources []string
 }
 
 type Catalog struct {
 	Pos lexer.Position
 
-	Attributes []*AttrDef   `parser:"'(' ':catalog' '(' ':attributes' @@* ')'"`
-	Actions    []*ActionDef `parser:"'(' ':actions' @@* ')' ')'"`
+	Attributes []*AttrDef
+	Actions    []*ActionDef
 }
 
 type AttrDef struct {
 	Pos lexer.Position
 
-	Name   string   `parser:"'(' @Ident"`
-	Typ    string   `parser:"':' 'type' @Ident"`
-	Enum   []string `parser:"(':' 'enum' '(' @Ident* ')')?"`
-	Format *string  `parser:"(':' 'format' @Ident)?"`
-	PII    *bool    `parser:"(':' 'pii' @('true' | 'false'))? ')'"`
+	Name   string
+	Typ    string
+	Enum   []string
+	Format *string
+	PII    *bool
 }
 
 type ActionDef struct {
 	Pos lexer.Position
 
-	Name     string      `parser:"'(' @Ident"`
-	Params   []*ParamDef `parser:"'(' 'params' @@* ')'"`
-	Needs    []string    `parser:"'(' 'needs' @String* ')'"`
-	Produces []string    `parser:"'(' 'produces' @String* ')' ')'"`
+	Name     string
+	Params   []*ParamDef
+	Needs    []string
+	Produces []string
 }
 
 type ParamDef struct {
 	Pos lexer.Position
 
-	Name     string   `parser:"'(' @Ident"`
-	Typ      string   `parser:"':' 'type' @Ident"`
-	Required *bool    `parser:"(':' 'required' @('true' | 'false'))?"`
-	Enum     []string `parser:"(':' 'enum' '(' @Ident* ')')? ')'"`
+	Name     string
+	Typ      string
+	Required *bool
+	Enum     []string
 }
 
 type Expr struct {
 	Pos lexer.Position
 
-	Kind string `parser:"@Ident"`
-	Path string `parser:"@String?"`
+	Kind string
+	Path string
 }
 
 type KVPair struct {
 	Pos lexer.Position
 
-	Key   string `parser:"@Ident"`
-	Value *Value `parser:"@@"`
+	Key   string
+	Value *Value
 }
 
 type Value struct {
 	Pos lexer.Position
 
-	String *string  `parser:"@String"`
-	Int    *int64   `parser:"| @Number"`
-	Float  *float64 `parser:"| @Number"`
-	Bool   *bool    `parser:"| @('true' | 'false')"`
-	Symbol *string  `parser:"| @Ident"`
+	String   *string
+	Int      *int64
+	Float    *float64
+	Duration *Duration
+	Bool     *bool
+	Symbol   *string
+	// Map holds a nested config value, (key (sub value) ...), in source
+	// order.
+	Map []*KVPair
+}
+
+// Equal reports whether v and o hold the same kind and value.
+func (v *Value) Equal(o *Value) bool {
+	if v == nil || o == nil {
+		return v == o
+	}
+	switch {
+	case v.String != nil:
+		return o.String != nil && *v.String == *o.String
+	case v.Int != nil:
+		return o.Int != nil && *v.Int == *o.Int
+	case v.Float != nil:
+		return o.Float != nil && *v.Float == *o.Float
+	case v.Duration != nil:
+		return o.Duration != nil && *v.Duration == *o.Duration
+	case v.Bool != nil:
+		return o.Bool != nil && *v.Bool == *o.Bool
+	case v.Symbol != nil:
+		return o.Symbol != nil && *v.Symbol == *o.Symbol
+	case v.Map != nil:
+		if len(v.Map) != len(o.Map) {
+			return false
+		}
+		for i, kv := range v.Map {
+			if kv.Key != o.Map[i].Key || !kv.Value.Equal(o.Map[i].Value) {
+				return false
+			}
+		}
+		return true
+	}
+	return o.String == nil && o.Int == nil && o.Float == nil && o.Duration == nil && o.Bool == nil && o.Symbol == nil && o.Map == nil
 }
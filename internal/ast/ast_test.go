@@ -0,0 +1,94 @@
+package ast
+
+import (
+	"testing"
+	"time"
+)
+
+func str(s string) *string { return &s }
+
+// testEntity has a superseded and a current name, and a country.
+func testEntity() *Entity {
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	return &Entity{ID: "le:A", Attrs: []*AttrVal{
+		{Key: "name", Value: &Value{String: str("Old")}, SupersededAt: &at},
+		{Key: "name", Value: &Value{String: str("A")}, Provenance: str("registry"), Comments: []string{"; legal name"}},
+		{Key: "country", Value: &Value{Symbol: str("GB")}, NeededBy: []string{"kyc"}},
+	}}
+}
+
+func TestGetAttr(t *testing.T) {
+	tests := []struct {
+		key    string
+		want   string
+		wantOK bool
+	}{
+		{"name", "A", true},
+		{"country", "GB", true},
+		{"lei", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			a, ok := GetAttr(testEntity(), tt.key)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			got := a.Value.String
+			if got == nil {
+				got = a.Value.Symbol
+			}
+			if *got != tt.want {
+				t.Errorf("value = %q, want %q", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetAttr(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		value      *Value
+		provenance *string
+		// wantIndex is where the attribute must end up; the comments and
+		// :needed-by of an updated attribute are kept.
+		wantIndex, wantLen         int
+		wantComments, wantNeededBy int
+	}{
+		{"update current value", "name", &Value{String: str("B")}, str("filing"), 1, 3, 1, 0},
+		{"update without provenance", "country", &Value{Symbol: str("FR")}, nil, 2, 3, 0, 1},
+		{"append new key", "lei", &Value{String: str("5493")}, str("gleif"), 3, 4, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := testEntity()
+			SetAttr(e, tt.key, tt.value, tt.provenance)
+			if len(e.Attrs) != tt.wantLen {
+				t.Fatalf("%d attributes, want %d", len(e.Attrs), tt.wantLen)
+			}
+			a := e.Attrs[tt.wantIndex]
+			if a.Key != tt.key || !a.Value.Equal(tt.value) || a.Provenance != tt.provenance {
+				t.Errorf("attribute %d = %s %+v %v, want %s %+v %v",
+					tt.wantIndex, a.Key, a.Value, a.Provenance, tt.key, tt.value, tt.provenance)
+			}
+			if len(a.Comments) != tt.wantComments || len(a.NeededBy) != tt.wantNeededBy {
+				t.Errorf("comments %q, :needed-by %q; want %d and %d", a.Comments, a.NeededBy, tt.wantComments, tt.wantNeededBy)
+			}
+			if old := e.Attrs[0]; *old.Value.String != "Old" || !old.Superseded() {
+				t.Errorf("superseded value changed: %+v", old)
+			}
+		})
+	}
+}
+
+func TestCanonicalTime(t *testing.T) {
+	paris := time.FixedZone("CET", 3600)
+	in := time.Date(2025, 3, 1, 10, 30, 15, 999_999_999, paris)
+	want := time.Date(2025, 3, 1, 9, 30, 15, 0, time.UTC)
+	if got := CanonicalTime(in); !got.Equal(want) || got.Location() != time.UTC {
+		t.Errorf("CanonicalTime(%v) = %v, want %v", in, got, want)
+	}
+}
@@ -0,0 +1,64 @@
+package ast
+
+import "strings"
+
+// CondOp is the operator of a Condition node.
+type CondOp string
+
+const (
+	CondPredicate CondOp = ""
+	CondNot       CondOp = "NOT"
+	CondAnd       CondOp = "AND"
+	CondOr        CondOp = "OR"
+)
+
+// Condition is a parsed gate condition: a named predicate, or NOT of one
+// sub-condition, or AND/OR of two or more.
+type Condition struct {
+	Op        CondOp
+	Predicate string
+	Args      []*Condition
+}
+
+// Predicates returns the predicate names c refers to, in order of first use.
+func (c *Condition) Predicates() []string {
+	var names []string
+	seen := map[string]bool{}
+	var walk func(c *Condition)
+	walk = func(c *Condition) {
+		if c.Op == CondPredicate {
+			if !seen[c.Predicate] {
+				seen[c.Predicate] = true
+				names = append(names, c.Predicate)
+			}
+			return
+		}
+		for _, arg := range c.Args {
+			walk(arg)
+		}
+	}
+	walk(c)
+	return names
+}
+
+// String renders c in condition syntax, parenthesising nested AND/OR.
+func (c *Condition) String() string {
+	switch c.Op {
+	case CondPredicate:
+		return c.Predicate
+	case CondNot:
+		return "NOT " + c.Args[0].operand()
+	}
+	parts := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		parts[i] = arg.operand()
+	}
+	return strings.Join(parts, " "+string(c.Op)+" ")
+}
+
+func (c *Condition) operand() string {
+	if c.Op == CondAnd || c.Op == CondOr {
+		return "(" + c.String() + ")"
+	}
+	return c.String()
+}
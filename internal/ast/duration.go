@@ -0,0 +1,78 @@
+package ast
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration is a time span written as a sequence of decimal numbers each
+// followed by a unit: ns, us, ms, s, m, h (as in Go) or d for 24h days,
+// e.g. 30m, 72h, 1d12h or 1.5h.
+type Duration time.Duration
+
+var durationPart = regexp.MustCompile(`([0-9]+(?:\.[0-9]+)?)(ns|us|ms|s|m|h|d)`)
+
+// ParseDuration parses the DSL duration syntax.
+func ParseDuration(s string) (Duration, error) {
+	if s == "" {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	rest := s
+	var total time.Duration
+	for rest != "" {
+		m := durationPart.FindStringSubmatchIndex(rest)
+		if m == nil || m[0] != 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		num, unit := rest[m[2]:m[3]], rest[m[4]:m[5]]
+		var part time.Duration
+		if unit == "d" {
+			days, err := strconv.ParseFloat(num, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+			}
+			part = time.Duration(days * float64(24*time.Hour))
+		} else {
+			var err error
+			if part, err = time.ParseDuration(num + unit); err != nil {
+				return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+			}
+		}
+		total += part
+		rest = rest[m[1]:]
+	}
+	return Duration(total), nil
+}
+
+var durationUnits = []struct {
+	name string
+	size time.Duration
+}{
+	{"d", 24 * time.Hour},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+	{"ms", time.Millisecond},
+	{"us", time.Microsecond},
+	{"ns", time.Nanosecond},
+}
+
+// String returns the canonical form: whole units from largest to smallest
+// with zero components omitted, e.g. 1d12h or 30m.
+func (d Duration) String() string {
+	v := time.Duration(d)
+	if v == 0 {
+		return "0s"
+	}
+	var b strings.Builder
+	for _, u := range durationUnits {
+		if v >= u.size {
+			fmt.Fprintf(&b, "%d%s", v/u.size, u.name)
+			v %= u.size
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,47 @@
+package ast
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		printed string
+		wantErr bool
+	}{
+		{in: "30m", want: 30 * time.Minute, printed: "30m"},
+		{in: "72h", want: 72 * time.Hour, printed: "3d"},
+		{in: "30d", want: 30 * 24 * time.Hour, printed: "30d"},
+		{in: "1d12h", want: 36 * time.Hour, printed: "1d12h"},
+		{in: "1.5h", want: 90 * time.Minute, printed: "1h30m"},
+		{in: "0.5d", want: 12 * time.Hour, printed: "12h"},
+		{in: "250ms", want: 250 * time.Millisecond, printed: "250ms"},
+		{in: "0s", want: 0, printed: "0s"},
+		{in: "", wantErr: true},
+		{in: "30", wantErr: true},
+		{in: "30x", wantErr: true},
+		{in: "m", wantErr: true},
+		{in: "1h 30m", wantErr: true},
+		{in: "-5m", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			d, err := ParseDuration(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseDuration(%q) = %v, want an error", tt.in, d)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if time.Duration(d) != tt.want || d.String() != tt.printed {
+				t.Errorf("ParseDuration(%q) = %v printed %q, want %v printed %q", tt.in, time.Duration(d), d, tt.want, tt.printed)
+			}
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package ast
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ToJSON returns req as indented JSON in a stable, documented schema meant for
+// API clients. Unlike marshalling the AST directly it carries no source
+// positions, omits empty sections and lists, tags every value with its kind
+// and writes timestamps as canonical RFC 3339 strings.
+//
+// The document has these fields:
+//
+//	meta:          {request_id, version, created_at?, updated_at?}
+//	orchestrator:  {lifecycle?, entities?, resources?, flows?, policies?, product_service_mappings?}
+//	  lifecycle:   {states, initial, transitions: [{from, to, when?, do?}]}
+//	  entities:    [{id, type, attrs: [{key, value, provenance?, needed_by?, superseded_at?}]}]
+//	  resources:   [{id, type, requires?: [{kind, id}], config?: [{key, value}]}]
+//	  flows:       [{id, doc?, steps: [step]}]
+//	  policies:    [{name, settings?: [{key, value}]}]
+//	  product_service_mappings: [{product, services?, resources?}]
+//	catalog:       {attributes?: [...], actions?: [...]}
+//
+// A step has a "kind" of task, gate, fork or join and that kind's fields. A
+// value is {"kind": "string"|"int"|"float"|"duration"|"bool"|"symbol",
+// "value": ...}; durations are written in DSL syntax.
+func ToJSON(req *Request) ([]byte, error) {
+	return json.MarshalIndent(requestJSON(req), "", "  ")
+}
+
+type jsonRequest struct {
+	Meta         *jsonMeta         `json:"meta,omitempty"`
+	Orchestrator *jsonOrchestrator `json:"orchestrator,omitempty"`
+	Catalog      *jsonCatalog      `json:"catalog,omitempty"`
+}
+
+type jsonMeta struct {
+	RequestID string `json:"request_id"`
+	Version   uint64 `json:"version"`
+	CreatedAt string `json:"created_at,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+type jsonOrchestrator struct {
+	Lifecycle *jsonLifecycle `json:"lifecycle,omitempty"`
+	Entities  []jsonEntity   `json:"entities,omitempty"`
+	Resources []jsonResource `json:"resources,omitempty"`
+	Flows     []jsonFlow     `json:"flows,omitempty"`
+	Policies  []jsonPolicy   `json:"policies,omitempty"`
+
+	ProductServiceMappings []jsonMapping `json:"product_service_mappings,omitempty"`
+}
+
+type jsonMapping struct {
+	Product   string   `json:"product"`
+	Services  []string `json:"services,omitempty"`
+	Resources []string `json:"resources,omitempty"`
+}
+
+type jsonLifecycle struct {
+	States      []string         `json:"states"`
+	Initial     string           `json:"initial"`
+	Transitions []jsonTransition `json:"transitions"`
+}
+
+type jsonTransition struct {
+	From string       `json:"from"`
+	To   string       `json:"to"`
+	When *jsonExpr    `json:"when,omitempty"`
+	Do   []jsonAction `json:"do,omitempty"`
+}
+
+type jsonExpr struct {
+	Kind string `json:"kind"`
+	Path string `json:"path,omitempty"`
+}
+
+type jsonAction struct {
+	Name string   `json:"name"`
+	Args []jsonKV `json:"args,omitempty"`
+}
+
+type jsonEntity struct {
+	ID    string     `json:"id"`
+	Type  string     `json:"type"`
+	Tags  []string   `json:"tags,omitempty"`
+	Attrs []jsonAttr `json:"attrs"`
+}
+
+type jsonAttr struct {
+	Key          string     `json:"key"`
+	Value        *jsonValue `json:"value"`
+	Provenance   string     `json:"provenance,omitempty"`
+	NeededBy     []string   `json:"needed_by,omitempty"`
+	SupersededAt string     `json:"superseded_at,omitempty"`
+}
+
+type jsonResource struct {
+	ID       string        `json:"id"`
+	Type     string        `json:"type"`
+	Requires []jsonRequire `json:"requires,omitempty"`
+	Config   []jsonKV      `json:"config,omitempty"`
+}
+
+type jsonRequire struct {
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+}
+
+type jsonFlow struct {
+	ID    string     `json:"id"`
+	Doc   string     `json:"doc,omitempty"`
+	Steps []jsonStep `json:"steps"`
+}
+
+type jsonStep struct {
+	Kind      string   `json:"kind"`
+	ID        string   `json:"id"`
+	On        string   `json:"on,omitempty"`
+	Op        string   `json:"op,omitempty"`
+	Args      []jsonKV `json:"args,omitempty"`
+	Needs     []string `json:"needs,omitempty"`
+	Produces  []string `json:"produces,omitempty"`
+	Labels    []string `json:"labels,omitempty"`
+	Condition string   `json:"condition,omitempty"`
+	Branches  []string `json:"branches,omitempty"`
+	After     []string `json:"after,omitempty"`
+}
+
+type jsonPolicy struct {
+	Name     string   `json:"name"`
+	Settings []jsonKV `json:"settings,omitempty"`
+}
+
+type jsonCatalog struct {
+	Attributes []jsonAttrDef   `json:"attributes,omitempty"`
+	Actions    []jsonActionDef `json:"actions,omitempty"`
+}
+
+type jsonAttrDef struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Enum   []string `json:"enum,omitempty"`
+	Format string   `json:"format,omitempty"`
+	PII    *bool    `json:"pii,omitempty"`
+}
+
+type jsonActionDef struct {
+	Name     string         `json:"name"`
+	Params   []jsonParamDef `json:"params,omitempty"`
+	Needs    []string       `json:"needs,omitempty"`
+	Produces []string       `json:"produces,omitempty"`
+}
+
+type jsonParamDef struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Required *bool    `json:"required,omitempty"`
+	Enum     []string `json:"enum,omitempty"`
+}
+
+type jsonKV struct {
+	Key   string     `json:"key"`
+	Value *jsonValue `json:"value"`
+}
+
+type jsonValue struct {
+	Kind  string      `json:"kind"`
+	Value interface{} `json:"value"`
+}
+
+func requestJSON(req *Request) *jsonRequest {
+	out := &jsonRequest{}
+	if m := req.Meta; m != nil {
+		out.Meta = &jsonMeta{
+			RequestID: m.RequestID,
+			Version:   m.Version,
+			CreatedAt: jsonTime(m.CreatedAt),
+			UpdatedAt: jsonTime(m.UpdatedAt),
+		}
+	}
+	if o := req.Orchestrator; o != nil {
+		out.Orchestrator = orchestratorJSON(o)
+	}
+	if c := req.Catalog; c != nil {
+		out.Catalog = catalogJSON(c)
+	}
+	return out
+}
+
+func orchestratorJSON(o *Orchestrator) *jsonOrchestrator {
+	out := &jsonOrchestrator{}
+	if l := o.Lifecycle; l != nil {
+		lc := &jsonLifecycle{States: l.States, Initial: l.Initial, Transitions: []jsonTransition{}}
+		for _, t := range l.Transitions {
+			jt := jsonTransition{From: t.From, To: t.To}
+			if t.Guard != nil {
+				jt.When = &jsonExpr{Kind: t.Guard.Kind, Path: t.Guard.Path}
+			}
+			for _, a := range t.Effects {
+				jt.Do = append(jt.Do, jsonAction{Name: a.Name, Args: kvsJSON(a.Args)})
+			}
+			lc.Transitions = append(lc.Transitions, jt)
+		}
+		out.Lifecycle = lc
+	}
+	for _, e := range o.Entities {
+		je := jsonEntity{ID: e.ID, Type: e.Typ, Tags: e.Tags, Attrs: []jsonAttr{}}
+		for _, a := range e.Attrs {
+			ja := jsonAttr{Key: a.Key, Value: valueJSON(a.Value), NeededBy: a.NeededBy}
+			if a.Provenance != nil {
+				ja.Provenance = *a.Provenance
+			}
+			if a.SupersededAt != nil {
+				ja.SupersededAt = jsonTime(*a.SupersededAt)
+			}
+			je.Attrs = append(je.Attrs, ja)
+		}
+		out.Entities = append(out.Entities, je)
+	}
+	for _, r := range o.Resources {
+		jr := jsonResource{ID: r.ID, Type: r.Typ, Config: kvsJSON(r.Config)}
+		for _, item := range r.Requires {
+			jr.Requires = append(jr.Requires, jsonRequire{Kind: item.Kind, ID: item.ID})
+		}
+		out.Resources = append(out.Resources, jr)
+	}
+	for _, f := range o.Flows {
+		jf := jsonFlow{ID: f.ID, Steps: []jsonStep{}}
+		if f.Doc != nil {
+			jf.Doc = *f.Doc
+		}
+		for _, s := range f.Steps {
+			jf.Steps = append(jf.Steps, stepJSON(s))
+		}
+		out.Flows = append(out.Flows, jf)
+	}
+	for _, p := range o.Policies {
+		out.Policies = append(out.Policies, jsonPolicy{Name: p.Name, Settings: kvsJSON(p.KV)})
+	}
+	for _, m := range o.ProductServiceMappings {
+		out.ProductServiceMappings = append(out.ProductServiceMappings, jsonMapping{Product: m.Product, Services: m.Services, Resources: m.Resources})
+	}
+	return out
+}
+
+func stepJSON(s *Step) jsonStep {
+	switch {
+	case s.Task != nil:
+		t := s.Task
+		return jsonStep{Kind: "task", ID: t.ID, On: t.On, Op: t.Op, Args: kvsJSON(t.Args),
+			Needs: t.Needs, Produces: t.Produces, Labels: t.Labels}
+	case s.Gate != nil:
+		return jsonStep{Kind: "gate", ID: s.Gate.ID, Condition: s.Gate.Condition}
+	case s.Fork != nil:
+		return jsonStep{Kind: "fork", ID: s.Fork.ID, Branches: s.Fork.Branches}
+	case s.Join != nil:
+		return jsonStep{Kind: "join", ID: s.Join.ID, After: s.Join.After}
+	}
+	return jsonStep{}
+}
+
+func catalogJSON(c *Catalog) *jsonCatalog {
+	out := &jsonCatalog{}
+	for _, d := range c.Attributes {
+		jd := jsonAttrDef{Name: d.Name, Type: d.Typ, Enum: d.Enum, PII: d.PII}
+		if d.Format != nil {
+			jd.Format = *d.Format
+		}
+		out.Attributes = append(out.Attributes, jd)
+	}
+	for _, a := range c.Actions {
+		ja := jsonActionDef{Name: a.Name, Needs: a.Needs, Produces: a.Produces}
+		for _, p := range a.Params {
+			ja.Params = append(ja.Params, jsonParamDef{Name: p.Name, Type: p.Typ, Required: p.Required, Enum: p.Enum})
+		}
+		out.Actions = append(out.Actions, ja)
+	}
+	return out
+}
+
+func kvsJSON(kvs []*KVPair) []jsonKV {
+	var out []jsonKV
+	for _, kv := range kvs {
+		out = append(out, jsonKV{Key: kv.Key, Value: valueJSON(kv.Value)})
+	}
+	return out
+}
+
+func valueJSON(v *Value) *jsonValue {
+	switch {
+	case v == nil:
+		return nil
+	case v.String != nil:
+		return &jsonValue{Kind: "string", Value: *v.String}
+	case v.Int != nil:
+		return &jsonValue{Kind: "int", Value: *v.Int}
+	case v.Float != nil:
+		return &jsonValue{Kind: "float", Value: *v.Float}
+	case v.Duration != nil:
+		return &jsonValue{Kind: "duration", Value: v.Duration.String()}
+	case v.Bool != nil:
+		return &jsonValue{Kind: "bool", Value: *v.Bool}
+	case v.Symbol != nil:
+		return &jsonValue{Kind: "symbol", Value: *v.Symbol}
+	case v.Map != nil:
+		return &jsonValue{Kind: "map", Value: kvsJSON(v.Map)}
+	}
+	return nil
+}
+
+// jsonTime formats t canonically, or returns "" for the zero time.
+func jsonTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return CanonicalTime(t).Format(time.RFC3339Nano)
+}
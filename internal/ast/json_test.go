@@ -0,0 +1,54 @@
+package ast_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/example/dsl-go/internal/ast"
+	"github.com/example/dsl-go/internal/parse"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestToJSONGolden(t *testing.T) {
+	tests := []struct {
+		input  string
+		golden string
+	}{
+		{"../../examples/minimal.sexpr", "testdata/minimal.json"},
+		{"../../examples/full.sexpr", "testdata/full.json"},
+		{"testdata/rich.sexpr", "testdata/rich.json"},
+	}
+	for _, tt := range tests {
+		t.Run(filepath.Base(tt.input), func(t *testing.T) {
+			f, err := os.Open(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			req, err := parse.ParseReader(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ast.ToJSON(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *update {
+				if err := os.WriteFile(tt.golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(tt.golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("ToJSON output differs from %s (rerun with -update if the change is intended):\n%s", tt.golden, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package ast
+
+// Visitor holds the callbacks of Walk. Nil callbacks are skipped. A callback
+// returns false to stop the walk; no further callbacks are made.
+type Visitor struct {
+	Entity   func(e *Entity) bool
+	Attr     func(e *Entity, a *AttrVal) bool
+	Resource func(r *Resource) bool
+	Flow     func(f *Flow) bool
+	Task     func(f *Flow, t *Task) bool
+	Gate     func(f *Flow, g *Gate) bool
+	Fork     func(f *Flow, fk *Fork) bool
+	Join     func(f *Flow, j *Join) bool
+}
+
+// Walk visits the orchestrator of req in document order: each entity followed
+// by its attributes, then the resources, then each flow followed by its
+// steps. It reports whether the walk ran to completion.
+func Walk(req *Request, v Visitor) bool {
+	if req == nil || req.Orchestrator == nil {
+		return true
+	}
+	o := req.Orchestrator
+	for _, e := range o.Entities {
+		if v.Entity != nil && !v.Entity(e) {
+			return false
+		}
+		for _, a := range e.Attrs {
+			if v.Attr != nil && !v.Attr(e, a) {
+				return false
+			}
+		}
+	}
+	for _, r := range o.Resources {
+		if v.Resource != nil && !v.Resource(r) {
+			return false
+		}
+	}
+	for _, f := range o.Flows {
+		if v.Flow != nil && !v.Flow(f) {
+			return false
+		}
+		for _, s := range f.Steps {
+			if !walkStep(f, s, v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func walkStep(f *Flow, s *Step, v Visitor) bool {
+	switch {
+	case s.Task != nil && v.Task != nil:
+		return v.Task(f, s.Task)
+	case s.Gate != nil && v.Gate != nil:
+		return v.Gate(f, s.Gate)
+	case s.Fork != nil && v.Fork != nil:
+		return v.Fork(f, s.Fork)
+	case s.Join != nil && v.Join != nil:
+		return v.Join(f, s.Join)
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+// walkRequest has one entity, one resource and two flows holding three tasks
+// between them.
+func walkRequest() *Request {
+	task := func(id string) *Step { return &Step{Task: &Task{ID: id}} }
+	return &Request{Orchestrator: &Orchestrator{
+		Entities:  []*Entity{testEntity()},
+		Resources: []*Resource{{ID: "acct"}},
+		Flows: []*Flow{
+			{ID: "main", Steps: []*Step{
+				{Fork: &Fork{ID: "checks", Branches: []string{"a", "b"}}},
+				task("a"),
+				task("b"),
+				{Join: &Join{ID: "checks-done", After: []string{"a", "b"}}},
+				{Gate: &Gate{ID: "review"}},
+			}},
+			{ID: "remediation", Steps: []*Step{task("fix")}},
+		},
+	}}
+}
+
+func TestWalkCountsTasks(t *testing.T) {
+	var tasks []string
+	done := Walk(walkRequest(), Visitor{
+		Task: func(f *Flow, t *Task) bool {
+			tasks = append(tasks, f.ID+"/"+t.ID)
+			return true
+		},
+	})
+	want := []string{"main/a", "main/b", "remediation/fix"}
+	if !done || !reflect.DeepEqual(tasks, want) {
+		t.Errorf("Walk = %v, tasks %q; want true, %q", done, tasks, want)
+	}
+}
+
+func TestWalkOrderAndStop(t *testing.T) {
+	var visited []string
+	visit := func(s string) { visited = append(visited, s) }
+	v := Visitor{
+		Entity:   func(e *Entity) bool { visit("entity " + e.ID); return true },
+		Attr:     func(e *Entity, a *AttrVal) bool { visit("attr " + a.Key); return true },
+		Resource: func(r *Resource) bool { visit("resource " + r.ID); return true },
+		Flow:     func(f *Flow) bool { visit("flow " + f.ID); return true },
+		Task:     func(f *Flow, t *Task) bool { visit("task " + t.ID); return t.ID != "b" },
+		Gate:     func(f *Flow, g *Gate) bool { visit("gate " + g.ID); return true },
+		Fork:     func(f *Flow, fk *Fork) bool { visit("fork " + fk.ID); return true },
+		Join:     func(f *Flow, j *Join) bool { visit("join " + j.ID); return true },
+	}
+	if Walk(walkRequest(), v) {
+		t.Error("Walk stopped by a callback reported completion")
+	}
+	want := []string{
+		"entity le:A", "attr name", "attr name", "attr country",
+		"resource acct", "flow main", "fork checks", "task a", "task b",
+	}
+	if !reflect.DeepEqual(visited, want) {
+		t.Errorf("visited %q, want %q", visited, want)
+	}
+}
@@ -2,9 +2,16 @@ package cli
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	iofs "io/fs"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/example/dsl-go/internal/ebnf"
 	"github.com/example/dsl-go/internal/generator"
@@ -13,10 +20,18 @@ import (
 	"github.com/example/dsl-go/internal/parse"
 )
 
+// Run runs the command named by the program arguments and exits with its
+// status.
 func Run() {
-	if len(os.Args) < 2 {
-		usage()
-		return
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command args[0] with the rest of args, reading standard input
+// from stdin and writing to stdout and stderr, and returns the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) < 1 {
+		usage(stdout)
+		return 0
 	}
 
 	dataDir := "./data"
@@ -27,244 +42,1208 @@ func Run() {
 		RegistryDir: regDir,
 	})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error creating manager: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(stderr, "error creating manager: %v\n", err)
+		return 1
+	}
+	// newFlagSet returns a flag set that reports errors on stderr and leaves
+	// exiting to run.
+	newFlagSet := func(name string) *flag.FlagSet {
+		fs := flag.NewFlagSet(name, flag.ContinueOnError)
+		fs.SetOutput(stderr)
+		return fs
 	}
 
-	cmds := map[string]func(){
-		"create": func() {
-			fs := flag.NewFlagSet("create", flag.ExitOnError)
+	cmds := map[string]func() int{
+		"create": func() int {
+			fs := newFlagSet("create")
+			idempotent := fs.Bool("idempotent", false, "Succeed without rewriting if the request already exists with identical content")
+			tenant := fs.String("tenant", "", "Tenant whose storage holds the request")
 			fs.Usage = func() {
-				fmt.Println("usage: dsl-go create <request_id> <template_file>")
+				fmt.Fprintln(stdout, "usage: dsl-go create [-idempotent] [-tenant=<tenant>] <request_id> <template_file>")
 				fs.PrintDefaults()
 			}
-			if err := fs.Parse(os.Args[2:]); err != nil {
-				fmt.Fprintf(os.Stderr, "error parsing flags: %v\n", err)
-				os.Exit(1)
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
 			}
 			if fs.NArg() != 2 {
 				fs.Usage()
-				return
+				return 0
 			}
 			reqID, templateFile := fs.Arg(0), fs.Arg(1)
-			template, err := os.ReadFile(templateFile)
+			template, err := readInput(stdin, templateFile)
+			if err != nil {
+				fmt.Fprintf(stderr, "error reading template: %v\n", err)
+				return 1
+			}
+			target, err := tenantManager(mgr, *tenant)
+			if err != nil {
+				fmt.Fprintf(stderr, "error: %v\n", err)
+				return 1
+			}
+			version, hash, err := target.CreateRequestWithOptions(reqID, string(template), manager.CreateOptions{Idempotent: *idempotent})
+			if err != nil {
+				fmt.Fprintf(stderr, "error creating request: %v\n", err)
+				return 1
+			}
+			fmt.Fprintf(stdout, "created request %s, version %d, hash %s\n", reqID, version, hash)
+			return 0
+		},
+		"update": func() int {
+			fs := newFlagSet("update")
+			tenant := fs.String("tenant", "", "Tenant whose storage holds the request")
+			fs.Usage = func() {
+				fmt.Fprintln(stdout, "usage: dsl-go update [-tenant=<tenant>] <request_id> <file>")
+				fs.PrintDefaults()
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
+			}
+			if fs.NArg() != 2 {
+				fs.Usage()
+				return 0
+			}
+			reqID, file := fs.Arg(0), fs.Arg(1)
+			content, err := readInput(stdin, file)
+			if err != nil {
+				fmt.Fprintf(stderr, "error reading input: %v\n", err)
+				return 1
+			}
+			target, err := tenantManager(mgr, *tenant)
+			if err != nil {
+				fmt.Fprintf(stderr, "error: %v\n", err)
+				return 1
+			}
+			version, hash, unchanged, err := target.UpdateRequest(reqID, string(content))
+			if err != nil {
+				fmt.Fprintf(stderr, "error updating request: %v\n", err)
+				return 1
+			}
+			if unchanged {
+				fmt.Fprintf(stdout, "request %s unchanged, version %d, hash %s\n", reqID, version, hash)
+				return 0
+			}
+			fmt.Fprintf(stdout, "updated request %s, version %d, hash %s\n", reqID, version, hash)
+			return 0
+		},
+		"patch": func() int {
+			fs := newFlagSet("patch")
+			tenant := fs.String("tenant", "", "Tenant whose storage holds the request")
+			fs.Usage = func() {
+				fmt.Fprintln(stdout, "usage: dsl-go patch [-tenant=<tenant>] <request_id> <patch_file>")
+				fmt.Fprintln(stdout, "The patch file is JSON in the form diff -format=json prints.")
+				fs.PrintDefaults()
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
+			}
+			if fs.NArg() != 2 {
+				fs.Usage()
+				return 0
+			}
+			reqID, file := fs.Arg(0), fs.Arg(1)
+			content, err := readInput(stdin, file)
+			if err != nil {
+				fmt.Fprintf(stderr, "error reading input: %v\n", err)
+				return 1
+			}
+			var patch manager.RequestDiff
+			if err := json.Unmarshal(content, &patch); err != nil {
+				fmt.Fprintf(stderr, "error decoding patch: %v\n", err)
+				return 1
+			}
+			target, err := tenantManager(mgr, *tenant)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "error reading template: %v\n", err)
-				os.Exit(1)
+				fmt.Fprintf(stderr, "error: %v\n", err)
+				return 1
 			}
-			version, hash, err := mgr.CreateRequest(reqID, string(template))
+			version, err := target.ApplyPatch(reqID, patch)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "error creating request: %v\n", err)
-				os.Exit(1)
+				fmt.Fprintf(stderr, "error patching request: %v\n", err)
+				return 1
 			}
-			fmt.Printf("created request %s, version %d, hash %s\n", reqID, version, hash)
+			fmt.Fprintf(stdout, "patched request %s, version %d\n", reqID, version)
+			return 0
 		},
-		"get": func() {
-			fs := flag.NewFlagSet("get", flag.ExitOnError)
+		"get": func() int {
+			fs := newFlagSet("get")
+			tenant := fs.String("tenant", "", "Tenant whose storage holds the request")
+			version := fs.Uint64("version", 0, "Version to get instead of the latest")
+			format := formatFlag(fs, "text", "text", "json", "yaml")
 			fs.Usage = func() {
-				fmt.Println("usage: dsl-go get <request_id>")
+				fmt.Fprintln(stdout, "usage: dsl-go get [-tenant=<tenant>] [-version=<n>] [-format=text|json|yaml] <request_id>")
 				fs.PrintDefaults()
 			}
-			if err := fs.Parse(os.Args[2:]); err != nil {
-				fmt.Fprintf(os.Stderr, "error parsing flags: %v\n", err)
-				os.Exit(1)
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
 			}
 			if fs.NArg() != 1 {
 				fs.Usage()
-				return
+				return 0
+			}
+			out, err := format()
+			if err != nil {
+				fmt.Fprintf(stderr, "error: %v\n", err)
+				return 1
+			}
+			reqID := fs.Arg(0)
+			target, err := tenantManager(mgr, *tenant)
+			if err != nil {
+				fmt.Fprintf(stderr, "error: %v\n", err)
+				return 1
+			}
+			var text string
+			if *version > 0 {
+				text, err = target.GetVersion(reqID, *version)
+			} else {
+				_, text, err = target.GetCurrentText(reqID)
+			}
+			if err != nil {
+				fmt.Fprintf(stderr, "error getting request: %v\n", err)
+				return 1
+			}
+			if out == "text" {
+				fmt.Fprintln(stdout, text)
+				return 0
+			}
+			parser, err := parse.New()
+			if err != nil {
+				fmt.Fprintf(stderr, "error creating parser: %v\n", err)
+				return 1
+			}
+			req, err := parser.Parse(text)
+			if err != nil {
+				fmt.Fprintf(stderr, "error parsing stored request: %v\n", err)
+				return 1
+			}
+			if err := printRequest(stdout, out, req); err != nil {
+				fmt.Fprintf(stderr, "error encoding request: %v\n", err)
+				return 1
+			}
+			return 0
+		},
+		"rollback": func() int {
+			fs := newFlagSet("rollback")
+			tenant := fs.String("tenant", "", "Tenant whose storage holds the request")
+			fs.Usage = func() {
+				fmt.Fprintln(stdout, "usage: dsl-go rollback [-tenant=<tenant>] <request_id> <version>")
+				fs.PrintDefaults()
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
+			}
+			if fs.NArg() != 2 {
+				fs.Usage()
+				return 0
 			}
 			reqID := fs.Arg(0)
-			_, text, err := mgr.GetCurrentText(reqID)
+			version, err := strconv.ParseUint(fs.Arg(1), 10, 64)
+			if err != nil {
+				fmt.Fprintf(stderr, "invalid version %q\n", fs.Arg(1))
+				return 1
+			}
+			target, err := tenantManager(mgr, *tenant)
+			if err != nil {
+				fmt.Fprintf(stderr, "error: %v\n", err)
+				return 1
+			}
+			newVersion, err := target.Rollback(reqID, version)
+			if err != nil {
+				fmt.Fprintf(stderr, "error rolling back request: %v\n", err)
+				return 1
+			}
+			fmt.Fprintf(stdout, "rolled back request %s to version %d as version %d\n", reqID, version, newVersion)
+			return 0
+		},
+		"list": func() int {
+			fs := newFlagSet("list")
+			tenant := fs.String("tenant", "", "Tenant whose storage holds the requests")
+			since := fs.String("since", "", "Only list requests updated at or after this date or RFC 3339 time, most recent first")
+			fs.Usage = func() {
+				fmt.Fprintln(stdout, "usage: dsl-go list [-tenant=<tenant>] [-since=<time>]")
+				fs.PrintDefaults()
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
+			}
+			if fs.NArg() != 0 {
+				fs.Usage()
+				return 0
+			}
+			target, err := tenantManager(mgr, *tenant)
+			if err != nil {
+				fmt.Fprintf(stderr, "error: %v\n", err)
+				return 1
+			}
+			if *since != "" {
+				t, err := parseSince(*since)
+				if err != nil {
+					fmt.Fprintf(stderr, "error: %v\n", err)
+					return 1
+				}
+				infos, err := target.ListRequestsSince(t)
+				if err != nil {
+					fmt.Fprintf(stderr, "error listing requests: %v\n", err)
+					return 1
+				}
+				for _, info := range infos {
+					fmt.Fprintf(stdout, "%s\tv%d\t%s\n", info.ID, info.Latest, info.UpdatedAt.Format(time.RFC3339))
+				}
+				return 0
+			}
+			infos, err := target.ListRequests()
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "error getting request: %v\n", err)
-				os.Exit(1)
+				fmt.Fprintf(stderr, "error listing requests: %v\n", err)
+				return 1
 			}
-			fmt.Println(text)
+			for _, info := range infos {
+				fmt.Fprintf(stdout, "%s\tv%d\n", info.ID, info.Latest)
+			}
+			return 0
 		},
-		"validate": func() {
-			fs := flag.NewFlagSet("validate", flag.ExitOnError)
+		"validate": func() int {
+			fs := newFlagSet("validate")
+			dictionary := fs.Bool("dictionary", false, "Warn about entity attributes not in the data dictionary")
+			strict := fs.Bool("strict", false, "Fail on warnings as well as errors, and with -dictionary report unknown attributes as errors")
 			fs.Usage = func() {
-				fmt.Println("usage: dsl-go validate <file>")
+				fmt.Fprintln(stdout, "usage: dsl-go validate [-dictionary] [-strict] <file>")
 				fs.PrintDefaults()
 			}
-			if err := fs.Parse(os.Args[2:]); err != nil {
-				fmt.Fprintf(os.Stderr, "error parsing flags: %v\n", err)
-				os.Exit(1)
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
 			}
 			if fs.NArg() != 1 {
 				fs.Usage()
-				return
+				return 0
 			}
 			file := fs.Arg(0)
-			content, err := os.ReadFile(file)
+			content, err := readInput(stdin, file)
+			if err != nil {
+				fmt.Fprintf(stderr, "error reading input: %v\n", err)
+				return 1
+			}
+			perr, err := mgr.ValidateTextDetailed(string(content))
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "error reading file: %v\n", err)
-				os.Exit(1)
+				fmt.Fprintf(stderr, "error validating: %v\n", err)
+				return 1
 			}
-			issues, err := mgr.ValidateText(string(content))
+			if perr != nil {
+				fmt.Fprintln(stdout, "Validation issues:")
+				fmt.Fprintf(stdout, "%s:%d:%d: %s\n", file, perr.Line(), perr.Column(), perr.Message)
+				if len(perr.Expected) > 0 {
+					fmt.Fprintf(stdout, "  expected one of: %s\n", strings.Join(perr.Expected, " "))
+				}
+				return 1
+			}
+			issues, warnings, err := mgr.ValidateTextWithOptions(string(content), manager.ValidateOptions{
+				Dictionary: *dictionary,
+				Strict:     *strict,
+			})
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "error validating: %v\n", err)
-				os.Exit(1)
+				fmt.Fprintf(stderr, "error validating: %v\n", err)
+				return 1
 			}
-			if len(issues) > 0 {
-				fmt.Println("Validation issues:")
+			if len(issues) > 0 || len(warnings) > 0 {
+				fmt.Fprintln(stdout, "Validation issues:")
 				for _, issue := range issues {
-					fmt.Printf("- %s\n", issue)
+					fmt.Fprintf(stdout, "- error: %s\n", issue)
+				}
+				for _, w := range warnings {
+					fmt.Fprintf(stdout, "- warning: %s\n", w)
 				}
-				os.Exit(1)
 			}
-			fmt.Println("Validation successful")
+			if len(issues) > 0 || (*strict && len(warnings) > 0) {
+				return 1
+			}
+			if len(warnings) > 0 {
+				fmt.Fprintf(stdout, "Validation successful with %d warning(s)\n", len(warnings))
+				return 0
+			}
+			fmt.Fprintln(stdout, "Validation successful")
+			return 0
 		},
-		"plan": func() {
-			fs := flag.NewFlagSet("plan", flag.ExitOnError)
+		"validate-all": func() int {
+			fs := newFlagSet("validate-all")
+			format := formatFlag(fs, "text", "text", "json")
 			fs.Usage = func() {
-				fmt.Println("usage: dsl-go plan <file>")
+				fmt.Fprintln(stdout, "usage: dsl-go validate-all [-format=text|json] <dir>")
 				fs.PrintDefaults()
 			}
-			if err := fs.Parse(os.Args[2:]); err != nil {
-				fmt.Fprintf(os.Stderr, "error parsing flags: %v\n", err)
-				os.Exit(1)
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
 			}
 			if fs.NArg() != 1 {
 				fs.Usage()
-				return
+				return 0
+			}
+			out, err := format()
+			if err != nil {
+				fmt.Fprintf(stderr, "error: %v\n", err)
+				return 1
+			}
+			type fileResult struct {
+				Path   string   `json:"path"`
+				Valid  bool     `json:"valid"`
+				Issues []string `json:"issues,omitempty"`
+			}
+			var report struct {
+				Files  []fileResult `json:"files"`
+				Passed int          `json:"passed"`
+				Failed int          `json:"failed"`
+			}
+			report.Files = []fileResult{}
+			err = filepath.WalkDir(fs.Arg(0), func(path string, d iofs.DirEntry, err error) error {
+				if err != nil || d.IsDir() || filepath.Ext(path) != ".sexpr" {
+					return err
+				}
+				content, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				issues, err := mgr.ValidateText(string(content))
+				if err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+				report.Files = append(report.Files, fileResult{Path: path, Valid: len(issues) == 0, Issues: issues})
+				if len(issues) == 0 {
+					report.Passed++
+				} else {
+					report.Failed++
+				}
+				return nil
+			})
+			if err != nil {
+				fmt.Fprintf(stderr, "error validating directory: %v\n", err)
+				return 1
+			}
+			if out == "json" {
+				jsonReport, _ := json.Marshal(report)
+				if err := printData(stdout, out, jsonReport); err != nil {
+					fmt.Fprintf(stderr, "error encoding report: %v\n", err)
+					return 1
+				}
+			} else {
+				for _, f := range report.Files {
+					status := "PASS"
+					if !f.Valid {
+						status = "FAIL"
+					}
+					fmt.Fprintf(stdout, "%s %s\n", status, f.Path)
+					for _, issue := range f.Issues {
+						fmt.Fprintf(stdout, "  - %s\n", issue)
+					}
+				}
+				fmt.Fprintf(stdout, "%d passed, %d failed\n", report.Passed, report.Failed)
+			}
+			if report.Failed > 0 {
+				return 1
+			}
+			return 0
+		},
+		"plan": func() int {
+			fs := newFlagSet("plan")
+			format := formatFlag(fs, "json", "json", "yaml", "text", "dot")
+			fs.Usage = func() {
+				fmt.Fprintln(stdout, "usage: dsl-go plan [-format=json|yaml|text|dot] <file>")
+				fs.PrintDefaults()
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
+			}
+			if fs.NArg() != 1 {
+				fs.Usage()
+				return 0
+			}
+			out, err := format()
+			if err != nil {
+				fmt.Fprintf(stderr, "error: %v\n", err)
+				return 1
 			}
 			file := fs.Arg(0)
-			content, err := os.ReadFile(file)
+			content, err := readInput(stdin, file)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "error reading file: %v\n", err)
-				os.Exit(1)
+				fmt.Fprintf(stderr, "error reading input: %v\n", err)
+				return 1
 			}
 			plan, err := mgr.CompilePlan(string(content))
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "error compiling plan: %v\n", err)
-				os.Exit(1)
+				fmt.Fprintf(stderr, "error compiling plan: %v\n", err)
+				return 1
+			}
+			switch out {
+			case "dot":
+				fmt.Fprint(stdout, manager.PlanToDOT(plan))
+				return 0
+			case "text":
+				fmt.Fprint(stdout, manager.PlanToText(plan))
+				return 0
+			}
+			jsonPlan, _ := json.Marshal(plan)
+			if err := printData(stdout, out, jsonPlan); err != nil {
+				fmt.Fprintf(stderr, "error encoding plan: %v\n", err)
+				return 1
+			}
+			return 0
+		},
+		"refs": func() int {
+			fs := newFlagSet("refs")
+			fs.Usage = func() {
+				fmt.Fprintln(stdout, "usage: dsl-go refs <file> <resource_id>")
+				fs.PrintDefaults()
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
+			}
+			if fs.NArg() != 2 {
+				fs.Usage()
+				return 0
+			}
+			file, resourceID := fs.Arg(0), fs.Arg(1)
+			content, err := readInput(stdin, file)
+			if err != nil {
+				fmt.Fprintf(stderr, "error reading input: %v\n", err)
+				return 1
+			}
+			flows, err := mgr.FlowsReferencingResource(string(content), resourceID)
+			if err != nil {
+				fmt.Fprintf(stderr, "error finding references: %v\n", err)
+				return 1
+			}
+			for _, f := range flows {
+				fmt.Fprintln(stdout, f)
+			}
+			return 0
+		},
+		"tagged": func() int {
+			fs := newFlagSet("tagged")
+			fs.Usage = func() {
+				fmt.Fprintln(stdout, "usage: dsl-go tagged <file> <tag>")
+				fs.PrintDefaults()
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
+			}
+			if fs.NArg() != 2 {
+				fs.Usage()
+				return 0
+			}
+			file, tag := fs.Arg(0), fs.Arg(1)
+			content, err := readInput(stdin, file)
+			if err != nil {
+				fmt.Fprintf(stderr, "error reading input: %v\n", err)
+				return 1
+			}
+			ids, err := mgr.EntitiesWithTag(string(content), tag)
+			if err != nil {
+				fmt.Fprintf(stderr, "error finding tagged entities: %v\n", err)
+				return 1
+			}
+			for _, id := range ids {
+				fmt.Fprintln(stdout, id)
+			}
+			return 0
+		},
+		"resource-graph": func() int {
+			fs := newFlagSet("resource-graph")
+			format := fs.String("format", "dot", "Output format (dot)")
+			fs.Usage = func() {
+				fmt.Fprintln(stdout, "usage: dsl-go resource-graph [-format=dot] <file>")
+				fs.PrintDefaults()
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
+			}
+			if fs.NArg() != 1 {
+				fs.Usage()
+				return 0
+			}
+			content, err := readInput(stdin, fs.Arg(0))
+			if err != nil {
+				fmt.Fprintf(stderr, "error reading input: %v\n", err)
+				return 1
+			}
+			graph, err := mgr.ResourceGraph(string(content), *format)
+			if err != nil {
+				fmt.Fprintf(stderr, "error rendering resource graph: %v\n", err)
+				return 1
+			}
+			fmt.Fprint(stdout, graph)
+			return 0
+		},
+		"plan-delta": func() int {
+			fs := newFlagSet("plan-delta")
+			format := formatFlag(fs, "json", "json", "yaml", "text")
+			fs.Usage = func() {
+				fmt.Fprintln(stdout, "usage: dsl-go plan-delta [-format=json|yaml|text] <from_file> <to_file>")
+				fs.PrintDefaults()
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
+			}
+			if fs.NArg() != 2 {
+				fs.Usage()
+				return 0
+			}
+			out, err := format()
+			if err != nil {
+				fmt.Fprintf(stderr, "error: %v\n", err)
+				return 1
+			}
+			from, err := readInput(stdin, fs.Arg(0))
+			if err != nil {
+				fmt.Fprintf(stderr, "error reading input: %v\n", err)
+				return 1
+			}
+			to, err := readInput(stdin, fs.Arg(1))
+			if err != nil {
+				fmt.Fprintf(stderr, "error reading input: %v\n", err)
+				return 1
+			}
+			delta, err := mgr.PlanDelta(string(from), string(to))
+			if err != nil {
+				fmt.Fprintf(stderr, "error comparing plans: %v\n", err)
+				return 1
+			}
+			if out == "text" {
+				fmt.Fprint(stdout, manager.PlanDeltaToText(delta))
+				return 0
+			}
+			jsonDelta, _ := json.Marshal(delta)
+			if err := printData(stdout, out, jsonDelta); err != nil {
+				fmt.Fprintf(stderr, "error encoding plan delta: %v\n", err)
+				return 1
+			}
+			return 0
+		},
+		"diff": func() int {
+			fs := newFlagSet("diff")
+			format := formatFlag(fs, "text", "text", "json", "yaml")
+			fs.Usage = func() {
+				fmt.Fprintln(stdout, "usage: dsl-go diff [-format=text|json|yaml] <from_file> <to_file>")
+				fs.PrintDefaults()
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
+			}
+			if fs.NArg() != 2 {
+				fs.Usage()
+				return 0
+			}
+			out, err := format()
+			if err != nil {
+				fmt.Fprintf(stderr, "error: %v\n", err)
+				return 1
+			}
+			from, err := readInput(stdin, fs.Arg(0))
+			if err != nil {
+				fmt.Fprintf(stderr, "error reading input: %v\n", err)
+				return 1
+			}
+			to, err := readInput(stdin, fs.Arg(1))
+			if err != nil {
+				fmt.Fprintf(stderr, "error reading input: %v\n", err)
+				return 1
+			}
+			diff, err := mgr.Diff(string(from), string(to))
+			if err != nil {
+				fmt.Fprintf(stderr, "error comparing files: %v\n", err)
+				return 1
+			}
+			if out == "text" {
+				fmt.Fprint(stdout, diff.Summary())
+				return 0
+			}
+			jsonDiff, _ := json.Marshal(diff)
+			if err := printData(stdout, out, jsonDiff); err != nil {
+				fmt.Fprintf(stderr, "error encoding diff: %v\n", err)
+				return 1
+			}
+			return 0
+		},
+		"complexity": func() int {
+			fs := newFlagSet("complexity")
+			format := formatFlag(fs, "json", "json", "yaml")
+			fs.Usage = func() {
+				fmt.Fprintln(stdout, "usage: dsl-go complexity [-format=json|yaml] <file>")
+				fs.PrintDefaults()
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
+			}
+			if fs.NArg() != 1 {
+				fs.Usage()
+				return 0
+			}
+			out, err := format()
+			if err != nil {
+				fmt.Fprintf(stderr, "error: %v\n", err)
+				return 1
+			}
+			content, err := readInput(stdin, fs.Arg(0))
+			if err != nil {
+				fmt.Fprintf(stderr, "error reading input: %v\n", err)
+				return 1
+			}
+			report, err := mgr.Complexity(string(content))
+			if err != nil {
+				fmt.Fprintf(stderr, "error computing complexity: %v\n", err)
+				return 1
+			}
+			jsonReport, _ := json.Marshal(report)
+			if err := printData(stdout, out, jsonReport); err != nil {
+				fmt.Fprintf(stderr, "error encoding complexity: %v\n", err)
+				return 1
+			}
+			return 0
+		},
+		"stats": func() int {
+			fs := newFlagSet("stats")
+			format := formatFlag(fs, "text", "text", "json")
+			fs.Usage = func() {
+				fmt.Fprintln(stdout, "usage: dsl-go stats [-format=text|json] <file>")
+				fs.PrintDefaults()
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
+			}
+			if fs.NArg() != 1 {
+				fs.Usage()
+				return 0
+			}
+			out, err := format()
+			if err != nil {
+				fmt.Fprintf(stderr, "error: %v\n", err)
+				return 1
+			}
+			content, err := readInput(stdin, fs.Arg(0))
+			if err != nil {
+				fmt.Fprintf(stderr, "error reading input: %v\n", err)
+				return 1
+			}
+			report, err := mgr.Stats(string(content))
+			if err != nil {
+				fmt.Fprintf(stderr, "error computing stats: %v\n", err)
+				return 1
+			}
+			if out == "text" {
+				fmt.Fprint(stdout, manager.StatsToText(report))
+				return 0
+			}
+			jsonReport, _ := json.Marshal(report)
+			if err := printData(stdout, out, jsonReport); err != nil {
+				fmt.Fprintf(stderr, "error encoding stats: %v\n", err)
+				return 1
+			}
+			return 0
+		},
+		"attrs": func() int {
+			fs := newFlagSet("attrs")
+			format := formatFlag(fs, "text", "text", "json")
+			fs.Usage = func() {
+				fmt.Fprintln(stdout, "usage: dsl-go attrs [-format=text|json] <file>")
+				fs.PrintDefaults()
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
+			}
+			if fs.NArg() != 1 {
+				fs.Usage()
+				return 0
+			}
+			out, err := format()
+			if err != nil {
+				fmt.Fprintf(stderr, "error: %v\n", err)
+				return 1
+			}
+			content, err := readInput(stdin, fs.Arg(0))
+			if err != nil {
+				fmt.Fprintf(stderr, "error reading input: %v\n", err)
+				return 1
+			}
+			reports, err := mgr.ExtractAttributes(string(content))
+			if err != nil {
+				fmt.Fprintf(stderr, "error extracting attributes: %v\n", err)
+				return 1
+			}
+			if out == "text" {
+				fmt.Fprint(stdout, manager.AttributesToText(reports))
+				return 0
+			}
+			jsonReports, _ := json.Marshal(reports)
+			if err := printData(stdout, out, jsonReports); err != nil {
+				fmt.Fprintf(stderr, "error encoding attributes: %v\n", err)
+				return 1
+			}
+			return 0
+		},
+		"fmt": func() int {
+			fs := newFlagSet("fmt")
+			write := fs.Bool("w", false, "Write the result back to the file instead of to standard output")
+			compact := fs.Bool("compact", false, "Print everything on one line, leaving out comments")
+			fs.Usage = func() {
+				fmt.Fprintln(stdout, "usage: dsl-go fmt [-w] [-compact] <file>")
+				fs.PrintDefaults()
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
+			}
+			if fs.NArg() != 1 {
+				fs.Usage()
+				return 0
+			}
+			file := fs.Arg(0)
+			if *write && file == "-" {
+				fmt.Fprintln(stderr, "error: cannot use -w with standard input")
+				return 1
+			}
+			content, err := readInput(stdin, file)
+			if err != nil {
+				fmt.Fprintf(stderr, "error reading input: %v\n", err)
+				return 1
+			}
+			formatted, err := mgr.Format(string(content))
+			if *compact {
+				formatted, err = mgr.FormatCompact(string(content))
+			}
+			if err != nil {
+				fmt.Fprintf(stderr, "error parsing file: %v\n", err)
+				return 1
+			}
+			if !*write {
+				fmt.Fprint(stdout, formatted)
+				return 0
+			}
+			if formatted == string(content) {
+				return 0
+			}
+			if err := os.WriteFile(file, []byte(formatted), 0o644); err != nil {
+				fmt.Fprintf(stderr, "error writing file: %v\n", err)
+				return 1
+			}
+			return 0
+		},
+		"redact": func() int {
+			fs := newFlagSet("redact")
+			var keys stringList
+			fs.Var(&keys, "key", "Attribute to redact besides those the catalog marks :pii true (repeatable)")
+			fs.Usage = func() {
+				fmt.Fprintln(stdout, "usage: dsl-go redact [-key=<attribute>]... <file>")
+				fs.PrintDefaults()
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
+			}
+			if fs.NArg() != 1 {
+				fs.Usage()
+				return 0
+			}
+			content, err := readInput(stdin, fs.Arg(0))
+			if err != nil {
+				fmt.Fprintf(stderr, "error reading input: %v\n", err)
+				return 1
 			}
-			jsonPlan, _ := json.MarshalIndent(plan, "", "  ")
-			fmt.Println(string(jsonPlan))
+			redacted, err := mgr.Redact(string(content), keys)
+			if err != nil {
+				fmt.Fprintf(stderr, "error parsing file: %v\n", err)
+				return 1
+			}
+			fmt.Fprint(stdout, redacted)
+			return 0
 		},
-		"gen": func() {
-			fs := flag.NewFlagSet("gen", flag.ExitOnError)
+		"verify": func() int {
+			fs := newFlagSet("verify")
+			fs.Usage = func() {
+				fmt.Fprintln(stdout, "usage: dsl-go verify <file>")
+				fs.PrintDefaults()
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
+			}
+			if fs.NArg() != 1 {
+				fs.Usage()
+				return 0
+			}
+			file := fs.Arg(0)
+			content, err := readInput(stdin, file)
+			if err != nil {
+				fmt.Fprintf(stderr, "error reading input: %v\n", err)
+				return 1
+			}
+			diff, err := mgr.Verify(file, string(content))
+			if err != nil {
+				fmt.Fprintf(stderr, "error parsing file: %v\n", err)
+				return 1
+			}
+			if diff != "" {
+				fmt.Fprint(stdout, diff)
+				return 1
+			}
+			return 0
+		},
+		"verify-all": func() int {
+			fs := newFlagSet("verify-all")
+			fs.Usage = func() {
+				fmt.Fprintln(stdout, "usage: dsl-go verify-all <dir>")
+				fs.PrintDefaults()
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
+			}
+			if fs.NArg() != 1 {
+				fs.Usage()
+				return 0
+			}
+			failed := 0
+			err := filepath.WalkDir(fs.Arg(0), func(path string, d iofs.DirEntry, err error) error {
+				if err != nil || d.IsDir() || filepath.Ext(path) != ".sexpr" {
+					return err
+				}
+				content, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				diff, err := mgr.Verify(path, string(content))
+				if err != nil {
+					fmt.Fprintf(stderr, "%s: %v\n", path, err)
+					failed++
+					return nil
+				}
+				if diff != "" {
+					fmt.Fprint(stdout, diff)
+					failed++
+				}
+				return nil
+			})
+			if err != nil {
+				fmt.Fprintf(stderr, "error verifying directory: %v\n", err)
+				return 1
+			}
+			if failed > 0 {
+				return 1
+			}
+			return 0
+		},
+		"gen": func() int {
+			fs := newFlagSet("gen")
 			templateFile := fs.String("template", "", "Template file to use")
+			check := fs.Bool("check", false, "Fail if the template renders DSL that does not parse")
+			strictEnv := fs.Bool("strict-env", false, "Fail if the template reads an unset environment variable with env")
 			fs.Usage = func() {
-				fmt.Println("usage: dsl-go gen -template=<template_file> <scenario_file>")
+				fmt.Fprintln(stdout, "usage: dsl-go gen [-check] [-strict-env] -template=<template_file> <scenario_file>")
+				fmt.Fprintln(stdout, "The scenario file is JSON, or YAML if its name ends in .yaml or .yml.")
 				fs.PrintDefaults()
 			}
-			if err := fs.Parse(os.Args[2:]); err != nil {
-				fmt.Fprintf(os.Stderr, "error parsing flags: %v\n", err)
-				os.Exit(1)
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
 			}
 			if fs.NArg() != 1 || *templateFile == "" {
 				fs.Usage()
-				return
+				return 0
 			}
 			scenarioFile := fs.Arg(0)
 
-			loader := mocks.NewDefaultLoader()
-			req, err := loader.LoadScenario(scenarioFile)
+			req, err := mocks.LoadScenarioFile(scenarioFile)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "error loading scenario: %v\n", err)
-				os.Exit(1)
+				fmt.Fprintf(stderr, "error loading scenario: %v\n", err)
+				return 1
 			}
 
 			req.DataDictionary = mgr.GetDataDictionary()
 
 			gen, err := generator.New()
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "error creating generator: %v\n", err)
-				os.Exit(1)
+				fmt.Fprintf(stderr, "error creating generator: %v\n", err)
+				return 1
 			}
-			resp, err := gen.GenerateFromTemplateFile(*templateFile, req)
+			resp, err := gen.WithRenderedCheck(*check).WithStrictEnv(*strictEnv).GenerateFromTemplateFile(*templateFile, req)
 
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "error generating dsl: %v\n", err)
-				os.Exit(1)
+				fmt.Fprintf(stderr, "error generating dsl: %v\n", err)
+				return 1
 			}
-			fmt.Println(resp.DSL)
+			fmt.Fprintln(stdout, resp.DSL)
+			return 0
 		},
-		"dictionary": func() {
-			fs := flag.NewFlagSet("dictionary", flag.ExitOnError)
+		"build": func() int {
+			fs := newFlagSet("build")
+			reqID := fs.String("id", "", "Request id of the generated DSL")
+			mocksDir := fs.String("mocks", mocks.DefaultBasePath, "Mock data directory holding the entities and products directories")
+			var entityFiles, productFiles stringList
+			fs.Var(&entityFiles, "entity", "Entity file in the entities directory (repeatable)")
+			fs.Var(&productFiles, "product", "Product file in the products directory (repeatable)")
 			fs.Usage = func() {
-				fmt.Println("usage: dsl-go dictionary <attribute_id>")
+				fmt.Fprintln(stdout, "usage: dsl-go build -id=<request_id> -entity=<file> [-entity=<file> ...] [-product=<file> ...] [-mocks=<dir>]")
 				fs.PrintDefaults()
 			}
-			if err := fs.Parse(os.Args[2:]); err != nil {
-				fmt.Fprintf(os.Stderr, "error parsing flags: %v\n", err)
-				os.Exit(1)
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
+			}
+			if fs.NArg() != 0 || *reqID == "" || len(entityFiles) == 0 {
+				fs.Usage()
+				return 0
+			}
+
+			loader := mocks.NewLoader(*mocksDir)
+			req, warnings, err := loader.BuildCustomScenario(*reqID, entityFiles, productFiles)
+			if err != nil {
+				fmt.Fprintf(stderr, "error loading mocks: %v\n", err)
+				return 1
+			}
+			req.DataDictionary = mgr.GetDataDictionary()
+
+			gen, err := generator.New()
+			if err != nil {
+				fmt.Fprintf(stderr, "error creating generator: %v\n", err)
+				return 1
+			}
+			resp, err := gen.Generate(req)
+			if err != nil {
+				fmt.Fprintf(stderr, "error generating dsl: %v\n", err)
+				return 1
+			}
+			for _, w := range append(warnings, resp.Warnings...) {
+				fmt.Fprintf(stderr, "warning: %s\n", w)
+			}
+			fmt.Fprint(stdout, resp.DSL)
+			return 0
+		},
+		"mock": func() int {
+			if len(args) < 2 || args[1] != "reassign-role" {
+				fmt.Fprintln(stdout, "usage: dsl-go mock reassign-role -from=<role> -to=<role> <mocks_dir>")
+				return 0
+			}
+			fs := newFlagSet("mock reassign-role")
+			from := fs.String("from", "", "Role to replace")
+			to := fs.String("to", "", "Role to assign")
+			fs.Usage = func() {
+				fmt.Fprintln(stdout, "usage: dsl-go mock reassign-role -from=<role> -to=<role> <mocks_dir>")
+				fs.PrintDefaults()
+			}
+			if err := fs.Parse(args[2:]); err != nil {
+				return flagStatus(err)
+			}
+			if fs.NArg() != 1 || *from == "" || *to == "" {
+				fs.Usage()
+				return 0
+			}
+			loader := mocks.NewLoader(fs.Arg(0))
+			n, err := loader.ReassignRole(generator.ClientRole(*from), generator.ClientRole(*to))
+			if err != nil {
+				fmt.Fprintf(stderr, "error reassigning role: %v\n", err)
+				return 1
+			}
+			fmt.Fprintf(stdout, "reassigned %d entities from %s to %s\n", n, *from, *to)
+			return 0
+		},
+		"dictionary": func() int {
+			fs := newFlagSet("dictionary")
+			product := fs.Bool("product", false, "Look up a product instead of an attribute")
+			service := fs.Bool("service", false, "Look up a service instead of an attribute")
+			resource := fs.Bool("resource", false, "Look up a resource instead of an attribute")
+			fs.Usage = func() {
+				fmt.Fprintln(stdout, "usage: dsl-go dictionary [-product | -service | -resource] <id>")
+				fs.PrintDefaults()
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
 			}
 			if fs.NArg() != 1 {
 				fs.Usage()
-				return
+				return 0
 			}
-			attrID := fs.Arg(0)
-			attr, ok := mgr.GetAttribute(attrID)
-			if !ok {
-				fmt.Fprintf(os.Stderr, "error: attribute %q not found\n", attrID)
-				os.Exit(1)
+			id := fs.Arg(0)
+			switch {
+			case *product:
+				p, ok := mgr.GetProduct(id)
+				if !ok {
+					fmt.Fprintf(stderr, "error: product %q not found\n", id)
+					return 1
+				}
+				fmt.Fprintf(stdout, "ProductID:   %s\n", p.ProductID)
+				fmt.Fprintf(stdout, "Description: %s\n", p.Description)
+				fmt.Fprintf(stdout, "ServiceIDs:  %s\n", strings.Join(p.ServiceIDs, ", "))
+			case *service:
+				s, ok := mgr.GetService(id)
+				if !ok {
+					fmt.Fprintf(stderr, "error: service %q not found\n", id)
+					return 1
+				}
+				fmt.Fprintf(stdout, "ServiceID:   %s\n", s.ServiceID)
+				fmt.Fprintf(stdout, "Description: %s\n", s.Description)
+				fmt.Fprintf(stdout, "ResourceIDs: %s\n", strings.Join(s.ResourceIDs, ", "))
+			case *resource:
+				r, ok := mgr.GetResource(id)
+				if !ok {
+					fmt.Fprintf(stderr, "error: resource %q not found\n", id)
+					return 1
+				}
+				fmt.Fprintf(stdout, "ResourceID:  %s\n", r.ResourceID)
+				fmt.Fprintf(stdout, "Description: %s\n", r.Description)
+			default:
+				attr, ok := mgr.GetAttribute(id)
+				if !ok {
+					fmt.Fprintf(stderr, "error: attribute %q not found\n", id)
+					return 1
+				}
+				fmt.Fprintf(stdout, "AttributeID: %s\n", attr.AttributeID)
+				fmt.Fprintf(stdout, "Description: %s\n", attr.Description)
+				fmt.Fprintf(stdout, "VectorID:    %s\n", attr.VectorID)
+				if attr.Type != "" {
+					fmt.Fprintf(stdout, "Type:        %s\n", attr.Type)
+				}
 			}
-			fmt.Printf("AttributeID: %s\n", attr.AttributeID)
-			fmt.Printf("Description: %s\n", attr.Description)
-			fmt.Printf("VectorID:    %s\n", attr.VectorID)
+			return 0
 		},
-		"ebnf": func() {
-			fmt.Println(ebnf.Text)
+		"schema": func() int {
+			fmt.Fprintln(stdout, string(generator.ScenarioJSONSchema()))
+			return 0
 		},
-		"ast-json": func() {
-			fs := flag.NewFlagSet("ast-json", flag.ExitOnError)
+		"ebnf": func() int {
+			fmt.Fprint(stdout, ebnf.Text)
+			return 0
+		},
+		"ast-json": func() int {
+			fs := newFlagSet("ast-json")
+			format := formatFlag(fs, "json", "json", "yaml", "text")
 			fs.Usage = func() {
-				fmt.Println("usage: dsl-go ast-json <file>")
+				fmt.Fprintln(stdout, "usage: dsl-go ast-json [-format=json|yaml|text] <file>")
 				fs.PrintDefaults()
 			}
-			if err := fs.Parse(os.Args[2:]); err != nil {
-				fmt.Fprintf(os.Stderr, "error parsing flags: %v\n", err)
-				os.Exit(1)
+			if err := fs.Parse(args[1:]); err != nil {
+				return flagStatus(err)
 			}
 			if fs.NArg() != 1 {
 				fs.Usage()
-				return
+				return 0
 			}
 			file := fs.Arg(0)
-			content, err := os.ReadFile(file)
+			content, err := readInput(stdin, file)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "error reading file: %v\n", err)
-				os.Exit(1)
+				fmt.Fprintf(stderr, "error reading input: %v\n", err)
+				return 1
 			}
-			parser, err := parse.New()
+			out, err := format()
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "error creating parser: %v\n", err)
-				os.Exit(1)
+				fmt.Fprintf(stderr, "error: %v\n", err)
+				return 1
 			}
+			parser, err := parse.New()
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "error creating parser: %v\n", err)
-				os.Exit(1)
+				fmt.Fprintf(stderr, "error creating parser: %v\n", err)
+				return 1
 			}
-			ast, err := parser.Parse(string(content))
+			req, err := parser.Parse(string(content))
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "error parsing file: %v\n", err)
-				os.Exit(1)
+				fmt.Fprintf(stderr, "error parsing file: %v\n", err)
+				return 1
 			}
-			jsonAST, _ := json.MarshalIndent(ast, "", "  ")
-			fmt.Println(string(jsonAST))
+			if err := printRequest(stdout, out, req); err != nil {
+				fmt.Fprintf(stderr, "error encoding ast: %v\n", err)
+				return 1
+			}
+			return 0
 		},
 	}
 
-	cmd, ok := cmds[os.Args[1]]
+	cmd, ok := cmds[args[0]]
 	if !ok {
-		usage()
-		return
+		usage(stdout)
+		return 0
+	}
+	status := cmd()
+	if err := mgr.Close(); err != nil {
+		fmt.Fprintf(stderr, "error closing storage: %v\n", err)
+		return 1
 	}
-	cmd()
+	return status
 }
 
-func usage() {
-	fmt.Println("usage: dsl-go <command> [<args>]")
-	fmt.Println("Commands:")
-	fmt.Println("  create      Create a new onboarding request from a template")
-	fmt.Println("  get         Get the latest version of an onboarding request")
-	fmt.Println("  validate    Validate a DSL file")
-	fmt.Println("  plan        Compile a DSL file into a plan")
-	fmt.Println("  gen         Generate a DSL file from a scenario")
-	fmt.Println("  ebnf        Print the EBNF grammar")
-	fmt.Println("  ast-json    Print the AST of a DSL file as JSON")
-	fmt.Println("  dictionary  Get information about a data dictionary attribute")
+// flagStatus returns the exit status for an error from parsing a command's
+// flags, which the flag set has already reported: 0 if help was asked for,
+// 2 otherwise, as flag.ExitOnError would exit.
+func flagStatus(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	return 2
+}
+
+// tenantManager scopes mgr to tenant, or returns mgr itself when no tenant
+// was given.
+func tenantManager(mgr *manager.Manager, tenant string) (*manager.Manager, error) {
+	if tenant == "" {
+		return mgr, nil
+	}
+	return mgr.ForTenant(tenant)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: dsl-go <command> [<args>]")
+	fmt.Fprintln(w, "Commands:")
+	fmt.Fprintln(w, "  create      Create a new onboarding request from a template")
+	fmt.Fprintln(w, "  update      Store a new version of an existing onboarding request")
+	fmt.Fprintln(w, "  patch       Apply entity and resource changes in diff -format=json form to a stored request")
+	fmt.Fprintln(w, "  rollback    Restore an earlier version as the new latest version")
+	fmt.Fprintln(w, "  get         Get the latest version of an onboarding request")
+	fmt.Fprintln(w, "  list        List stored requests with their latest version")
+	fmt.Fprintln(w, "  validate    Validate a DSL file")
+	fmt.Fprintln(w, "  validate-all  Validate every .sexpr file under a directory")
+	fmt.Fprintln(w, "  plan        Compile a DSL file into a plan")
+	fmt.Fprintln(w, "  plan-delta  Show the steps added, removed and changed between the plans of two DSL files")
+	fmt.Fprintln(w, "  diff        Show entity, resource and flow differences between two DSL files")
+	fmt.Fprintln(w, "  complexity  Report complexity metrics for a DSL file")
+	fmt.Fprintln(w, "  stats       Count entities by role, resources by type, tasks by op and more")
+	fmt.Fprintln(w, "  attrs       List every entity attribute with its value and provenance")
+	fmt.Fprintln(w, "  refs        List the flows that reference a resource")
+	fmt.Fprintln(w, "  tagged      List the entities carrying a tag")
+	fmt.Fprintln(w, "  resource-graph  Render resource requires as a graph")
+	fmt.Fprintln(w, "  fmt         Reformat a DSL file in the canonical layout")
+	fmt.Fprintln(w, "  redact      Print a DSL file with PII attribute values replaced by \"***\"")
+	fmt.Fprintln(w, "  verify      Check that a DSL file is in the canonical layout, printing a diff if not")
+	fmt.Fprintln(w, "  verify-all  Run verify on every .sexpr file under a directory")
+	fmt.Fprintln(w, "  gen         Generate a DSL file from a scenario")
+	fmt.Fprintln(w, "  build       Generate a DSL file from entity and product mock files")
+	fmt.Fprintln(w, "  mock        Maintain mock data files (reassign-role)")
+	fmt.Fprintln(w, "  ebnf        Print the EBNF grammar")
+	fmt.Fprintln(w, "  schema      Print the JSON Schema for scenario files")
+	fmt.Fprintln(w, "  ast-json    Print the AST of a DSL file as JSON")
+	fmt.Fprintln(w, "  dictionary  Get information about a data dictionary attribute, product, service or resource")
+	fmt.Fprintln(w, "A DSL file argument of - reads the file from standard input.")
+}
+
+// parseSince parses a -since value, either a date (2006-01-02, taken as
+// midnight UTC) or an RFC 3339 time.
+func parseSince(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -since %q: want a date (2006-01-02) or an RFC 3339 time", s)
+	}
+	return t, nil
+}
+
+// stringList is a flag that may be repeated, collecting every value.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// readInput returns the contents of the named DSL file, or of stdin if name
+// is "-".
+func readInput(stdin io.Reader, name string) ([]byte, error) {
+	if name != "-" {
+		return os.ReadFile(name)
+	}
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		return nil, fmt.Errorf("read standard input: %w", err)
+	}
+	return data, nil
 }
@@ -0,0 +1,515 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const validDoc = `(onboarding-request
+  (:meta (request-id "r1") (version 1))
+  (:orchestrator
+    (:lifecycle (states draft done) (initial draft) (transitions (-> draft done)))
+    (:entities
+      (entity :id "le:A" :type LegalEntity
+        (attrs (name "A") (country GB))))
+    (:resources
+      (resource :id "acct" :type Account (requires (entity "le:A"))))
+    (:flows
+      (flow :id "main"
+        (steps (task :id "open" :on "acct" :op open-account (args)))))))
+`
+
+// runCLI runs the command line args with stdin as standard input and returns
+// the exit status and everything written to standard output and error.
+func runCLI(t *testing.T, stdin string, args ...string) (status int, stdout, stderr string) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	status = run(args, strings.NewReader(stdin), &out, &errOut)
+	return status, out.String(), errOut.String()
+}
+
+// inTempDir changes to a new temporary directory holding files, keyed by
+// path relative to it, for the rest of the test.
+func inTempDir(t *testing.T, files map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+}
+
+func TestStdinInput(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		stdin      string
+		wantStatus int
+		wantOut    string
+		wantErr    string
+	}{
+		{"validate", []string{"validate", "-"}, validDoc, 0, "Validation successful", ""},
+		{"validate invalid", []string{"validate", "-"}, "(onboarding-request", 1, "-:", ""},
+		{"ast-json", []string{"ast-json", "-"}, validDoc, 0, `"request_id": "r1"`, ""},
+		{"plan", []string{"plan", "-format=text", "-"}, validDoc, 0, "open", ""},
+		{"plan dot", []string{"plan", "-format=dot", "-"}, validDoc, 0, "digraph plan {\n", ""},
+		{"missing file", []string{"validate", "missing.sexpr"}, "", 1, "", "error reading input: open missing.sexpr"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t, nil)
+			status, stdout, stderr := runCLI(t, tt.stdin, tt.args...)
+			if status != tt.wantStatus || !strings.Contains(stdout, tt.wantOut) || !strings.Contains(stderr, tt.wantErr) {
+				t.Errorf("status %d, stdout:\n%s\nstderr:\n%s\nwant status %d, stdout containing %q, stderr containing %q",
+					status, stdout, stderr, tt.wantStatus, tt.wantOut, tt.wantErr)
+			}
+		})
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("broken pipe") }
+
+func TestStdinReadFailure(t *testing.T) {
+	inTempDir(t, nil)
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{"validate", "-"}, failingReader{}, &stdout, &stderr); status != 1 {
+		t.Errorf("status = %d, want 1", status)
+	}
+	if want := "error reading input: read standard input: broken pipe"; !strings.Contains(stderr.String(), want) {
+		t.Errorf("stderr = %q, want it to contain %q", stderr.String(), want)
+	}
+}
+
+func TestFmt(t *testing.T) {
+	const messy = `(onboarding-request (:meta (request-id "r1")
+(version 1)) (:orchestrator (:lifecycle (states draft) (initial draft) (transitions))
+      (:entities (entity :id "le:A" :type LegalEntity (attrs (name "A"))))))`
+	const canonical = `(onboarding-request
+  (:meta
+    (request-id "r1")
+    (version 1))
+  (:orchestrator
+    (:lifecycle
+      (states draft)
+      (initial draft)
+      (transitions))
+    (:entities
+      (entity :id "le:A" :type LegalEntity
+        (attrs
+          (name "A")
+        ))
+    )
+  )
+)
+`
+	tests := []struct {
+		name       string
+		args       []string
+		stdin      string
+		wantStatus int
+		wantOut    string
+		wantFile   string
+		wantErr    string
+	}{
+		{"stdin to stdout", []string{"fmt", "-"}, messy, 0, canonical, messy, ""},
+		{"file to stdout", []string{"fmt", "req.sexpr"}, "", 0, canonical, messy, ""},
+		{"write back", []string{"fmt", "-w", "req.sexpr"}, "", 0, "", canonical, ""},
+		{"write back stdin", []string{"fmt", "-w", "-"}, messy, 1, "", messy, "cannot use -w with standard input"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t, map[string]string{"req.sexpr": messy})
+			status, stdout, stderr := runCLI(t, tt.stdin, tt.args...)
+			if status != tt.wantStatus || stdout != tt.wantOut || !strings.Contains(stderr, tt.wantErr) {
+				t.Errorf("status %d, stdout:\n%s\nstderr:\n%s\nwant status %d, stdout:\n%s\nstderr containing %q",
+					status, stdout, stderr, tt.wantStatus, tt.wantOut, tt.wantErr)
+			}
+			if got, err := os.ReadFile("req.sexpr"); err != nil || string(got) != tt.wantFile {
+				t.Errorf("req.sexpr = %q, %v; want %q", got, err, tt.wantFile)
+			}
+		})
+	}
+}
+
+func TestFmtIdempotent(t *testing.T) {
+	inTempDir(t, nil)
+	_, once, _ := runCLI(t, validDoc, "fmt", "-")
+	status, twice, stderr := runCLI(t, once, "fmt", "-")
+	if status != 0 || twice != once {
+		t.Errorf("formatting twice = %d %q, stderr %q; want 0 and\n%s", status, twice, stderr, once)
+	}
+}
+
+func TestValidateStrict(t *testing.T) {
+	// An unused resource is only a warning.
+	warningOnly := strings.Replace(validDoc, `(requires (entity "le:A"))))`,
+		`(requires (entity "le:A")))
+      (resource :id "spare" :type Account))`, 1)
+	// A step on an unknown resource is an error.
+	invalid := strings.Replace(validDoc, `:on "acct"`, `:on "nope"`, 1)
+	tests := []struct {
+		name       string
+		args       []string
+		stdin      string
+		wantStatus int
+		wantOut    string
+	}{
+		{"clean", []string{"validate", "-"}, validDoc, 0, "Validation successful\n"},
+		{"warning", []string{"validate", "-"}, warningOnly, 0, "Validation successful with 1 warning(s)"},
+		{"warning, strict", []string{"validate", "-strict", "-"}, warningOnly, 1, `- warning: `},
+		{"error", []string{"validate", "-"}, invalid, 1, "- error: "},
+		{"error, strict", []string{"validate", "-strict", "-"}, invalid, 1, "- error: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t, nil)
+			status, stdout, stderr := runCLI(t, tt.stdin, tt.args...)
+			if status != tt.wantStatus || !strings.Contains(stdout, tt.wantOut) {
+				t.Errorf("status %d, stdout:\n%s\nstderr:\n%s\nwant status %d, stdout containing %q",
+					status, stdout, stderr, tt.wantStatus, tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestValidateParseErrorPosition(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		wantOut string
+	}{
+		{"bad token", strings.Replace(validDoc, `:type Account`, `:type "Account"`, 1),
+			`bad.sexpr:9:34: :type must be an identifier, got "Account"`},
+		{"misspelt section", strings.Replace(validDoc, `(:flows`, `(:flow`, 1),
+			`bad.sexpr:10:5: unexpected (:flow ...) in (:orchestrator ...)`},
+		{"unclosed form", strings.Replace(validDoc, `(country GB)`, `(country GB`, 1),
+			`bad.sexpr:13:1: unexpected token "<EOF>"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t, map[string]string{"bad.sexpr": tt.doc})
+			status, stdout, stderr := runCLI(t, "", "validate", "bad.sexpr")
+			if status != 1 || !strings.Contains(stdout, "\n"+tt.wantOut) {
+				t.Errorf("status %d, stdout:\n%s\nstderr:\n%s\nwant status 1, a line starting %q",
+					status, stdout, stderr, tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestValidateAll(t *testing.T) {
+	files := map[string]string{
+		"reqs/good.sexpr":       validDoc,
+		"reqs/sub/bad.sexpr":    "(onboarding-request",
+		"reqs/notes.txt":        "not DSL",
+		"clean/only.sexpr":      validDoc,
+		"clean/sub/also.sexpr":  validDoc,
+		"clean/sub/ignored.txt": "(",
+	}
+	tests := []struct {
+		name       string
+		args       []string
+		wantStatus int
+		wantOut    []string
+	}{
+		{"text", []string{"validate-all", "reqs"}, 1, []string{
+			"PASS " + filepath.Join("reqs", "good.sexpr"),
+			"FAIL " + filepath.Join("reqs", "sub", "bad.sexpr"),
+			"1 passed, 1 failed",
+		}},
+		{"json", []string{"validate-all", "-format=json", "reqs"}, 1, []string{
+			`"path": "` + filepath.Join("reqs", "good.sexpr") + `",` + "\n      \"valid\": true",
+			`"passed": 1`,
+			`"failed": 1`,
+		}},
+		{"all valid", []string{"validate-all", "clean"}, 0, []string{"2 passed, 0 failed"}},
+		{"missing directory", []string{"validate-all", "nope"}, 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t, files)
+			status, stdout, stderr := runCLI(t, "", tt.args...)
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d; stderr:\n%s", status, tt.wantStatus, stderr)
+			}
+			for _, w := range tt.wantOut {
+				if !strings.Contains(stdout, w) {
+					t.Errorf("stdout does not contain %q:\n%s", w, stdout)
+				}
+			}
+			if strings.Contains(stdout, "notes.txt") {
+				t.Errorf("stdout reports a non-.sexpr file:\n%s", stdout)
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	doc := strings.Replace(validDoc, `(entity :id "le:A" :type LegalEntity
+        (attrs (name "A") (country GB))))`, `(entity :id "le:A" :type LegalEntity
+        (attrs (name "A") (role sicav)))
+      (entity :id "le:B" :type LegalEntity
+        (attrs (name "B") (role "sicav")))
+      (entity :id "le:C" :type LegalEntity
+        (attrs (role sicav :superseded-at "2025-01-01T00:00:00Z") (role custodian)))
+      (entity :id "le:D" :type Person
+        (attrs (name "D"))))`, 1)
+	tests := []struct {
+		name    string
+		args    []string
+		wantOut []string
+	}{
+		{"text", []string{"stats", "-"}, []string{
+			"entities: 4\n  (none): 1\n  custodian: 1\n  sicav: 2\n",
+			"resources: 1\n  Account: 1\n",
+			"tasks: 1\n  open-account: 1\n",
+			"attributes: 7\n",
+		}},
+		{"json", []string{"stats", "-format=json", "-"}, []string{
+			`"entities_by_role": {
+    "(none)": 1,
+    "custodian": 1,
+    "sicav": 2
+  }`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t, nil)
+			status, stdout, stderr := runCLI(t, doc, tt.args...)
+			if status != 0 {
+				t.Fatalf("status = %d; stderr:\n%s", status, stderr)
+			}
+			for _, w := range tt.wantOut {
+				if !strings.Contains(stdout, w) {
+					t.Errorf("stdout does not contain %q:\n%s", w, stdout)
+				}
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	inTempDir(t, nil)
+	_, canonical, _ := runCLI(t, validDoc, "fmt", "-")
+	files := map[string]string{
+		"canonical.sexpr":      canonical,
+		"messy.sexpr":          validDoc,
+		"dir/ok.sexpr":         canonical,
+		"dir/sub/messy.sexpr":  validDoc,
+		"clean/ok.sexpr":       canonical,
+		"clean/sub/also.sexpr": canonical,
+	}
+	tests := []struct {
+		name       string
+		args       []string
+		wantStatus int
+		wantOut    []string
+	}{
+		{"canonical", []string{"verify", "canonical.sexpr"}, 0, nil},
+		{"not canonical", []string{"verify", "messy.sexpr"}, 1, []string{
+			"--- messy.sexpr\n+++ messy.sexpr (formatted)\n",
+			"-  (:meta (request-id \"r1\") (version 1))\n",
+			"+  (:meta\n",
+		}},
+		{"directory", []string{"verify-all", "dir"}, 1, []string{
+			"--- " + filepath.Join("dir", "sub", "messy.sexpr") + "\n",
+		}},
+		{"canonical directory", []string{"verify-all", "clean"}, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t, files)
+			status, stdout, stderr := runCLI(t, "", tt.args...)
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d; stderr:\n%s", status, tt.wantStatus, stderr)
+			}
+			if len(tt.wantOut) == 0 && stdout != "" {
+				t.Errorf("stdout = %q, want nothing", stdout)
+			}
+			for _, w := range tt.wantOut {
+				if !strings.Contains(stdout, w) {
+					t.Errorf("stdout does not contain %q:\n%s", w, stdout)
+				}
+			}
+			if strings.Contains(stdout, "ok.sexpr") {
+				t.Errorf("stdout reports a canonical file:\n%s", stdout)
+			}
+		})
+	}
+}
+
+func TestBuild(t *testing.T) {
+	files := map[string]string{
+		"mocks/entities/fund.json":    `{"id": "le:Fund", "name": "Fund", "role": "sicav", "entity_type": "LegalEntity", "country": "LU"}`,
+		"mocks/entities/bank.json":    `{"id": "le:Bank", "name": "Bank", "role": "custodian", "entity_type": "LegalEntity", "country": "DE"}`,
+		"mocks/products/custody.json": `{"id": "custody", "product_type": "CustodySafekeeping", "currency": "EUR"}`,
+	}
+	tests := []struct {
+		name       string
+		args       []string
+		wantStatus int
+		wantOut    []string
+		wantErr    string
+	}{
+		{"two entities and a product", []string{"build", "-mocks=mocks", "-id=req-1",
+			"-entity=fund.json", "-entity=bank.json", "-product=custody.json"}, 0, []string{
+			`(request-id "req-1")`,
+			`(entity :id "le:Fund" :type LegalEntity`,
+			`(entity :id "le:Bank" :type LegalEntity`,
+			`(resource :id "custody-eur" :type CustodySafekeeping`,
+			`(requires (entity "le:Bank"))`,
+		}, ""},
+		{"repeated entity", []string{"build", "-mocks=mocks", "-id=req-1",
+			"-entity=fund.json", "-entity=fund.json"}, 0, []string{
+			`(entity :id "le:Fund" :type LegalEntity`,
+		}, `warning: entity "le:Fund" in fund.json already loaded from fund.json; skipped`},
+		{"missing entity file", []string{"build", "-mocks=mocks", "-id=req-1",
+			"-entity=nope.json"}, 1, nil, "error loading mocks: "},
+		{"no entities prints usage", []string{"build", "-mocks=mocks", "-id=req-1"}, 0, []string{
+			"usage: dsl-go build",
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t, files)
+			status, stdout, stderr := runCLI(t, "", tt.args...)
+			if status != tt.wantStatus || !strings.Contains(stderr, tt.wantErr) {
+				t.Errorf("status %d, stderr:\n%s\nwant status %d, stderr containing %q",
+					status, stderr, tt.wantStatus, tt.wantErr)
+			}
+			for _, w := range tt.wantOut {
+				if !strings.Contains(stdout, w) {
+					t.Errorf("stdout does not contain %q:\n%s", w, stdout)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateDictionary(t *testing.T) {
+	files := map[string]string{
+		"registry/data-dictionary.json": `{"attributes": [{"AttributeID": "name"}]}`,
+	}
+	tests := []struct {
+		name       string
+		args       []string
+		wantStatus int
+		wantOut    string
+	}{
+		{"off", []string{"validate", "-"}, 0, "Validation successful\n"},
+		{"warning", []string{"validate", "-dictionary", "-"}, 0,
+			`- warning: 7:27: entity "le:A": attribute country is not in the data dictionary`},
+		{"strict", []string{"validate", "-dictionary", "-strict", "-"}, 1,
+			`- error: 7:27: entity "le:A": attribute country is not in the data dictionary`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t, files)
+			status, stdout, stderr := runCLI(t, validDoc, tt.args...)
+			if status != tt.wantStatus || !strings.Contains(stdout, tt.wantOut) {
+				t.Errorf("status %d, stdout:\n%s\nstderr:\n%s\nwant status %d, stdout containing %q",
+					status, stdout, stderr, tt.wantStatus, tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestDictionaryLookup(t *testing.T) {
+	files := map[string]string{
+		"registry/data-dictionary.json": `{
+  "products": [{"ProductID": "custody", "ServiceIDs": ["safekeeping", "settlement"]}],
+  "services": [{"ServiceID": "safekeeping", "ResourceIDs": ["custody-account"]}]
+}`,
+	}
+	tests := []struct {
+		name       string
+		args       []string
+		wantStatus int
+		wantOut    string
+		wantErr    string
+	}{
+		{"product", []string{"dictionary", "-product", "custody"}, 0, "ServiceIDs:  safekeeping, settlement\n", ""},
+		{"service", []string{"dictionary", "-service", "safekeeping"}, 0, "ResourceIDs: custody-account\n", ""},
+		{"unknown product", []string{"dictionary", "-product", "nope"}, 1, "", `error: product "nope" not found`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t, files)
+			status, stdout, stderr := runCLI(t, "", tt.args...)
+			if status != tt.wantStatus || !strings.Contains(stdout, tt.wantOut) || !strings.Contains(stderr, tt.wantErr) {
+				t.Errorf("status %d, stdout:\n%s\nstderr:\n%s\nwant status %d, stdout containing %q, stderr containing %q",
+					status, stdout, stderr, tt.wantStatus, tt.wantOut, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDiffAndComplexityFormats(t *testing.T) {
+	files := map[string]string{
+		"a.sexpr": validDoc,
+		"b.sexpr": strings.Replace(validDoc, "(country GB)", "(country FR)", 1),
+	}
+	tests := []struct {
+		name       string
+		args       []string
+		wantStatus int
+		wantOut    string
+		wantErr    string
+	}{
+		{"diff text", []string{"diff", "a.sexpr", "b.sexpr"}, 0, "le:A", ""},
+		{"diff json", []string{"diff", "-format=json", "a.sexpr", "b.sexpr"}, 0, "{\n  \"entities\": {\n", ""},
+		{"diff yaml", []string{"diff", "-format=yaml", "a.sexpr", "b.sexpr"}, 0, "entities:\n  added: []\n", ""},
+		{"diff bad format", []string{"diff", "-format=dot", "a.sexpr", "b.sexpr"}, 1, "", `unsupported format "dot" for diff`},
+		{"complexity json", []string{"complexity", "a.sexpr"}, 0, "{\n  \"entities\": 1,\n", ""},
+		{"complexity yaml", []string{"complexity", "-format=yaml", "a.sexpr"}, 0, "entities: 1\nresources: 1\n", ""},
+		{"complexity bad format", []string{"complexity", "-format=text", "a.sexpr"}, 1, "", `unsupported format "text" for complexity`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t, files)
+			status, stdout, stderr := runCLI(t, "", tt.args...)
+			if status != tt.wantStatus || !strings.Contains(stdout, tt.wantOut) || !strings.Contains(stderr, tt.wantErr) {
+				t.Errorf("status %d, stdout:\n%s\nstderr:\n%s\nwant status %d, stdout containing %q, stderr containing %q",
+					status, stdout, stderr, tt.wantStatus, tt.wantOut, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"2024-01-01", "2024-01-01T00:00:00Z", false},
+		{"2024-01-01T10:30:00+02:00", "2024-01-01T08:30:00Z", false},
+		{"01/02/2024", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseSince(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseSince(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got.UTC().Format(time.RFC3339) != tt.want {
+			t.Errorf("parseSince(%q) = %v, %v; want %s", tt.in, got, err, tt.want)
+		}
+	}
+}
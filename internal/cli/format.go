@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/example/dsl-go/internal/ast"
+	"github.com/example/dsl-go/internal/print"
+	"gopkg.in/yaml.v3"
+)
+
+// formatFlag registers the -format flag shared by the output commands. The
+// returned function yields the chosen format, or an error if it is not one of
+// allowed.
+func formatFlag(fs *flag.FlagSet, def string, allowed ...string) func() (string, error) {
+	format := fs.String("format", def, "Output format ("+strings.Join(allowed, ", ")+")")
+	return func() (string, error) {
+		for _, a := range allowed {
+			if *format == a {
+				return a, nil
+			}
+		}
+		return "", fmt.Errorf("unsupported format %q for %s (supported: %s)", *format, fs.Name(), strings.Join(allowed, ", "))
+	}
+}
+
+// printData prints the JSON document data to w as indented JSON or, for
+// "yaml", as block-style YAML with the same keys in the same order.
+func printData(w io.Writer, format string, data []byte) error {
+	if format != "yaml" {
+		var out bytes.Buffer
+		if err := json.Indent(&out, data, "", "  "); err != nil {
+			return err
+		}
+		fmt.Fprintln(w, out.String())
+		return nil
+	}
+	// JSON is YAML, so decoding it into a node keeps the key order.
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	blockStyle(&doc)
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// blockStyle clears the flow and quoting styles the JSON syntax gave n and
+// its descendants.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// printRequest prints req to w as DSL text or in the ast.ToJSON schema as
+// JSON or YAML.
+func printRequest(w io.Writer, format string, req *ast.Request) error {
+	if format == "text" {
+		return print.Write(w, req)
+	}
+	data, err := ast.ToJSON(req)
+	if err != nil {
+		return err
+	}
+	return printData(w, format, data)
+}
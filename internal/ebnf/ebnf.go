@@ -9,13 +9,14 @@ transition = "(" "->" Ident Ident [guard] [effects] ")" .
 guard = "(" "when" expr ")" .
 effects = "(" "do" action-call* ")" .
 entities = "(" ":entities" entity* ")" .
-entity = "(" "entity" ":id" String ":type" Ident "(" "attrs" attr* ")" ")" .
-attr = "(" Ident value [ ":" "provenance" String ] [ ":" "needed-by" "(" Ident* ")" ] ")" .
+entity = "(" "entity" ":id" String ":type" Ident [ "(" "tags" Ident* ")" ] "(" "attrs" attr* ")" ")" .
+attr = "(" Ident value [ ":" "provenance" String ] [ ":" "needed-by" "(" Ident* ")" ] [ ":" "superseded-at" String ] ")" .
 resources = "(" ":resources" resource* ")" .
 resource = "(" "resource" ":id" String ":type" Ident [requires] [config] ")" .
 requires = "(" "requires" require-item* ")" .
-require-item = "(" "entity" String ")" .
-config = "(" "config" kv-pair* ")" .
+require-item = "(" ( "entity" | "resource" ) String ")" .
+config = "(" "config" config-entry* ")" .
+config-entry = kv-pair | "(" Ident config-entry+ ")" .
 flows = "(" ":flows" flow* ")" .
 flow = "(" "flow" ":id" String [String] "(" "steps" step* ")" ")" .
 step = task | gate | fork | join .
@@ -26,16 +27,17 @@ join = "(" "join" ":id" String "(" "after" String* ")" ")" .
 policies = "(" ":policies" policy* ")" .
 policy = "(" "policy" Ident kv-pair* ")" .
 catalog = "(" ":catalog" "(" ":attributes" attr-def* ")" "(" ":actions" action-def* ")" ")" .
-attr-def = "(" Ident ":" "type" Ident [ ":" "enum" "(" Ident* ")" ] [ ":" "format" Ident ] [ ":" "pii" ("true" | "false") "] ")" .
+attr-def = "(" Ident ":type" Ident [ ":enum" "(" Ident* ")" ] [ ":format" Ident ] [ ":pii" ("true" | "false") ] ")" .
 action-def = "(" Ident "(" "params" param-def* ")" "(" "needs" String* ")" "(" "produces" String* ")" ")" .
-param-def = "(" Ident ":" "type" Ident [ ":" "required" ("true" | "false") ] [ ":" "enum" "(" Ident* ")" ] ")" .
+param-def = "(" Ident ":type" Ident [ ":required" ("true" | "false") ] [ ":enum" "(" Ident* ")" ] ")" .
 expr = Ident [String] .
 kv-pair = "(" Ident value ")" .
-value = String | Number | "true" | "false" | Ident .
+value = String | Number | Duration | "true" | "false" | Ident .
 product-service-mappings = "(" ":product-service-mappings" mapping* ")" .
 mapping = "(" "mapping" ":product" String ":services" "(" String* ")" ":resources" "(" String* ")" ")" .
 
 String = \"\" ( { all unicode characters | \\ ( \" \" | \\ ) } ) \"\" .
 Number = [ "-" ] { "0" ... "9" } [ "." { "0" ... "9" } ] .
+Duration = { Number ( "ns" | "us" | "ms" | "s" | "m" | "h" | "d" ) } .
 Ident = ( "a" ... "z" | "A" ... "Z" | "_" ) { "a" ... "z" | "A" ... "Z" | "0" ... "9" | "_" | "-" } .
 `
@@ -0,0 +1,41 @@
+package generator
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"text/template"
+	"time"
+)
+
+// templateFuncs returns the functions available to templates rendered by
+// GenerateFromTemplateFile:
+//
+//   - env "NAME" yields the value of an environment variable. An unset
+//     variable renders empty, or fails the render if strictEnv is set.
+//   - now yields the time of the render, the same as .Now.
+//   - uuid yields a new random (version 4) UUID.
+func templateFuncs(now time.Time, strictEnv bool) template.FuncMap {
+	return template.FuncMap{
+		"env": func(name string) (string, error) {
+			v, ok := os.LookupEnv(name)
+			if !ok && strictEnv {
+				return "", fmt.Errorf("environment variable %s is not set", name)
+			}
+			return v, nil
+		},
+		"now":  func() time.Time { return now },
+		"uuid": newUUID,
+	}
+}
+
+// newUUID returns a random version 4 UUID in its canonical text form.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate uuid: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,102 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// renderTemplate renders text as a template file through
+// GenerateFromTemplateFile, from a temporary working directory.
+func renderTemplate(t *testing.T, g *Generator, text string) (string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "templates"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "templates", "t.sexpr"), []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+	req := &GenerateRequest{
+		RequestID: "r1",
+		Entities:  []ClientEntity{{ID: "le:A", Name: "A", Role: RoleSicav, EntityType: "LegalEntity"}},
+	}
+	resp, err := g.GenerateFromTemplateFile("t.sexpr", req)
+	if err != nil {
+		return "", err
+	}
+	return resp.DSL, nil
+}
+
+func TestTemplateEnv(t *testing.T) {
+	t.Setenv("DSL_GO_TEST_REGION", "eu-west-1")
+	tests := []struct {
+		name      string
+		template  string
+		strictEnv bool
+		want      string
+		wantErr   string
+	}{
+		{"set variable", `(region "{{env "DSL_GO_TEST_REGION"}}")`, false, `(region "eu-west-1")`, ""},
+		{"set variable, strict", `(region "{{env "DSL_GO_TEST_REGION"}}")`, true, `(region "eu-west-1")`, ""},
+		{"unset variable renders empty", `(region "{{env "DSL_GO_TEST_UNSET"}}")`, false, `(region "")`, ""},
+		{"unset variable, strict", `(region "{{env "DSL_GO_TEST_UNSET"}}")`, true, "", "environment variable DSL_GO_TEST_UNSET is not set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := renderTemplate(t, g.WithStrictEnv(tt.strictEnv), tt.template)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("rendered %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateNowAndUUID(t *testing.T) {
+	g, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := renderTemplate(t, g, `{{now.Equal .Now}} {{uuid}} {{uuid}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Fields(got)
+	if len(fields) != 3 || fields[0] != "true" {
+		t.Fatalf("rendered %q, want now equal to .Now and two uuids", got)
+	}
+	v4 := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for _, u := range fields[1:] {
+		if !v4.MatchString(u) {
+			t.Errorf("%q is not a version 4 UUID", u)
+		}
+	}
+	if fields[1] == fields[2] {
+		t.Errorf("uuid returned %s twice", fields[1])
+	}
+}
+
+func TestTemplateFuncsNow(t *testing.T) {
+	at := time.Date(2025, 10, 28, 10, 5, 0, 0, time.UTC)
+	now := templateFuncs(at, false)["now"].(func() time.Time)
+	if got := now(); !got.Equal(at) {
+		t.Errorf("now() = %v, want %v", got, at)
+	}
+}
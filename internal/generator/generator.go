@@ -2,12 +2,19 @@ package generator
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"text/template"
 	"time"
 
 	"github.com/example/dsl-go/internal/ast"
+	"github.com/example/dsl-go/internal/manager"
 	"github.com/example/dsl-go/internal/parse"
 	"github.com/example/dsl-go/internal/print"
 )
@@ -16,16 +23,22 @@ type GenerateResponse struct {
 	RequestID      string    `json:"request_id"`
 	DSL            string    `json:"dsl"`
 	Version        uint64    `json:"version"`
-	Hash           string    `json:"hash"`
+	Hash           string    `json:"hash"` // Content hash of DSL, as Manager.ContentHash computes it
 	GeneratedAt    time.Time `json:"generated_at"`
 	EntitiesAdded  int       `json:"entities_added"`
 	ResourcesAdded int       `json:"resources_added"`
 	FlowsGenerated int       `json:"flows_generated"`
+	Warnings       []string  `json:"warnings,omitempty"`
 }
 
 // Generator generates populated DSL instances from templates and client data
 type Generator struct {
-	parser parse.Parser
+	parser        parse.Parser
+	sanitize      func(string) string
+	productRoles  map[string]ClientRole
+	checkRendered bool
+	strictEnv     bool
+	riskScorer    func(ClientEntity) string
 }
 
 // New creates a new Generator instance
@@ -35,44 +48,146 @@ func New() (*Generator, error) {
 		return nil, err
 	}
 	return &Generator{
-		parser: parser,
+		parser:       parser,
+		sanitize:     sanitizeID,
+		productRoles: DefaultProductRoles,
 	}, nil
 }
 
+// WithIDSanitizer replaces the function used to turn entity and resource ids
+// into task-name fragments. Names that still collide are disambiguated and
+// reported in GenerateResponse.Warnings.
+func (g *Generator) WithIDSanitizer(fn func(string) string) *Generator {
+	g.sanitize = fn
+	return g
+}
+
+// WithProductRoles replaces the mapping from product type to the role of the
+// entity a product of that type requires (see DefaultProductRoles).
+func (g *Generator) WithProductRoles(roles map[string]ClientRole) *Generator {
+	g.productRoles = roles
+	return g
+}
+
+// WithRenderedCheck makes GenerateFromTemplateFile parse the DSL a template
+// renders and fail if it does not parse, rather than returning it unchecked.
+func (g *Generator) WithRenderedCheck(check bool) *Generator {
+	g.checkRendered = check
+	return g
+}
+
+// WithStrictEnv makes the env template function fail the render when the
+// environment variable it reads is not set, rather than yielding "".
+func (g *Generator) WithStrictEnv(strict bool) *Generator {
+	g.strictEnv = strict
+	return g
+}
+
+// WithRiskScorer sets a function computing the risk level of each entity,
+// e.g. from its country or role. A non-empty level is passed to the entity's
+// AML screening task as its risk-level argument.
+func (g *Generator) WithRiskScorer(fn func(ClientEntity) string) *Generator {
+	g.riskScorer = fn
+	return g
+}
+
 // Generate creates a populated DSL instance from the request
 func (g *Generator) Generate(req *GenerateRequest) (*GenerateResponse, error) {
-	if err := g.validate(req); err != nil {
+	dslRequest, warnings, err := g.build(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert to S-expression format
+	dslText := print.ToSexpr(dslRequest)
+
+	// Prepare response
+	response := g.response(req, dslRequest, warnings)
+	response.DSL = dslText
+	response.Hash = manager.RequestContentHash(dslRequest)
+
+	return response, nil
+}
+
+// GenerateFromJSON decodes a GenerateRequest, such as an HTTP request body,
+// from r, validates it and generates its DSL with a default Generator.
+func GenerateFromJSON(r io.Reader) (*GenerateResponse, error) {
+	req, err := DecodeRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	g, err := New()
+	if err != nil {
 		return nil, err
 	}
+	return g.Generate(req)
+}
+
+// DecodeRequest reads a complete GenerateRequest from r and validates it with
+// GenerateRequest.Validate. Unknown fields are ignored.
+func DecodeRequest(r io.Reader) (*GenerateRequest, error) {
+	var req GenerateRequest
+	if err := json.NewDecoder(r).Decode(&req); err != nil {
+		return nil, fmt.Errorf("failed to parse request JSON: %w", err)
+	}
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	return &req, nil
+}
+
+// GenerateTo is Generate for large requests: the DSL is written to w instead
+// of being returned, so the response carries only its Hash.
+func (g *Generator) GenerateTo(w io.Writer, req *GenerateRequest) (*GenerateResponse, error) {
+	dslRequest, warnings, err := g.build(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := print.Write(w, dslRequest); err != nil {
+		return nil, fmt.Errorf("failed to write dsl: %w", err)
+	}
+
+	response := g.response(req, dslRequest, warnings)
+	response.Hash = manager.RequestContentHash(dslRequest)
+
+	return response, nil
+}
+
+// build validates req and assembles the DSL request for it
+func (g *Generator) build(req *GenerateRequest) (*ast.Request, []string, error) {
+	if err := g.validate(req); err != nil {
+		return nil, nil, err
+	}
 
 	// Create base request structure
 	dslRequest := g.createBaseRequest(req)
 
 	// Add client entities
-	g.addEntities(dslRequest, req.Entities)
+	warnings := g.addEntities(dslRequest, req.Entities, req.DataDictionary)
 
 	// Add products as resources
-	g.addResources(dslRequest, req.Products, req.Resources)
+	if err := g.addResources(dslRequest, req); err != nil {
+		return nil, nil, err
+	}
 
 	// Generate onboarding flows
-	g.generateFlows(dslRequest)
+	warnings = append(warnings, g.generateFlows(dslRequest, req)...)
 
-	// Convert to S-expression format
-	dslText := print.ToSexpr(dslRequest)
+	return dslRequest, warnings, nil
+}
 
-	// Prepare response
-	response := &GenerateResponse{
+// response fills in the summary fields shared by Generate and GenerateTo
+func (g *Generator) response(req *GenerateRequest, dslRequest *ast.Request, warnings []string) *GenerateResponse {
+	return &GenerateResponse{
 		RequestID:      req.RequestID,
-		DSL:            dslText,
 		Version:        1,
-		Hash:           "",
 		GeneratedAt:    time.Now().UTC(),
 		EntitiesAdded:  len(req.Entities),
 		ResourcesAdded: len(req.Products) + len(req.Resources),
-		FlowsGenerated: 1, // main flow
+		FlowsGenerated: len(dslRequest.Orchestrator.Flows),
+		Warnings:       warnings,
 	}
-
-	return response, nil
 }
 
 // GenerateFromTemplate generates a DSL instance from an existing template
@@ -98,10 +213,12 @@ func (g *Generator) GenerateFromTemplate(templateDSL string, req *GenerateReques
 	dslRequest.Meta.UpdatedAt = now
 
 	// Add client entities
-	g.addEntities(dslRequest, req.Entities)
+	warnings := g.addEntities(dslRequest, req.Entities, req.DataDictionary)
 
 	// Add products and resources
-	g.addResources(dslRequest, req.Products, req.Resources)
+	if err := g.addResources(dslRequest, req); err != nil {
+		return nil, err
+	}
 
 	// Convert to S-expression format
 	dslText := print.ToSexpr(dslRequest)
@@ -114,23 +231,28 @@ func (g *Generator) GenerateFromTemplate(templateDSL string, req *GenerateReques
 		EntitiesAdded:  len(req.Entities),
 		ResourcesAdded: len(req.Products) + len(req.Resources),
 		FlowsGenerated: len(dslRequest.Orchestrator.Flows),
+		Hash:           manager.RequestContentHash(dslRequest),
+		Warnings:       warnings,
 	}
 
 	return response, nil
 }
 
+// GenerateFromTemplateFile renders the template named by the base name of
+// templatePath, from the templates directory, with req as its data. Templates
+// may call the functions of templateFuncs.
 func (g *Generator) GenerateFromTemplateFile(templatePath string, req *GenerateRequest) (*GenerateResponse, error) {
 	if err := g.validate(req); err != nil {
 		return nil, err
 	}
 
-	tmpl, err := template.ParseGlob("templates/*.sexpr")
+	req.Now = time.Now()
+
+	tmpl, err := template.New("").Funcs(templateFuncs(req.Now, g.strictEnv)).ParseGlob("templates/*.sexpr")
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse templates: %w", err)
 	}
 
-	req.Now = time.Now()
-
 	var buf bytes.Buffer
 	if err := tmpl.ExecuteTemplate(&buf, filepath.Base(templatePath), req); err != nil {
 		return nil, fmt.Errorf("failed to execute template: %w", err)
@@ -148,6 +270,15 @@ func (g *Generator) GenerateFromTemplateFile(templatePath string, req *GenerateR
 		FlowsGenerated: 1, // This is now controlled by the template
 	}
 
+	if g.checkRendered {
+		dslRequest, err := g.parser.Parse(dslText)
+		if err != nil {
+			return nil, fmt.Errorf("template %s rendered invalid dsl: %w", filepath.Base(templatePath), err)
+		}
+		response.FlowsGenerated = len(dslRequest.Orchestrator.Flows)
+		response.Hash = manager.RequestContentHash(dslRequest)
+	}
+
 	return response, nil
 }
 
@@ -159,6 +290,28 @@ func (g *Generator) validate(req *GenerateRequest) error {
 	if len(req.Entities) == 0 {
 		return &ValidationError{Field: "Entities", Message: "at least one entity required"}
 	}
+	for i, e := range req.Entities {
+		if !e.Role.Valid() {
+			return &ValidationError{Field: fmt.Sprintf("Entities[%d].Role", i), Message: fmt.Sprintf("unknown role %q (known roles: %s)", e.Role, knownRoleList())}
+		}
+	}
+	for i, stage := range req.FlowTemplate {
+		if !stage.Valid() {
+			return &ValidationError{Field: fmt.Sprintf("FlowTemplate[%d]", i), Message: fmt.Sprintf("unknown flow stage %q", stage)}
+		}
+	}
+	flowIDs := map[string]bool{"main": true}
+	for i, f := range req.Flows {
+		if f.ID == "" || flowIDs[f.ID] {
+			return &ValidationError{Field: fmt.Sprintf("Flows[%d].ID", i), Message: fmt.Sprintf("flow id %q is empty or already used", f.ID)}
+		}
+		flowIDs[f.ID] = true
+		for j, stage := range f.Stages {
+			if !stage.Valid() {
+				return &ValidationError{Field: fmt.Sprintf("Flows[%d].Stages[%d]", i, j), Message: fmt.Sprintf("unknown flow stage %q", stage)}
+			}
+		}
+	}
 	return nil
 }
 
@@ -186,8 +339,17 @@ func (g *Generator) createBaseRequest(req *GenerateRequest) *ast.Request {
 	}
 }
 
-// addEntities adds client entities to the DSL
-func (g *Generator) addEntities(dslReq *ast.Request, entities []ClientEntity) {
+// addEntities adds client entities to the DSL. Additional attributes the
+// dictionary gives a Type are coerced to it; it returns a warning for every
+// value that could not be.
+func (g *Generator) addEntities(dslReq *ast.Request, entities []ClientEntity, dict *manager.DataDictionary) []string {
+	types := map[string]string{}
+	if dict != nil {
+		for _, a := range dict.Attributes {
+			types[a.AttributeID] = a.Type
+		}
+	}
+	var warnings []string
 	for _, clientEntity := range entities {
 		attrs := []*ast.AttrVal{}
 
@@ -219,15 +381,20 @@ func (g *Generator) addEntities(dslReq *ast.Request, entities []ClientEntity) {
 			})
 		}
 
-		// Add any additional attributes
-		for key, value := range clientEntity.Attributes {
-			strVal, ok := value.(string)
-			if !ok {
+		// Add any additional scalar attributes, in key order
+		for _, key := range sortedKeys(clientEntity.Attributes) {
+			value := scalarValue(clientEntity.Attributes[key])
+			if value == nil {
 				continue
 			}
+			if coerced, ok := coerceValue(value, types[key]); ok {
+				value = coerced
+			} else {
+				warnings = append(warnings, fmt.Sprintf("entity %q: attribute %s value %s is not a valid %s; keeping it as given", clientEntity.ID, key, print.Value(value), types[key]))
+			}
 			attrs = append(attrs, &ast.AttrVal{
 				Key:        key,
-				Value:      &ast.Value{String: &strVal},
+				Value:      value,
 				Provenance: stringPtr("client-provided"),
 			})
 		}
@@ -240,21 +407,44 @@ func (g *Generator) addEntities(dslReq *ast.Request, entities []ClientEntity) {
 
 		dslReq.Orchestrator.Entities = append(dslReq.Orchestrator.Entities, entity)
 	}
+	return warnings
 }
 
-// addResources adds products and resources to the DSL
-func (g *Generator) addResources(dslReq *ast.Request, products []ProductSpec, resources []ResourceSpec) {
+// DefaultResourceIDPattern is used for product resource ids when the request
+// does not set ResourceIDPattern. Placeholders: {id} is the product id,
+// {currency} the lower-cased product currency and {entity} the sanitized id of
+// the first entity the product requires. Separators left dangling at either end by
+// an empty placeholder are trimmed.
+const DefaultResourceIDPattern = "{id}-{currency}"
+
+// resourceID expands pattern for a product bound to entityID, sanitizing the
+// entity id as for task names
+func (g *Generator) resourceID(pattern string, product ProductSpec, entityID string) string {
+	if pattern == "" {
+		pattern = DefaultResourceIDPattern
+	}
+	r := strings.NewReplacer(
+		"{id}", product.ID,
+		"{currency}", strings.ToLower(product.Currency),
+		"{entity}", g.sanitize(entityID),
+	)
+	return strings.Trim(r.Replace(pattern), "-:")
+}
+
+// addResources adds products and resources to the DSL, rejecting any
+// resulting duplicate resource id
+func (g *Generator) addResources(dslReq *ast.Request, req *GenerateRequest) error {
 	// Add products as resources
-	for _, product := range products {
+	for _, product := range req.Products {
 		requires := []*ast.RequireItem{}
-		// Products typically require at least one entity
-		if len(dslReq.Orchestrator.Entities) > 0 {
-			for _, entity := range dslReq.Orchestrator.Entities {
-				requires = append(requires, &ast.RequireItem{
-					Kind: "entity",
-					ID:   entity.ID,
-				})
-				break // Just require the first entity for now
+		var entityID string
+		for _, id := range g.productEntities(product, req.Entities) {
+			requires = append(requires, &ast.RequireItem{
+				Kind: "entity",
+				ID:   id,
+			})
+			if entityID == "" {
+				entityID = id
 			}
 		}
 
@@ -265,9 +455,10 @@ func (g *Generator) addResources(dslReq *ast.Request, products []ProductSpec, re
 				Value: &ast.Value{String: &product.Currency},
 			})
 		}
+		config = configPairs(config, product.Config)
 
 		resource := &ast.Resource{
-			ID:       product.ID,
+			ID:       g.resourceID(req.ResourceIDPattern, product, entityID),
 			Typ:      product.ProductType,
 			Requires: requires,
 			Config:   config,
@@ -277,7 +468,7 @@ func (g *Generator) addResources(dslReq *ast.Request, products []ProductSpec, re
 	}
 
 	// Add explicit resources
-	for _, resSpec := range resources {
+	for _, resSpec := range req.Resources {
 		requires := []*ast.RequireItem{}
 		for _, reqID := range resSpec.Requires {
 			requires = append(requires, &ast.RequireItem{
@@ -286,17 +477,7 @@ func (g *Generator) addResources(dslReq *ast.Request, products []ProductSpec, re
 			})
 		}
 
-		config := []*ast.KVPair{}
-		for k, v := range resSpec.Config {
-			strVal, ok := v.(string)
-			if !ok {
-				continue
-			}
-			config = append(config, &ast.KVPair{
-				Key:   k,
-				Value: &ast.Value{String: &strVal},
-			})
-		}
+		config := configPairs(nil, resSpec.Config)
 
 		resource := &ast.Resource{
 			ID:       resSpec.ID,
@@ -307,91 +488,258 @@ func (g *Generator) addResources(dslReq *ast.Request, products []ProductSpec, re
 
 		dslReq.Orchestrator.Resources = append(dslReq.Orchestrator.Resources, resource)
 	}
+
+	seen := make(map[string]bool, len(dslReq.Orchestrator.Resources))
+	for _, resource := range dslReq.Orchestrator.Resources {
+		if seen[resource.ID] {
+			return &ValidationError{Field: "Resources", Message: fmt.Sprintf("duplicate resource id %q", resource.ID)}
+		}
+		seen[resource.ID] = true
+	}
+	return nil
 }
 
-// generateFlows generates onboarding flows based on entities and products
-func (g *Generator) generateFlows(dslReq *ast.Request) {
-	steps := []*ast.Step{}
+// productEntities returns the ids of the entities product requires: the one
+// entity holding the role its type maps to, or every entity when the type is
+// unmapped or no single entity holds that role
+func (g *Generator) productEntities(product ProductSpec, entities []ClientEntity) []string {
+	var all, matched []string
+	role, mapped := g.productRoles[product.ProductType]
+	for _, e := range entities {
+		all = append(all, e.ID)
+		if mapped && e.Role == role {
+			matched = append(matched, e.ID)
+		}
+	}
+	if len(matched) == 1 {
+		return matched
+	}
+	return all
+}
 
-	// Step 1: Verify each entity
-	for _, entity := range dslReq.Orchestrator.Entities {
-		taskID := fmt.Sprintf("verify-%s", sanitizeID(entity.ID))
+// generateFlows generates the main onboarding flow from req.FlowTemplate,
+// then each of req.Flows in order, returning a warning for every id whose
+// task name had to be disambiguated.
+func (g *Generator) generateFlows(dslReq *ast.Request, req *GenerateRequest) []string {
+	entityNames := newIDNamer(g.sanitize)
+	resourceNames := newIDNamer(g.sanitize)
+	risk := g.riskLevels(req.Entities)
+	specs := append([]FlowSpec{{ID: "main", Stages: req.FlowTemplate, Parallel: req.ParallelEntityChecks}}, req.Flows...)
+	for _, spec := range specs {
+		flow := g.generateFlow(dslReq, spec, risk, entityNames, resourceNames)
+		dslReq.Orchestrator.Flows = append(dslReq.Orchestrator.Flows, flow)
+	}
+	return append(entityNames.warnings, resourceNames.warnings...)
+}
 
-		// Determine verification type based on role
-		var role string
-		for _, attr := range entity.Attrs {
-			if attr.Key == "role" {
-				role = *attr.Value.Symbol
-				break
-			}
-		}
-		verificationLevel := "standard"
-		if role == string(RoleSicav) || role == string(RoleManagementCompany) {
-			verificationLevel = "enhanced"
+// riskLevels returns the risk level the risk scorer gives each entity, by
+// entity id, leaving out empty levels. It is empty without a risk scorer.
+func (g *Generator) riskLevels(entities []ClientEntity) map[string]string {
+	risk := map[string]string{}
+	if g.riskScorer == nil {
+		return risk
+	}
+	for _, e := range entities {
+		if level := g.riskScorer(e); level != "" {
+			risk[e.ID] = level
 		}
+	}
+	return risk
+}
 
-		step := &ast.Step{
-			Task: &ast.Task{
-				ID: taskID,
-				On: "kyc-service",
-				Op: "verify-entity",
-				Args: []*ast.KVPair{
-					{Key: "entity-id", Value: &ast.Value{String: &entity.ID}},
-					{Key: "verification-level", Value: &ast.Value{String: &verificationLevel}},
+// generateFlow generates the flow spec describes from its stages, in order,
+// defaulting to DefaultFlowTemplate. With spec.Parallel set, the per-entity
+// stages become one fork branch per entity, placed where the first of them
+// appears and followed by a join. Step ids of flows other than main are
+// prefixed with the flow id so they stay unique across the request. risk holds
+// the entity risk levels from riskLevels.
+func (g *Generator) generateFlow(dslReq *ast.Request, spec FlowSpec, risk map[string]string, entityNames, resourceNames *idNamer) *ast.Flow {
+	template := spec.Stages
+	if len(template) == 0 {
+		template = DefaultFlowTemplate
+	}
+	steps := []*ast.Step{}
+	entities := dslReq.Orchestrator.Entities
+
+	forked := false
+	for _, stage := range template {
+		switch stage {
+		case StageVerify, StageAML, StageSanctions:
+			if !spec.Parallel {
+				for _, entity := range entities {
+					steps = append(steps, &ast.Step{Task: entityTask(stage, entity, risk, entityNames)})
+				}
+				continue
+			}
+			if forked {
+				continue
+			}
+			forked = true
+			steps = append(steps, entityBranches(template, entities, risk, entityNames)...)
+
+		case StageComplianceGate:
+			steps = append(steps, &ast.Step{
+				Gate: &ast.Gate{
+					ID:        "compliance-review",
+					Condition: complianceCondition(template),
 				},
-			},
+			})
+
+		case StageSetup:
+			for _, resource := range dslReq.Orchestrator.Resources {
+				taskID := fmt.Sprintf("setup-%s", resourceNames.name(resource.ID))
+				steps = append(steps, &ast.Step{
+					Task: &ast.Task{
+						ID: taskID,
+						On: resource.ID,
+						Op: g.getSetupOperation(resource.Typ),
+						Args: []*ast.KVPair{
+							{Key: "resource-id", Value: &ast.Value{String: &resource.ID}},
+						},
+					},
+				})
+			}
 		}
-		steps = append(steps, step)
 	}
 
-	// Step 2: AML screening for all entities
-	for _, entity := range dslReq.Orchestrator.Entities {
-		taskID := fmt.Sprintf("aml-check-%s", sanitizeID(entity.ID))
-		step := &ast.Step{
-			Task: &ast.Task{
-				ID: taskID,
-				On: "aml-service",
-				Op: "screen-entity",
-				Args: []*ast.KVPair{
-					{Key: "entity-id", Value: &ast.Value{String: &entity.ID}},
-				},
-			},
-		}
-		steps = append(steps, step)
+	if spec.ID != "main" {
+		prefixStepIDs(steps, spec.ID+"-")
 	}
+	return &ast.Flow{ID: spec.ID, Steps: steps}
+}
 
-	// Step 3: Compliance review gate
-	gateStep := &ast.Step{
-		Gate: &ast.Gate{
-			ID:        "compliance-review",
-			Condition: "all-kyc-complete AND all-aml-clear",
-		},
+// prefixStepIDs prepends prefix to the id of every step and to the step ids
+// and "<task-id>-done" facts the steps refer to each other by
+func prefixStepIDs(steps []*ast.Step, prefix string) {
+	prefixAll := func(ids []string) []string {
+		out := make([]string, len(ids))
+		for i, id := range ids {
+			out[i] = prefix + id
+		}
+		return out
+	}
+	for _, step := range steps {
+		switch {
+		case step.Task != nil:
+			step.Task.ID = prefix + step.Task.ID
+			step.Task.Needs = prefixAll(step.Task.Needs)
+			step.Task.Produces = prefixAll(step.Task.Produces)
+		case step.Gate != nil:
+			step.Gate.ID = prefix + step.Gate.ID
+		case step.Fork != nil:
+			step.Fork.ID = prefix + step.Fork.ID
+			step.Fork.Branches = prefixAll(step.Fork.Branches)
+		case step.Join != nil:
+			step.Join.ID = prefix + step.Join.ID
+			step.Join.After = prefixAll(step.Join.After)
+		}
 	}
-	steps = append(steps, gateStep)
+}
 
-	// Step 4: Setup products/resources
-	for _, resource := range dslReq.Orchestrator.Resources {
-		taskID := fmt.Sprintf("setup-%s", sanitizeID(resource.ID))
-		step := &ast.Step{
-			Task: &ast.Task{
-				ID: taskID,
-				On: resource.ID,
-				Op: g.getSetupOperation(resource.Typ),
-				Args: []*ast.KVPair{
-					{Key: "resource-id", Value: &ast.Value{String: &resource.ID}},
-				},
+// entityTask returns the task running a per-entity stage for entity, passing
+// the AML screening its risk level from risk when it has one
+func entityTask(stage FlowStage, entity *ast.Entity, risk map[string]string, names *idNamer) *ast.Task {
+	entityID := &ast.Value{String: &entity.ID}
+	switch stage {
+	case StageVerify:
+		verificationLevel := verificationLevel(entity)
+		return &ast.Task{
+			ID: fmt.Sprintf("verify-%s", names.name(entity.ID)),
+			On: "kyc-service",
+			Op: "verify-entity",
+			Args: []*ast.KVPair{
+				{Key: "entity-id", Value: entityID},
+				{Key: "verification-level", Value: &ast.Value{String: &verificationLevel}},
 			},
 		}
-		steps = append(steps, step)
+	case StageAML:
+		// Screen as deeply as the entity was verified
+		op := "screen-entity"
+		if verificationLevel(entity) == "enhanced" {
+			op = "screen-entity-enhanced"
+		}
+		args := []*ast.KVPair{{Key: "entity-id", Value: entityID}}
+		if level, ok := risk[entity.ID]; ok {
+			args = append(args, &ast.KVPair{Key: "risk-level", Value: &ast.Value{String: &level}})
+		}
+		return &ast.Task{
+			ID:   fmt.Sprintf("aml-check-%s", names.name(entity.ID)),
+			On:   "aml-service",
+			Op:   op,
+			Args: args,
+		}
+	default: // StageSanctions
+		return &ast.Task{
+			ID:   fmt.Sprintf("sanctions-check-%s", names.name(entity.ID)),
+			On:   "sanctions-service",
+			Op:   "screen-sanctions",
+			Args: []*ast.KVPair{{Key: "entity-id", Value: entityID}},
+		}
+	}
+}
+
+// entityBranches returns a fork with one branch per entity, the branch tasks
+// and a join waiting on the last task of every branch. Within a branch the
+// per-entity stages of template run in order: each task produces
+// "<task-id>-done" and the next one needs it.
+func entityBranches(template []FlowStage, entities []*ast.Entity, risk map[string]string, names *idNamer) []*ast.Step {
+	fork := &ast.Fork{ID: "entity-checks"}
+	join := &ast.Join{ID: "entity-checks-done"}
+	steps := []*ast.Step{{Fork: fork}}
+	for _, entity := range entities {
+		var prev *ast.Task
+		for _, stage := range template {
+			if stage != StageVerify && stage != StageAML && stage != StageSanctions {
+				continue
+			}
+			t := entityTask(stage, entity, risk, names)
+			t.Produces = []string{t.ID + "-done"}
+			if prev == nil {
+				fork.Branches = append(fork.Branches, t.ID)
+			} else {
+				t.Needs = prev.Produces
+			}
+			steps = append(steps, &ast.Step{Task: t})
+			prev = t
+		}
+		join.After = append(join.After, prev.ID)
 	}
+	return append(steps, &ast.Step{Join: join})
+}
 
-	// Create main flow
-	mainFlow := &ast.Flow{
-		ID:    "main",
-		Steps: steps,
+// complianceCondition returns the compliance gate condition covering the
+// screening stages present in template
+func complianceCondition(template []FlowStage) string {
+	var conds []string
+	for _, stage := range template {
+		switch stage {
+		case StageVerify:
+			conds = append(conds, "all-kyc-complete")
+		case StageAML:
+			conds = append(conds, "all-aml-clear")
+		case StageSanctions:
+			conds = append(conds, "all-sanctions-clear")
+		}
+	}
+	if len(conds) == 0 {
+		return "manual-approval"
 	}
+	return strings.Join(conds, " AND ")
+}
 
-	dslReq.Orchestrator.Flows = append(dslReq.Orchestrator.Flows, mainFlow)
+// verificationLevel returns the KYC rigor for an entity based on its role
+func verificationLevel(entity *ast.Entity) string {
+	var role string
+	for _, attr := range entity.Attrs {
+		if attr.Key == "role" && attr.Value != nil && attr.Value.Symbol != nil {
+			role = *attr.Value.Symbol
+			break
+		}
+	}
+	if role == string(RoleSicav) || role == string(RoleManagementCompany) {
+		return "enhanced"
+	}
+	return "standard"
 }
 
 // getSetupOperation returns the appropriate setup operation for a resource type
@@ -422,6 +770,160 @@ func sanitizeID(id string) string {
 	return result
 }
 
+// idNamer assigns task-name fragments to ids. Distinct ids that sanitize to
+// the same name get a numeric suffix, and each clash is recorded.
+type idNamer struct {
+	sanitize func(string) string
+	owner    map[string]string // name -> id that holds it
+	names    map[string]string // id -> assigned name
+	warnings []string
+}
+
+func newIDNamer(sanitize func(string) string) *idNamer {
+	return &idNamer{
+		sanitize: sanitize,
+		owner:    map[string]string{},
+		names:    map[string]string{},
+	}
+}
+
+// name returns the fragment for id, the same one on every call
+func (n *idNamer) name(id string) string {
+	if name, ok := n.names[id]; ok {
+		return name
+	}
+	base := n.sanitize(id)
+	name := base
+	for i := 2; ; i++ {
+		if _, taken := n.owner[name]; !taken {
+			break
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	if name != base {
+		n.warnings = append(n.warnings, fmt.Sprintf("id %q sanitizes to %q, already used by %q; using %q", id, base, n.owner[base], name))
+	}
+	n.owner[name] = id
+	n.names[id] = name
+	return name
+}
+
+// scalarValue converts a decoded JSON scalar into the matching value kind:
+// strings, booleans, and numbers (Int when integral, Float otherwise). It
+// returns nil for nulls, objects and arrays, which have no DSL value form.
+func scalarValue(v interface{}) *ast.Value {
+	switch v := v.(type) {
+	case string:
+		return &ast.Value{String: &v}
+	case bool:
+		return &ast.Value{Bool: &v}
+	case int:
+		i := int64(v)
+		return &ast.Value{Int: &i}
+	case int64:
+		return &ast.Value{Int: &v}
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			i := int64(v)
+			return &ast.Value{Int: &i}
+		}
+		return &ast.Value{Float: &v}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return &ast.Value{Int: &i}
+		}
+		if f, err := v.Float64(); err == nil {
+			return &ast.Value{Float: &f}
+		}
+	}
+	return nil
+}
+
+// coerceValue converts the scalar v to the dictionary type typ, reporting
+// false if it cannot. Strings are parsed as the type; integers and integral
+// floats are interchangeable; anything converts to a string. An empty or
+// unknown type leaves v as it is.
+func coerceValue(v *ast.Value, typ string) (*ast.Value, bool) {
+	text := ""
+	switch {
+	case v.String != nil:
+		text = strings.TrimSpace(*v.String)
+	case v.Int != nil:
+		text = strconv.FormatInt(*v.Int, 10)
+	case v.Float != nil:
+		text = strconv.FormatFloat(*v.Float, 'f', -1, 64)
+	case v.Bool != nil:
+		text = strconv.FormatBool(*v.Bool)
+	}
+	switch typ {
+	case "string":
+		if v.String != nil {
+			return v, true
+		}
+		return &ast.Value{String: &text}, true
+	case "integer":
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return &ast.Value{Int: &i}, true
+		}
+		if f, err := strconv.ParseFloat(text, 64); err == nil && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			i := int64(f)
+			return &ast.Value{Int: &i}, true
+		}
+		return v, false
+	case "number":
+		if v.Bool != nil {
+			return v, false
+		}
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return &ast.Value{Int: &i}, true
+		}
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return &ast.Value{Float: &f}, true
+		}
+		return v, false
+	case "bool":
+		if b, err := strconv.ParseBool(text); err == nil && (v.String != nil || v.Bool != nil) {
+			return &ast.Value{Bool: &b}, true
+		}
+		return v, false
+	}
+	return v, true
+}
+
+// configPairs appends the scalar entries of m to config in key order,
+// skipping keys config already has. Nested objects become Map values; arrays
+// are dropped.
+func configPairs(config []*ast.KVPair, m map[string]interface{}) []*ast.KVPair {
+	if config == nil {
+		config = []*ast.KVPair{}
+	}
+	have := map[string]bool{}
+	for _, kv := range config {
+		have[kv.Key] = true
+	}
+	for _, key := range sortedKeys(m) {
+		value := scalarValue(m[key])
+		if sub, ok := m[key].(map[string]interface{}); ok && len(sub) > 0 {
+			value = &ast.Value{Map: configPairs(nil, sub)}
+		}
+		if value == nil || have[key] {
+			continue
+		}
+		config = append(config, &ast.KVPair{Key: key, Value: value})
+	}
+	return config
+}
+
+// sortedKeys returns the keys of m in lexical order.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // stringPtr returns a pointer to a string
 func stringPtr(s string) *string {
 	return &s
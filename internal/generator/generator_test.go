@@ -0,0 +1,661 @@
+package generator
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/example/dsl-go/internal/ast"
+	"github.com/example/dsl-go/internal/manager"
+	"github.com/example/dsl-go/internal/print"
+)
+
+func TestAddResourcesIDs(t *testing.T) {
+	custody := func(id string) ProductSpec {
+		return ProductSpec{ID: id, ProductType: "custody", Currency: "EUR"}
+	}
+	entities := []ClientEntity{
+		{ID: "le:Fund", Role: RoleSicav},
+		{ID: "le:Bank", Role: RoleCustodian},
+	}
+	tests := []struct {
+		name     string
+		pattern  string
+		products []ProductSpec
+		sanitize func(string) string
+		want     []string
+		wantErr  string
+	}{
+		{"default pattern keeps two EUR custody products apart",
+			"", []ProductSpec{custody("custody-1"), custody("custody-2")}, nil,
+			[]string{"custody-1-eur", "custody-2-eur"}, ""},
+		{"entity placeholder",
+			"{id}:{entity}", []ProductSpec{custody("custody")}, nil,
+			[]string{"custody:le-Bank"}, ""},
+		{"entity placeholder uses the configured sanitizer",
+			"{id}:{entity}", []ProductSpec{custody("custody")}, strings.ToUpper,
+			[]string{"custody:LE:BANK"}, ""},
+		{"same product twice collides",
+			"", []ProductSpec{custody("custody"), custody("custody")}, nil,
+			nil, `duplicate resource id "custody-eur"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.sanitize != nil {
+				g.WithIDSanitizer(tt.sanitize)
+			}
+			dslReq := &ast.Request{Orchestrator: &ast.Orchestrator{}}
+			err = g.addResources(dslReq, &GenerateRequest{
+				Entities:          entities,
+				Products:          tt.products,
+				ResourceIDPattern: tt.pattern,
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range dslReq.Orchestrator.Resources {
+				got = append(got, r.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resource ids = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// generate runs Generate on req and parses the DSL it returns.
+func generate(t *testing.T, g *Generator, req *GenerateRequest) *ast.Request {
+	t.Helper()
+	resp, err := g.Generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := g.parser.Parse(resp.DSL)
+	if err != nil {
+		t.Fatalf("generated DSL does not parse: %v\n%s", err, resp.DSL)
+	}
+	return parsed
+}
+
+// tasks returns the tasks of flow id in req by task id.
+func tasks(req *ast.Request, id string) map[string]*ast.Task {
+	out := map[string]*ast.Task{}
+	for _, f := range req.Orchestrator.Flows {
+		if f.ID != id {
+			continue
+		}
+		for _, s := range f.Steps {
+			if s.Task != nil {
+				out[s.Task.ID] = s.Task
+			}
+		}
+	}
+	return out
+}
+
+func TestAMLScreeningMatchesVerificationLevel(t *testing.T) {
+	g, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := generate(t, g, &GenerateRequest{
+		RequestID: "r1",
+		Entities: []ClientEntity{
+			{ID: "le:Fund", Name: "Fund", Role: RoleSicav, EntityType: "LegalEntity"},
+			{ID: "le:ManCo", Name: "ManCo", Role: RoleManagementCompany, EntityType: "LegalEntity"},
+			{ID: "le:Bank", Name: "Bank", Role: RoleCustodian, EntityType: "LegalEntity"},
+		},
+	})
+	main := tasks(req, "main")
+	tests := []struct {
+		entity, level, op string
+	}{
+		{"le-Fund", "enhanced", "screen-entity-enhanced"},
+		{"le-ManCo", "enhanced", "screen-entity-enhanced"},
+		{"le-Bank", "standard", "screen-entity"},
+	}
+	for _, tt := range tests {
+		verify, aml := main["verify-"+tt.entity], main["aml-check-"+tt.entity]
+		if verify == nil || aml == nil {
+			t.Fatalf("missing verify or AML task for %s in %v", tt.entity, main)
+		}
+		if level := verify.Args[1].Value.String; level == nil || *level != tt.level {
+			t.Errorf("%s: verification-level = %v, want %s", tt.entity, verify.Args[1].Value, tt.level)
+		}
+		if aml.Op != tt.op {
+			t.Errorf("%s: AML op = %s, want %s", tt.entity, aml.Op, tt.op)
+		}
+	}
+}
+
+func TestCollidingEntityIDs(t *testing.T) {
+	entities := []ClientEntity{
+		{ID: "le:a/b", Name: "AB", Role: RoleCustodian, EntityType: "LegalEntity"},
+		{ID: "le:ab", Name: "Ab", Role: RoleCustodian, EntityType: "LegalEntity"},
+	}
+	tests := []struct {
+		name         string
+		sanitize     func(string) string
+		wantTasks    []string
+		wantWarnings []string
+	}{
+		{"default sanitizer", nil,
+			[]string{"verify-le-ab", "verify-le-ab-2"},
+			[]string{`id "le:ab" sanitizes to "le-ab", already used by "le:a/b"; using "le-ab-2"`}},
+		{"sanitizer mapping slashes", strings.NewReplacer(":", "-", "/", "-").Replace,
+			[]string{"verify-le-a-b", "verify-le-ab"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.sanitize != nil {
+				g.WithIDSanitizer(tt.sanitize)
+			}
+			resp, err := g.Generate(&GenerateRequest{RequestID: "r1", Entities: entities})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range tt.wantTasks {
+				if !strings.Contains(resp.DSL, `(task :id "`+id+`"`) {
+					t.Errorf("no task %s in:\n%s", id, resp.DSL)
+				}
+			}
+			if !reflect.DeepEqual(resp.Warnings, tt.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", resp.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestAttributeProvenanceSurvivesPrint(t *testing.T) {
+	g, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := generate(t, g, &GenerateRequest{
+		RequestID: "r1",
+		Entities: []ClientEntity{{
+			ID: "le:Fund", Name: "Fund", Role: RoleSicav, EntityType: "LegalEntity",
+			Country: "LU", Attributes: map[string]any{"employees": 12},
+		}},
+	})
+	want := map[string]string{
+		"name":      "client-provided",
+		"role":      "system-assigned",
+		"country":   "client-provided",
+		"employees": "client-provided",
+	}
+	got := map[string]string{}
+	for _, a := range req.Orchestrator.Entities[0].Attrs {
+		if a.Provenance == nil {
+			t.Errorf("attribute %s lost its provenance", a.Key)
+			continue
+		}
+		got[a.Key] = *a.Provenance
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("provenance = %v, want %v", got, want)
+	}
+}
+
+func TestEntityAttributeKinds(t *testing.T) {
+	g, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := generate(t, g, &GenerateRequest{
+		RequestID: "r1",
+		Entities: []ClientEntity{{
+			ID: "le:IM", Name: "IM", Role: RoleCustodian, EntityType: "LegalEntity",
+			Attributes: map[string]any{
+				"legal_form": "SARL",
+				"employees":  250,
+				"aum":        1.25e9 + 0.5,
+				"regulated":  true,
+				"skipped":    []any{"not", "scalar"},
+			},
+		}},
+	})
+	got := map[string]*ast.Value{}
+	for _, a := range req.Orchestrator.Entities[0].Attrs {
+		got[a.Key] = a.Value
+	}
+	str, i, f, b := "SARL", int64(250), 1.25e9+0.5, true
+	want := map[string]*ast.Value{
+		"legal_form": {String: &str},
+		"employees":  {Int: &i},
+		"aum":        {Float: &f},
+		"regulated":  {Bool: &b},
+	}
+	for key, w := range want {
+		if !got[key].Equal(w) {
+			t.Errorf("attribute %s = %s, want %s", key, print.Value(got[key]), print.Value(w))
+		}
+	}
+	if v, ok := got["skipped"]; ok {
+		t.Errorf("non-scalar attribute kept as %s", print.Value(v))
+	}
+}
+
+func TestProductConfigKinds(t *testing.T) {
+	g, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := generate(t, g, &GenerateRequest{
+		RequestID: "r1",
+		Entities:  []ClientEntity{{ID: "le:Bank", Name: "Bank", Role: RoleCustodian, EntityType: "LegalEntity"}},
+		Products: []ProductSpec{{
+			ID: "custody", ProductType: "custody", Currency: "EUR",
+			Config: map[string]any{
+				"account_type": "safekeeping",
+				"segregated":   true,
+				"fee_bps":      12,
+				"currency":     "USD",
+				"venues":       []any{"XETR"},
+			},
+		}},
+	})
+	var got []string
+	for _, kv := range req.Orchestrator.Resources[0].Config {
+		got = append(got, kv.Key+" "+print.Value(kv.Value))
+	}
+	want := []string{`currency "EUR"`, `account_type "safekeeping"`, "fee_bps 12", "segregated true"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("config = %q, want %q", got, want)
+	}
+}
+
+func TestGenerateHash(t *testing.T) {
+	g, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(name string) *GenerateRequest {
+		return &GenerateRequest{
+			RequestID: "r1",
+			Entities:  []ClientEntity{{ID: "le:Fund", Name: name, Role: RoleSicav, EntityType: "LegalEntity"}},
+		}
+	}
+	hash := func(req *GenerateRequest) string {
+		t.Helper()
+		resp, err := g.Generate(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := g.parser.Parse(resp.DSL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := manager.RequestContentHash(parsed); resp.Hash != want {
+			t.Errorf("Hash = %q, want the content hash of the DSL, %q", resp.Hash, want)
+		}
+		return resp.Hash
+	}
+
+	first := hash(request("Fund"))
+	if !strings.HasPrefix(first, "sha256:") {
+		t.Errorf("Hash = %q, want a sha256: hash", first)
+	}
+	if again := hash(request("Fund")); again != first {
+		t.Errorf("same input hashed to %q and %q", first, again)
+	}
+	if changed := hash(request("Other Fund")); changed == first {
+		t.Errorf("changed entity kept hash %q", first)
+	}
+}
+
+func TestParallelEntityChecks(t *testing.T) {
+	g, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := generate(t, g, &GenerateRequest{
+		RequestID: "r1",
+		Entities: []ClientEntity{
+			{ID: "le:Fund", Name: "Fund", Role: RoleSicav, EntityType: "LegalEntity"},
+			{ID: "le:Bank", Name: "Bank", Role: RoleCustodian, EntityType: "LegalEntity"},
+		},
+		ParallelEntityChecks: true,
+	})
+	var order []string
+	var fork *ast.Fork
+	var join *ast.Join
+	for _, s := range req.Orchestrator.Flows[0].Steps {
+		switch {
+		case s.Fork != nil:
+			fork = s.Fork
+			order = append(order, "fork")
+		case s.Join != nil:
+			join = s.Join
+			order = append(order, "join")
+		case s.Gate != nil:
+			order = append(order, s.Gate.ID)
+		}
+	}
+	if fork == nil || join == nil {
+		t.Fatalf("no fork and join in steps %q", order)
+	}
+	if want := []string{"verify-le-Fund", "verify-le-Bank"}; !reflect.DeepEqual(fork.Branches, want) {
+		t.Errorf("fork branches = %q, want one per entity, %q", fork.Branches, want)
+	}
+	if want := []string{"aml-check-le-Fund", "aml-check-le-Bank"}; !reflect.DeepEqual(join.After, want) {
+		t.Errorf("join after = %q, want the last task of every branch, %q", join.After, want)
+	}
+	if want := []string{"fork", "join", "compliance-review"}; len(order) < 3 || !reflect.DeepEqual(order[:3], want) {
+		t.Errorf("steps = %q, want the join before the compliance gate", order)
+	}
+	aml := tasks(req, "main")["aml-check-le-Bank"]
+	if want := []string{"verify-le-Bank-done"}; aml == nil || !reflect.DeepEqual(aml.Needs, want) {
+		t.Errorf("aml-check-le-Bank = %+v, want it to need %q", aml, want)
+	}
+}
+
+func TestProductRequiresEntityByRole(t *testing.T) {
+	fund := ClientEntity{ID: "le:Fund", Role: RoleSicav}
+	bank := ClientEntity{ID: "le:Bank", Role: RoleCustodian}
+	tests := []struct {
+		name        string
+		roles       map[string]ClientRole
+		entities    []ClientEntity
+		productType string
+		want        []string
+	}{
+		{"binds to the custodian listed second", nil,
+			[]ClientEntity{fund, bank}, "custody", []string{"le:Bank"}},
+		{"unmapped product type requires every entity", nil,
+			[]ClientEntity{fund, bank}, "brokerage", []string{"le:Fund", "le:Bank"}},
+		{"ambiguous role requires every entity", nil,
+			[]ClientEntity{fund, bank, {ID: "le:Bank2", Role: RoleCustodian}}, "custody",
+			[]string{"le:Fund", "le:Bank", "le:Bank2"}},
+		{"overridden mapping", map[string]ClientRole{"custody": RoleSicav},
+			[]ClientEntity{fund, bank}, "custody", []string{"le:Fund"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.roles != nil {
+				g.WithProductRoles(tt.roles)
+			}
+			dslReq := &ast.Request{Orchestrator: &ast.Orchestrator{}}
+			err = g.addResources(dslReq, &GenerateRequest{
+				Entities: tt.entities,
+				Products: []ProductSpec{{ID: "p", ProductType: tt.productType}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range dslReq.Orchestrator.Resources[0].Requires {
+				got = append(got, r.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("requires = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateFromJSON(t *testing.T) {
+	const body = `{
+  "request_id": "r1",
+  "entities": [{"id": "le:Bank", "name": "Bank", "role": "custodian", "entity_type": "LegalEntity"}],
+  "products": [{"id": "custody", "product_type": "custody", "currency": "EUR"}]
+}`
+	tests := []struct {
+		name    string
+		in      string
+		wantDSL string
+		wantErr string
+	}{
+		{"valid", body, `(entity :id "le:Bank" :type LegalEntity`, ""},
+		{"malformed", `{"request_id": "r1",`, "", "failed to parse request JSON"},
+		{"missing request id", strings.Replace(body, `"request_id": "r1",`, "", 1), "", "invalid request: RequestID: required"},
+		{"unknown role", strings.Replace(body, `"custodian"`, `"banker"`, 1), "", `Entities[0].Role: unknown role "banker"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := GenerateFromJSON(strings.NewReader(tt.in))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(resp.DSL, tt.wantDSL) || resp.Hash == "" {
+				t.Errorf("hash %q, DSL:\n%s\nwant a hash and DSL containing %s", resp.Hash, resp.DSL, tt.wantDSL)
+			}
+		})
+	}
+}
+
+func TestUnknownRoleRejected(t *testing.T) {
+	for role, want := range map[ClientRole]bool{
+		RoleInvestmentManager: true,
+		RoleCustodian:         true,
+		"investmnt-manager":   false,
+		"":                    false,
+	} {
+		if got := role.Valid(); got != want {
+			t.Errorf("ClientRole(%q).Valid() = %v, want %v", role, got, want)
+		}
+	}
+
+	g, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = g.Generate(&GenerateRequest{
+		RequestID: "r1",
+		Entities:  []ClientEntity{{ID: "le:IM", Name: "IM", Role: "investmnt-manager", EntityType: "LegalEntity"}},
+	})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Field != "Entities[0].Role" {
+		t.Fatalf("err = %v, want a validation error for Entities[0].Role", err)
+	}
+	if want := `unknown role "investmnt-manager" (known roles: investment-manager, `; !strings.HasPrefix(verr.Message, want) {
+		t.Errorf("message = %q, want it to start %q", verr.Message, want)
+	}
+}
+
+func TestGenerateAdditionalFlows(t *testing.T) {
+	g, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := g.Generate(&GenerateRequest{
+		RequestID: "r1",
+		Entities:  []ClientEntity{{ID: "le:Fund", Name: "Fund", Role: RoleSicav, EntityType: "LegalEntity"}},
+		Flows:     []FlowSpec{{ID: "remediation", Stages: []FlowStage{StageVerify, StageComplianceGate}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := g.parser.Parse(resp.DSL)
+	if err != nil {
+		t.Fatalf("generated DSL does not parse: %v\n%s", err, resp.DSL)
+	}
+	var ids []string
+	for _, f := range req.Orchestrator.Flows {
+		ids = append(ids, f.ID)
+	}
+	if want := []string{"main", "remediation"}; !reflect.DeepEqual(ids, want) || resp.FlowsGenerated != len(want) {
+		t.Fatalf("flows %q, FlowsGenerated %d; want %q, %d", ids, resp.FlowsGenerated, want, len(want))
+	}
+	// Step ids of the extra flow are prefixed so they stay unique.
+	if _, ok := tasks(req, "remediation")["remediation-verify-le-Fund"]; !ok {
+		t.Errorf("remediation flow lacks remediation-verify-le-Fund:\n%s", resp.DSL)
+	}
+	if _, ok := tasks(req, "main")["verify-le-Fund"]; !ok {
+		t.Errorf("main flow lacks verify-le-Fund:\n%s", resp.DSL)
+	}
+}
+
+func TestTemplateRenderedCheck(t *testing.T) {
+	const valid = `(onboarding-request
+  (:meta (request-id "{{.RequestID}}") (version 1))
+  (:orchestrator
+    (:lifecycle (states draft) (initial draft) (transitions))
+    (:entities{{range .Entities}}
+      (entity :id "{{.ID}}" :type {{.EntityType}} (attrs (name "{{.Name}}"))){{end}})
+    (:resources)
+    (:flows)))`
+	unbalanced := strings.TrimSuffix(valid, ")")
+	tests := []struct {
+		name     string
+		template string
+		check    bool
+		wantErr  string
+	}{
+		{"valid, checked", valid, true, ""},
+		{"missing paren, unchecked", unbalanced, false, ""},
+		{"missing paren, checked", unbalanced, true, `template t.sexpr rendered invalid dsl: 8:14: unexpected token "<EOF>"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := renderTemplate(t, g.WithRenderedCheck(tt.check), tt.template)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, `(entity :id "le:A" :type LegalEntity (attrs (name "A")))`) {
+				t.Errorf("rendered:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestDictionaryCoercion(t *testing.T) {
+	dict := &manager.DataDictionary{Attributes: []manager.Attribute{
+		{AttributeID: "aum", Type: "integer"},
+		{AttributeID: "rating", Type: "number"},
+		{AttributeID: "regulated", Type: "bool"},
+		{AttributeID: "reference", Type: "string"},
+		{AttributeID: "employees", Type: "integer"},
+	}}
+	g, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := g.Generate(&GenerateRequest{
+		RequestID: "r1",
+		Entities: []ClientEntity{{
+			ID: "le:IM", Name: "IM", Role: RoleInvestmentManager, EntityType: "LegalEntity",
+			Attributes: map[string]any{
+				"aum":       "5000000000",
+				"rating":    "4.5",
+				"regulated": "true",
+				"reference": 42,
+				"employees": "many",
+				"notes":     "7",
+			},
+		}},
+		DataDictionary: dict,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := g.parser.Parse(resp.DSL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, a := range req.Orchestrator.Entities[0].Attrs {
+		got[a.Key] = print.Value(a.Value)
+	}
+	want := map[string]string{
+		"aum":       "5000000000",
+		"rating":    "4.5",
+		"regulated": "true",
+		"reference": `"42"`,
+		"employees": `"many"`, // not an integer: kept as given, with a warning
+		"notes":     `"7"`,    // not in the dictionary: stays a string
+	}
+	for key, w := range want {
+		if got[key] != w {
+			t.Errorf("attribute %s = %s, want %s", key, got[key], w)
+		}
+	}
+	wantWarning := `entity "le:IM": attribute employees value "many" is not a valid integer; keeping it as given`
+	if !reflect.DeepEqual(resp.Warnings, []string{wantWarning}) {
+		t.Errorf("warnings = %q, want [%q]", resp.Warnings, wantWarning)
+	}
+}
+
+func TestRiskScorer(t *testing.T) {
+	entities := []ClientEntity{
+		{ID: "le:Fund", Name: "Fund", Role: RoleSicav, EntityType: "LegalEntity", Country: "LU"},
+		{ID: "le:Offshore", Name: "Offshore", Role: RoleSicav, EntityType: "LegalEntity", Country: "KY"},
+	}
+	highRisk := func(e ClientEntity) string {
+		if e.Country == "KY" {
+			return "enhanced"
+		}
+		return ""
+	}
+	tests := []struct {
+		name   string
+		scorer func(ClientEntity) string
+		want   map[string]string
+	}{
+		{"no scorer", nil, map[string]string{"aml-check-le-Fund": "", "aml-check-le-Offshore": ""}},
+		{"high-risk country", highRisk, map[string]string{"aml-check-le-Fund": "", "aml-check-le-Offshore": `"enhanced"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.scorer != nil {
+				g.WithRiskScorer(tt.scorer)
+			}
+			main := tasks(generate(t, g, &GenerateRequest{RequestID: "r1", Entities: entities}), "main")
+			for id, want := range tt.want {
+				task := main[id]
+				if task == nil {
+					t.Fatalf("no task %s", id)
+				}
+				got := ""
+				for _, arg := range task.Args {
+					if arg.Key == "risk-level" {
+						got = print.Value(arg.Value)
+					}
+				}
+				if got != want {
+					t.Errorf("%s risk-level = %q, want %q", id, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package generator
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// schemaRequired lists the JSON fields the generator cannot work without,
+// per type. Everything else in the schema is optional.
+var schemaRequired = map[reflect.Type][]string{
+	reflect.TypeOf(GenerateRequest{}): {"request_id", "entities"},
+	reflect.TypeOf(ClientEntity{}):    {"id", "name", "role", "entity_type"},
+	reflect.TypeOf(ProductSpec{}):     {"id", "product_type"},
+	reflect.TypeOf(ResourceSpec{}):    {"id", "type"},
+}
+
+// ScenarioJSONSchema returns a JSON Schema (draft 2020-12) describing scenario
+// files, i.e. the JSON form of GenerateRequest. It is derived from the Go
+// types by reflection so it cannot drift from what LoadScenario accepts.
+func ScenarioJSONSchema() []byte {
+	schema := typeSchema(reflect.TypeOf(GenerateRequest{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "Onboarding scenario"
+
+	b, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		// Only maps, slices and strings are marshalled here
+		panic(err)
+	}
+	return b
+}
+
+// typeSchema builds the schema fragment for t
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(ClientRole("")) {
+		roles := make([]string, 0, len(KnownRoles))
+		for _, r := range KnownRoles {
+			roles = append(roles, string(r))
+		}
+		return map[string]interface{}{"type": "string", "enum": roles}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		if t.Elem().Kind() == reflect.Interface {
+			return map[string]interface{}{"type": "object"}
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.Struct:
+		props := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "-" || !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = typeSchema(f.Type)
+		}
+		s := map[string]interface{}{"type": "object", "properties": props}
+		if req, ok := schemaRequired[t]; ok {
+			s["required"] = req
+		}
+		return s
+	}
+	// interface{} values are unconstrained
+	return map[string]interface{}{}
+}
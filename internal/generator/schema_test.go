@@ -0,0 +1,69 @@
+package generator
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestScenarioJSONSchema(t *testing.T) {
+	var schema struct {
+		Schema     string                     `json:"$schema"`
+		Required   []string                   `json:"required"`
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(ScenarioJSONSchema(), &schema); err != nil {
+		t.Fatal(err)
+	}
+	if schema.Schema != "https://json-schema.org/draft/2020-12/schema" {
+		t.Errorf("$schema = %q", schema.Schema)
+	}
+	if got := strings.Join(schema.Required, ","); got != "request_id,entities" {
+		t.Errorf("required = %s, want request_id,entities", got)
+	}
+	var props []string
+	for name := range schema.Properties {
+		props = append(props, name)
+	}
+	sort.Strings(props)
+	want := []string{"entities", "flow_template", "flows", "metadata", "parallel_entity_checks",
+		"products", "request_id", "resource_id_pattern", "resources", "tenant_id"}
+	if !reflect.DeepEqual(props, want) {
+		t.Errorf("properties = %v, want %v", props, want)
+	}
+
+	var entities struct {
+		Items struct {
+			Required   []string `json:"required"`
+			Properties struct {
+				Role struct {
+					Enum []ClientRole `json:"enum"`
+				} `json:"role"`
+			} `json:"properties"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(schema.Properties["entities"], &entities); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(entities.Items.Required, ","); got != "id,name,role,entity_type" {
+		t.Errorf("entity required = %s, want id,name,role,entity_type", got)
+	}
+	if !reflect.DeepEqual(entities.Items.Properties.Role.Enum, KnownRoles) {
+		t.Errorf("role enum = %v, want %v", entities.Items.Properties.Role.Enum, KnownRoles)
+	}
+}
+
+// TestSchemaRequiredFieldsExist keeps schemaRequired in step with the json
+// names of the types it describes.
+func TestSchemaRequiredFieldsExist(t *testing.T) {
+	for typ, required := range schemaRequired {
+		props := typeSchema(typ)["properties"].(map[string]interface{})
+		for _, name := range required {
+			if _, ok := props[name]; !ok {
+				t.Errorf("%s: required field %q is not a property", typ, name)
+			}
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package generator
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/example/dsl-go/internal/manager"
@@ -18,6 +21,62 @@ const (
 	RoleAdministrator     ClientRole = "administrator"
 )
 
+// KnownRoles lists every ClientRole the generator understands
+var KnownRoles = []ClientRole{
+	RoleInvestmentManager,
+	RoleAssetOwner,
+	RoleManagementCompany,
+	RoleSicav,
+	RoleCustodian,
+	RoleAdministrator,
+}
+
+// DefaultProductRoles maps product types to the role of the entity a product
+// of that type requires. Override it with Generator.WithProductRoles.
+var DefaultProductRoles = map[string]ClientRole{
+	"CustodySafekeeping":    RoleCustodian,
+	"custody":               RoleCustodian,
+	"investment-management": RoleInvestmentManager,
+	"FundAccounting":        RoleAdministrator,
+	"FundAdministration":    RoleAdministrator,
+	"TransferAgency":        RoleAdministrator,
+}
+
+// Valid reports whether r is one of KnownRoles
+func (r ClientRole) Valid() bool {
+	for _, known := range KnownRoles {
+		if r == known {
+			return true
+		}
+	}
+	return false
+}
+
+// knownRoleList returns KnownRoles as a comma-separated list for messages.
+func knownRoleList() string {
+	names := make([]string, len(KnownRoles))
+	for i, r := range KnownRoles {
+		names[i] = string(r)
+	}
+	return strings.Join(names, ", ")
+}
+
+// ReassignRole changes the role of every entity currently holding from to to,
+// in place, and returns how many entities changed. to must be a known role.
+func ReassignRole(entities []ClientEntity, from, to ClientRole) (int, error) {
+	if !to.Valid() {
+		return 0, &ValidationError{Field: "Role", Message: fmt.Sprintf("unknown role %q (known roles: %s)", to, knownRoleList())}
+	}
+	changed := 0
+	for i := range entities {
+		if entities[i].Role == from {
+			entities[i].Role = to
+			changed++
+		}
+	}
+	return changed, nil
+}
+
 // ClientEntity represents a legal entity being onboarded with their role
 type ClientEntity struct {
 	ID         string                 `json:"id"`          // Unique identifier (e.g., "le:ACME")
@@ -45,16 +104,66 @@ type ResourceSpec struct {
 	Config   map[string]interface{} `json:"config"`   // Resource configuration
 }
 
+// FlowStage is one stage of the generated main flow
+type FlowStage string
+
+const (
+	StageVerify         FlowStage = "verify"          // KYC-verify each entity
+	StageAML            FlowStage = "aml"             // AML-screen each entity
+	StageSanctions      FlowStage = "sanctions"       // Sanctions-screen each entity
+	StageComplianceGate FlowStage = "compliance-gate" // Wait for compliance review
+	StageSetup          FlowStage = "setup"           // Set up each resource
+)
+
+// KnownFlowStages lists every FlowStage the generator understands
+var KnownFlowStages = []FlowStage{
+	StageVerify,
+	StageAML,
+	StageSanctions,
+	StageComplianceGate,
+	StageSetup,
+}
+
+// DefaultFlowTemplate is the main flow generated when a request does not set
+// FlowTemplate
+var DefaultFlowTemplate = []FlowStage{
+	StageVerify,
+	StageAML,
+	StageComplianceGate,
+	StageSetup,
+}
+
+// Valid reports whether s is one of KnownFlowStages
+func (s FlowStage) Valid() bool {
+	for _, known := range KnownFlowStages {
+		if s == known {
+			return true
+		}
+	}
+	return false
+}
+
+// FlowSpec describes an additional named flow to generate alongside main
+type FlowSpec struct {
+	ID       string      `json:"id"`                 // Flow id; must not be "main"
+	Stages   []FlowStage `json:"stages,omitempty"`   // Stages of the flow, in order (see DefaultFlowTemplate)
+	Parallel bool        `json:"parallel,omitempty"` // Run the per-entity stages as a fork with one branch per entity
+}
+
 // GenerateRequest contains all data needed to generate a populated DSL instance
 type GenerateRequest struct {
-	RequestID      string                  `json:"request_id"` // Unique onboarding request ID
-	TenantID       string                  `json:"tenant_id"`  // Multi-tenant identifier
-	Entities       []ClientEntity          `json:"entities"`   // Client entities with their roles
-	Products       []ProductSpec           `json:"products"`   // Products being onboarded
-	Resources      []ResourceSpec          `json:"resources"`  // Resources to create
-	Metadata       map[string]interface{}  `json:"metadata"`   // Additional metadata (supports nested objects)
-	Now            time.Time               `json:"-"`          // The current time, for use in templates
-	DataDictionary *manager.DataDictionary `json:"-"`          // The data dictionary
+	RequestID            string                  `json:"request_id"`                       // Unique onboarding request ID
+	TenantID             string                  `json:"tenant_id"`                        // Multi-tenant identifier
+	Entities             []ClientEntity          `json:"entities"`                         // Client entities with their roles
+	Products             []ProductSpec           `json:"products"`                         // Products being onboarded
+	Resources            []ResourceSpec          `json:"resources"`                        // Resources to create
+	Metadata             map[string]interface{}  `json:"metadata"`                         // Additional metadata (supports nested objects)
+	ResourceIDPattern    string                  `json:"resource_id_pattern,omitempty"`    // Template for product resource ids (see DefaultResourceIDPattern)
+	FlowTemplate         []FlowStage             `json:"flow_template,omitempty"`          // Stages of the main flow, in order (see DefaultFlowTemplate)
+	ParallelEntityChecks bool                    `json:"parallel_entity_checks,omitempty"` // Run the per-entity stages as a fork with one branch per entity
+	Flows                []FlowSpec              `json:"flows,omitempty"`                  // Additional named flows generated after main, e.g. remediation
+	Now                  time.Time               `json:"-"`                                // The current time, for use in templates
+	DataDictionary       *manager.DataDictionary `json:"-"`                                // The data dictionary
 }
 
 // ValidationError represents an error during validation
@@ -67,6 +176,113 @@ func (e *ValidationError) Error() string {
 	return e.Field + ": " + e.Message
 }
 
+// Validate checks that a scenario is complete enough to generate from: a
+// request id, at least one entity, the required fields of every entity,
+// product and resource, known entity roles and flow stages, and ids unique
+// within each kind (no extra flow may be called "main"). All problems are
+// reported together.
+func (r *GenerateRequest) Validate() error {
+	var errs []error
+	fail := func(field, format string, args ...interface{}) {
+		errs = append(errs, &ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if r.RequestID == "" {
+		fail("RequestID", "required")
+	}
+	if len(r.Entities) == 0 {
+		fail("Entities", "at least one entity required")
+	}
+
+	seen := map[string]bool{}
+	for i, e := range r.Entities {
+		field := fmt.Sprintf("Entities[%d]", i)
+		switch {
+		case e.ID == "":
+			fail(field+".ID", "required")
+		case seen[e.ID]:
+			fail(field+".ID", "duplicate entity id %q", e.ID)
+		}
+		seen[e.ID] = true
+		if e.Name == "" {
+			fail(field+".Name", "required")
+		}
+		if e.EntityType == "" {
+			fail(field+".EntityType", "required")
+		}
+		if !e.Role.Valid() {
+			fail(field+".Role", "unknown role %q (known roles: %s)", e.Role, knownRoleList())
+		}
+	}
+
+	seen = map[string]bool{}
+	for i, p := range r.Products {
+		field := fmt.Sprintf("Products[%d]", i)
+		switch {
+		case p.ID == "":
+			fail(field+".ID", "required")
+		case seen[p.ID]:
+			fail(field+".ID", "duplicate product id %q", p.ID)
+		}
+		seen[p.ID] = true
+		if p.ProductType == "" {
+			fail(field+".ProductType", "required")
+		}
+	}
+
+	seen = map[string]bool{}
+	for i, res := range r.Resources {
+		field := fmt.Sprintf("Resources[%d]", i)
+		switch {
+		case res.ID == "":
+			fail(field+".ID", "required")
+		case seen[res.ID]:
+			fail(field+".ID", "duplicate resource id %q", res.ID)
+		}
+		seen[res.ID] = true
+		if res.Type == "" {
+			fail(field+".Type", "required")
+		}
+	}
+
+	seen = map[string]bool{}
+	for i, stage := range r.FlowTemplate {
+		field := fmt.Sprintf("FlowTemplate[%d]", i)
+		switch {
+		case !stage.Valid():
+			fail(field, "unknown flow stage %q", stage)
+		case seen[string(stage)]:
+			fail(field, "duplicate flow stage %q", stage)
+		}
+		seen[string(stage)] = true
+	}
+
+	flowIDs := map[string]bool{"main": true}
+	for i, f := range r.Flows {
+		field := fmt.Sprintf("Flows[%d]", i)
+		switch {
+		case f.ID == "":
+			fail(field+".ID", "required")
+		case flowIDs[f.ID]:
+			fail(field+".ID", "duplicate flow id %q", f.ID)
+		}
+		flowIDs[f.ID] = true
+		seen = map[string]bool{}
+		for j, stage := range f.Stages {
+			stageField := fmt.Sprintf("%s.Stages[%d]", field, j)
+			switch {
+			case !stage.Valid():
+				fail(stageField, "unknown flow stage %q", stage)
+			case seen[string(stage)]:
+				fail(stageField, "duplicate flow stage %q", stage)
+			}
+			seen[string(stage)] = true
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 func (r *GenerateRequest) GetProduct(id string) *manager.Product {
 	for _, p := range r.DataDictionary.Products {
 		if p.ProductID == id {
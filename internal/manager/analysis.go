@@ -0,0 +1,366 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/example/dsl-go/internal/ast"
+)
+
+// FlowsReferencingResource returns the ids of the flows in text that have a
+// task targeting resourceID, either through :on or as an argument value.
+func (m *Manager) FlowsReferencingResource(text string, resourceID string) ([]string, error) {
+	req, err := m.parser.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if req.Orchestrator == nil {
+		return nil, nil
+	}
+
+	var flows []string
+	for _, f := range req.Orchestrator.Flows {
+		for _, s := range f.Steps {
+			if s.Task != nil && taskReferences(s.Task, resourceID) {
+				flows = append(flows, f.ID)
+				break
+			}
+		}
+	}
+	return flows, nil
+}
+
+// EntitiesWithTag returns the ids of the entities in text tagged tag, in
+// document order.
+func (m *Manager) EntitiesWithTag(text string, tag string) ([]string, error) {
+	req, err := m.parser.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if req.Orchestrator == nil {
+		return nil, nil
+	}
+
+	var ids []string
+	for _, e := range req.Orchestrator.Entities {
+		for _, t := range e.Tags {
+			if t == tag {
+				ids = append(ids, e.ID)
+				break
+			}
+		}
+	}
+	return ids, nil
+}
+
+// taskReferences reports whether the task targets id or passes it as an arg.
+func taskReferences(t *ast.Task, id string) bool {
+	if t.On == id {
+		return true
+	}
+	for _, arg := range t.Args {
+		if arg.Value == nil {
+			continue
+		}
+		if (arg.Value.String != nil && *arg.Value.String == id) ||
+			(arg.Value.Symbol != nil && *arg.Value.Symbol == id) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResourceGraph renders the provisioning dependencies of text (the requires
+// links from resources to entities and other resources) in the given format.
+// Only "dot" is supported.
+func (m *Manager) ResourceGraph(text string, format string) (string, error) {
+	if format != "dot" {
+		return "", fmt.Errorf("unsupported resource graph format %q", format)
+	}
+	req, err := m.parser.Parse(text)
+	if err != nil {
+		return "", err
+	}
+	return ResourceGraphDOT(req), nil
+}
+
+// ResourceGraphDOT renders the requires relationships of req as a Graphviz
+// digraph. Entities are ellipses and resources are boxes; each edge points
+// from a resource to what it requires.
+func ResourceGraphDOT(req *ast.Request) string {
+	var b strings.Builder
+	b.WriteString("digraph resources {\n")
+	b.WriteString("  rankdir=LR;\n")
+	if req.Orchestrator != nil {
+		for _, e := range req.Orchestrator.Entities {
+			fmt.Fprintf(&b, "  %q [shape=ellipse, label=%q];\n", e.ID, e.ID+"\n"+e.Typ)
+		}
+		for _, r := range req.Orchestrator.Resources {
+			fmt.Fprintf(&b, "  %q [shape=box, label=%q];\n", r.ID, r.ID+"\n"+r.Typ)
+		}
+		for _, r := range req.Orchestrator.Resources {
+			for _, item := range r.Requires {
+				fmt.Fprintf(&b, "  %q -> %q;\n", r.ID, item.ID)
+			}
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// ComplexityReport summarises the size and shape of a request for triage.
+type ComplexityReport struct {
+	Entities     int `json:"entities"`
+	Resources    int `json:"resources"`
+	Steps        int `json:"steps"`
+	MaxFlowDepth int `json:"max_flow_depth"`
+	Gates        int `json:"gates"`
+	Forks        int `json:"forks"`
+	Joins        int `json:"joins"`
+	DistinctOps  int `json:"distinct_ops"`
+	Score        int `json:"score"`
+}
+
+// Weights of the complexity score. The score is the sum of each metric
+// multiplied by its weight; control flow and depth weigh more than volume
+// because they are what make an onboarding hard to review.
+const (
+	weightEntity     = 2
+	weightResource   = 2
+	weightStep       = 1
+	weightDepth      = 2
+	weightGate       = 3
+	weightFork       = 4
+	weightJoin       = 4
+	weightDistinctOp = 1
+)
+
+// Complexity computes a ComplexityReport for text. MaxFlowDepth is the
+// longest sequential run of steps in any flow, counting the branches of a
+// fork once since they run in parallel.
+func (m *Manager) Complexity(text string) (*ComplexityReport, error) {
+	req, err := m.parser.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return complexity(req), nil
+}
+
+func complexity(req *ast.Request) *ComplexityReport {
+	r := &ComplexityReport{}
+	if req.Orchestrator == nil {
+		return r
+	}
+	r.Entities = len(req.Orchestrator.Entities)
+	r.Resources = len(req.Orchestrator.Resources)
+
+	ops := map[string]bool{}
+	for _, f := range req.Orchestrator.Flows {
+		ids := map[string]bool{}
+		for _, s := range f.Steps {
+			switch {
+			case s.Task != nil:
+				ids[s.Task.ID] = true
+				ops[s.Task.Op] = true
+			case s.Gate != nil:
+				ids[s.Gate.ID] = true
+				r.Gates++
+			case s.Fork != nil:
+				ids[s.Fork.ID] = true
+				r.Forks++
+			case s.Join != nil:
+				ids[s.Join.ID] = true
+				r.Joins++
+			}
+		}
+		depth := len(f.Steps)
+		for _, s := range f.Steps {
+			if s.Fork == nil {
+				continue
+			}
+			parallel := 0
+			for _, b := range s.Fork.Branches {
+				if ids[b] {
+					parallel++
+				}
+			}
+			if parallel > 1 {
+				depth -= parallel - 1
+			}
+		}
+		r.Steps += len(f.Steps)
+		if depth > r.MaxFlowDepth {
+			r.MaxFlowDepth = depth
+		}
+	}
+	r.DistinctOps = len(ops)
+
+	r.Score = r.Entities*weightEntity +
+		r.Resources*weightResource +
+		r.Steps*weightStep +
+		r.MaxFlowDepth*weightDepth +
+		r.Gates*weightGate +
+		r.Forks*weightFork +
+		r.Joins*weightJoin +
+		r.DistinctOps*weightDistinctOp
+	return r
+}
+
+// StatsReport counts the parts of a request for reviewers. Entities without
+// a role attribute are counted under "(none)".
+type StatsReport struct {
+	EntitiesByRole  map[string]int `json:"entities_by_role"`
+	ResourcesByType map[string]int `json:"resources_by_type"`
+	TasksByOp       map[string]int `json:"tasks_by_op"`
+	Gates           int            `json:"gates"`
+	Forks           int            `json:"forks"`
+	Joins           int            `json:"joins"`
+	Attributes      int            `json:"attributes"`
+}
+
+// Stats computes a StatsReport for text.
+func (m *Manager) Stats(text string) (*StatsReport, error) {
+	req, err := m.parser.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return stats(req), nil
+}
+
+func stats(req *ast.Request) *StatsReport {
+	r := &StatsReport{
+		EntitiesByRole:  map[string]int{},
+		ResourcesByType: map[string]int{},
+		TasksByOp:       map[string]int{},
+	}
+	ast.Walk(req, ast.Visitor{
+		Entity: func(e *ast.Entity) bool {
+			r.EntitiesByRole[entityRole(e)]++
+			return true
+		},
+		Attr: func(*ast.Entity, *ast.AttrVal) bool {
+			r.Attributes++
+			return true
+		},
+		Resource: func(res *ast.Resource) bool {
+			r.ResourcesByType[res.Typ]++
+			return true
+		},
+		Task: func(_ *ast.Flow, t *ast.Task) bool {
+			r.TasksByOp[t.Op]++
+			return true
+		},
+		Gate: func(*ast.Flow, *ast.Gate) bool {
+			r.Gates++
+			return true
+		},
+		Fork: func(*ast.Flow, *ast.Fork) bool {
+			r.Forks++
+			return true
+		},
+		Join: func(*ast.Flow, *ast.Join) bool {
+			r.Joins++
+			return true
+		},
+	})
+	return r
+}
+
+// entityRole returns the value of the role attribute of e, or "(none)".
+func entityRole(e *ast.Entity) string {
+	for _, a := range e.Attrs {
+		if a.Key != "role" || a.Value == nil || a.SupersededAt != nil {
+			continue
+		}
+		switch {
+		case a.Value.Symbol != nil:
+			return *a.Value.Symbol
+		case a.Value.String != nil:
+			return *a.Value.String
+		}
+	}
+	return "(none)"
+}
+
+// StatsToText renders r for people: each count on its own line, the
+// breakdowns indented under their totals in key order.
+func StatsToText(r *StatsReport) string {
+	var b strings.Builder
+	breakdown := func(title string, counts map[string]int) {
+		keys := make([]string, 0, len(counts))
+		total := 0
+		for k, n := range counts {
+			keys = append(keys, k)
+			total += n
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(&b, "%s: %d\n", title, total)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "  %s: %d\n", k, counts[k])
+		}
+	}
+	breakdown("entities", r.EntitiesByRole)
+	breakdown("resources", r.ResourcesByType)
+	breakdown("tasks", r.TasksByOp)
+	fmt.Fprintf(&b, "gates: %d\n", r.Gates)
+	fmt.Fprintf(&b, "forks: %d\n", r.Forks)
+	fmt.Fprintf(&b, "joins: %d\n", r.Joins)
+	fmt.Fprintf(&b, "attributes: %d\n", r.Attributes)
+	return b.String()
+}
+
+// TerminalStates are the lifecycle states expected to have no outgoing
+// transitions, so AnalyzeLifecycle does not report them as dead ends.
+var TerminalStates = []string{"completed", "done", "onboarded", "failed", "rejected", "cancelled", "closed"}
+
+// LifecycleReport lists the problems AnalyzeLifecycle finds, each in the
+// order the states are declared.
+type LifecycleReport struct {
+	// Unreachable are declared states no chain of transitions leads to
+	// from the initial state.
+	Unreachable []string `json:"unreachable,omitempty"`
+	// DeadEnds are reachable states that no transition leaves, other than
+	// TerminalStates.
+	DeadEnds []string `json:"dead_ends,omitempty"`
+}
+
+// AnalyzeLifecycle checks that every declared state of lc can be reached
+// from its initial state and that only terminal states are dead ends. A
+// lifecycle without transitions does not model its state machine and is not
+// analyzed.
+func AnalyzeLifecycle(lc *ast.Lifecycle) LifecycleReport {
+	var r LifecycleReport
+	if lc == nil || len(lc.Transitions) == 0 {
+		return r
+	}
+	next := map[string][]string{}
+	for _, t := range lc.Transitions {
+		next[t.From] = append(next[t.From], t.To)
+	}
+	reached := map[string]bool{lc.Initial: true}
+	queue := []string{lc.Initial}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		for _, n := range next[s] {
+			if !reached[n] {
+				reached[n] = true
+				queue = append(queue, n)
+			}
+		}
+	}
+	terminal := map[string]bool{}
+	for _, s := range TerminalStates {
+		terminal[s] = true
+	}
+	for _, s := range lc.States {
+		switch {
+		case !reached[s]:
+			r.Unreachable = append(r.Unreachable, s)
+		case len(next[s]) == 0 && !terminal[s]:
+			r.DeadEnds = append(r.DeadEnds, s)
+		}
+	}
+	return r
+}
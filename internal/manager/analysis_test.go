@@ -0,0 +1,113 @@
+package manager
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/example/dsl-go/internal/ast"
+)
+
+func TestResourceGraph(t *testing.T) {
+	doc := strings.Replace(minimalDoc,
+		`(resource :id "acct" :type Account (requires (entity "le:A"))))`,
+		`(resource :id "acct" :type Account (requires (entity "le:A")))
+      (resource :id "cust" :type Custody (requires (entity "le:A") (resource "acct"))))`, 1)
+	m := newTestManager(t)
+	got, err := m.ResourceGraph(doc, "dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph resources {
+  rankdir=LR;
+  "le:A" [shape=ellipse, label="le:A\nLegalEntity"];
+  "acct" [shape=box, label="acct\nAccount"];
+  "cust" [shape=box, label="cust\nCustody"];
+  "acct" -> "le:A";
+  "cust" -> "le:A";
+  "cust" -> "acct";
+}
+`
+	if got != want {
+		t.Errorf("ResourceGraph =\n%s\nwant\n%s", got, want)
+	}
+	if _, err := m.ResourceGraph(doc, "svg"); err == nil {
+		t.Error("ResourceGraph accepted format svg")
+	}
+}
+
+func TestAnalyzeLifecycle(t *testing.T) {
+	lifecycle := func(states string, transitions ...string) *ast.Lifecycle {
+		lc := &ast.Lifecycle{States: strings.Fields(states), Initial: "draft"}
+		for _, tr := range transitions {
+			from, to, _ := strings.Cut(tr, "->")
+			lc.Transitions = append(lc.Transitions, &ast.Transition{From: from, To: to})
+		}
+		return lc
+	}
+	tests := []struct {
+		name            string
+		lc              *ast.Lifecycle
+		wantUnreachable []string
+		wantDeadEnds    []string
+	}{
+		{"linear to a terminal state",
+			lifecycle("draft review done", "draft->review", "review->done"), nil, nil},
+		{"unreachable state",
+			lifecycle("draft review archived done", "draft->review", "review->done", "archived->done"),
+			[]string{"archived"}, nil},
+		{"only reachable from an unreachable state",
+			lifecycle("draft done limbo deeper", "draft->done", "limbo->deeper", "deeper->limbo"),
+			[]string{"limbo", "deeper"}, nil},
+		{"dead end",
+			lifecycle("draft review stuck done", "draft->review", "review->stuck", "review->done"),
+			nil, []string{"stuck"}},
+		{"no transitions is not analyzed", lifecycle("draft orphan"), nil, nil},
+		{"nil lifecycle", nil, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := AnalyzeLifecycle(tt.lc)
+			if !reflect.DeepEqual(r.Unreachable, tt.wantUnreachable) || !reflect.DeepEqual(r.DeadEnds, tt.wantDeadEnds) {
+				t.Errorf("AnalyzeLifecycle = %+v, want unreachable %q, dead ends %q", r, tt.wantUnreachable, tt.wantDeadEnds)
+			}
+		})
+	}
+}
+
+func TestValidateWarnsUnreachableState(t *testing.T) {
+	doc := strings.Replace(minimalDoc, "(states draft done)", "(states draft done archived)", 1)
+	_, warnings, err := newTestManager(t).ValidateTextWithOptions(doc, ValidateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `4:5: lifecycle: state "archived" is unreachable from initial state "draft"`
+	if !reflect.DeepEqual(warnings, []string{want}) {
+		t.Errorf("warnings = %q, want [%q]", warnings, want)
+	}
+}
+
+func TestEntitiesWithTag(t *testing.T) {
+	doc := strings.Replace(minimalDoc, `(entity :id "le:A" :type LegalEntity`,
+		`(entity :id "le:B" :type Individual (tags pep) (attrs (name "B")))
+      (entity :id "le:C" :type Individual (tags low-risk) (attrs (name "C")))
+      (entity :id "le:A" :type LegalEntity (tags high-risk pep)`, 1)
+	m := newTestManager(t)
+	tests := []struct {
+		tag  string
+		want []string
+	}{
+		{"pep", []string{"le:B", "le:A"}},
+		{"high-risk", []string{"le:A"}},
+		{"sanctioned", nil},
+	}
+	for _, tt := range tests {
+		got, err := m.EntitiesWithTag(doc, tt.tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("EntitiesWithTag(%q) = %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
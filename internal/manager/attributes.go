@@ -0,0 +1,139 @@
+package manager
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/example/dsl-go/internal/ast"
+	"github.com/example/dsl-go/internal/print"
+)
+
+// AttributeOptions controls how AddEntityAttribute treats an existing value.
+type AttributeOptions struct {
+	// KeepHistory retains the previous value of the key, marked with
+	// :superseded-at, instead of overwriting it.
+	KeepHistory bool
+}
+
+// AddEntityAttribute sets key on entityID in the latest version of request id
+// and stores the result as a new version, which it returns. Setting a key to
+// the value it already has stores nothing and reports unchanged.
+func (m *Manager) AddEntityAttribute(id, entityID, key string, value *ast.Value, provenance string, opts AttributeOptions) (version uint64, unchanged bool, err error) {
+	defer m.lock(id)()
+	prev, req, err := m.latest(id)
+	if err != nil {
+		return 0, false, err
+	}
+	entity := findEntity(req, entityID)
+	if entity == nil {
+		return 0, false, fmt.Errorf("entity %s in request %s: %w", entityID, id, ErrNotFound)
+	}
+
+	now := time.Now().UTC()
+	attr := &ast.AttrVal{Key: key, Value: value}
+	if provenance != "" {
+		attr.Provenance = &provenance
+	}
+	if a, ok := ast.GetAttr(entity, key); ok {
+		if a.Value.Equal(value) && (provenance == "" || (a.Provenance != nil && *a.Provenance == provenance)) {
+			return prev, true, nil
+		}
+		if opts.KeepHistory {
+			a.SupersededAt = &now
+		}
+	}
+	if opts.KeepHistory {
+		entity.Attrs = append(entity.Attrs, attr)
+	} else {
+		ast.SetAttr(entity, key, value, attr.Provenance)
+	}
+
+	return m.putNext(id, prev, req, now)
+}
+
+// AttributeHistory returns every value key has held on entityID in the latest
+// version of request id, oldest first. Superseded values carry SupersededAt;
+// the current value, if any, is last.
+func (m *Manager) AttributeHistory(id, entityID, key string) ([]*ast.AttrVal, error) {
+	_, req, err := m.latest(id)
+	if err != nil {
+		return nil, err
+	}
+	entity := findEntity(req, entityID)
+	if entity == nil {
+		return nil, fmt.Errorf("entity %s in request %s: %w", entityID, id, ErrNotFound)
+	}
+
+	var history []*ast.AttrVal
+	for _, a := range entity.Attrs {
+		if a.Key == key {
+			history = append(history, a)
+		}
+	}
+	return history, nil
+}
+
+// AttrReport is one attribute value of an entity, for lineage audits. Value
+// is in DSL syntax; Provenance and SupersededAt are empty when not set.
+type AttrReport struct {
+	Entity       string `json:"entity"`
+	Key          string `json:"key"`
+	Value        string `json:"value"`
+	Provenance   string `json:"provenance,omitempty"`
+	SupersededAt string `json:"superseded_at,omitempty"`
+}
+
+// ExtractAttributes lists every attribute value in text, superseded values
+// included, in document order.
+func (m *Manager) ExtractAttributes(text string) ([]AttrReport, error) {
+	req, err := m.parser.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	reports := []AttrReport{}
+	ast.Walk(req, ast.Visitor{Attr: func(e *ast.Entity, a *ast.AttrVal) bool {
+		r := AttrReport{Entity: e.ID, Key: a.Key, Value: print.Value(a.Value)}
+		if a.Provenance != nil {
+			r.Provenance = *a.Provenance
+		}
+		if a.SupersededAt != nil {
+			r.SupersededAt = ast.CanonicalTime(*a.SupersededAt).Format(time.RFC3339Nano)
+		}
+		reports = append(reports, r)
+		return true
+	}})
+	return reports, nil
+}
+
+// AttributesToText renders reports as a table with a header row, "-" marking
+// a missing provenance or superseded time.
+func AttributesToText(reports []AttrReport) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ENTITY\tATTRIBUTE\tVALUE\tPROVENANCE\tSUPERSEDED")
+	dash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	for _, r := range reports {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Entity, r.Key, r.Value, dash(r.Provenance), dash(r.SupersededAt))
+	}
+	w.Flush()
+	return b.String()
+}
+
+func findEntity(req *ast.Request, id string) *ast.Entity {
+	if req.Orchestrator == nil {
+		return nil
+	}
+	for _, e := range req.Orchestrator.Entities {
+		if e.ID == id {
+			return e
+		}
+	}
+	return nil
+}
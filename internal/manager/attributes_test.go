@@ -0,0 +1,116 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/example/dsl-go/internal/ast"
+)
+
+const attributesDoc = `(onboarding-request
+  (:meta (request-id "x") (version 1))
+  (:orchestrator
+    (:lifecycle (states draft) (initial draft) (transitions))
+    (:entities
+      (entity :id "le:A" :type LegalEntity
+        (attrs
+          (name "Old" :provenance "filing" :superseded-at "2025-01-01T00:00:00.5Z")
+          (name "A" :provenance "registry")
+          (country GB)))
+      (entity :id "le:B" :type LegalEntity
+        (attrs (employees 12 :provenance "survey"))))
+    (:resources)
+    (:flows)))`
+
+func TestExtractAttributes(t *testing.T) {
+	m := newTestManager(t)
+	reports, err := m.ExtractAttributes(attributesDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []AttrReport{
+		{Entity: "le:A", Key: "name", Value: `"Old"`, Provenance: "filing", SupersededAt: "2025-01-01T00:00:00Z"},
+		{Entity: "le:A", Key: "name", Value: `"A"`, Provenance: "registry"},
+		{Entity: "le:A", Key: "country", Value: "GB"},
+		{Entity: "le:B", Key: "employees", Value: "12", Provenance: "survey"},
+	}
+	if len(reports) != len(want) {
+		t.Fatalf("got %d reports, want %d: %+v", len(reports), len(want), reports)
+	}
+	for i, w := range want {
+		if reports[i] != w {
+			t.Errorf("report %d = %+v, want %+v", i, reports[i], w)
+		}
+	}
+}
+
+func TestAttributesToText(t *testing.T) {
+	tests := []struct {
+		name    string
+		reports []AttrReport
+		want    []string
+	}{
+		{"empty", nil, []string{"ENTITY  ATTRIBUTE  VALUE  PROVENANCE  SUPERSEDED"}},
+		{"dashes for missing fields", []AttrReport{
+			{Entity: "le:A", Key: "name", Value: `"A"`, Provenance: "registry"},
+			{Entity: "le:A", Key: "country", Value: "GB"},
+		}, []string{
+			"ENTITY  ATTRIBUTE  VALUE  PROVENANCE  SUPERSEDED",
+			`le:A    name       "A"    registry    -`,
+			"le:A    country    GB     -           -",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Split(strings.TrimRight(AttributesToText(tt.reports), "\n"), "\n")
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestAddEntityAttributeKeepsMetadata(t *testing.T) {
+	doc := strings.Replace(attributesDoc, `(country GB)))`, `; ISO 3166 code
+          (country GB :needed-by (kyc-check))))`, 1)
+	tests := []struct {
+		name string
+		opts AttributeOptions
+		want []string
+	}{
+		{"overwrite", AttributeOptions{}, []string{
+			"; ISO 3166 code",
+			`(country FR :provenance "analyst" :needed-by (kyc-check))`,
+		}},
+		{"keep history", AttributeOptions{KeepHistory: true}, []string{
+			"; ISO 3166 code",
+			"(country GB :needed-by (kyc-check) :superseded-at ",
+			`(country FR :provenance "analyst")`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			if _, _, err := m.CreateRequest("r", doc); err != nil {
+				t.Fatal(err)
+			}
+			fr := "FR"
+			version, unchanged, err := m.AddEntityAttribute("r", "le:A", "country", &ast.Value{Symbol: &fr}, "analyst", tt.opts)
+			if err != nil || version != 2 || unchanged {
+				t.Fatalf("AddEntityAttribute = %d, %v, %v; want 2, false, nil", version, unchanged, err)
+			}
+			_, text, err := m.GetCurrentText("r")
+			if err != nil {
+				t.Fatal(err)
+			}
+			rest := text
+			for _, w := range tt.want {
+				i := strings.Index(rest, w)
+				if i < 0 {
+					t.Fatalf("missing %q in order in:\n%s", w, text)
+				}
+				rest = rest[i+len(w):]
+			}
+		})
+	}
+}
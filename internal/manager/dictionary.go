@@ -5,6 +5,9 @@ type Attribute struct {
 	AttributeID string `json:"AttributeID"`
 	Description string `json:"Description"`
 	VectorID    string `json:"VectorID"`
+	// Type is the kind of value the attribute holds: string, integer,
+	// number or bool. Empty means any kind.
+	Type string `json:"Type,omitempty"`
 }
 
 // Product represents a single product in the data dictionary.
@@ -16,8 +19,9 @@ type Product struct {
 
 // Service represents a single service in the data dictionary.
 type Service struct {
-	ServiceID   string `json:"ServiceID"`
-	Description string `json:"Description"`
+	ServiceID   string   `json:"ServiceID"`
+	Description string   `json:"Description"`
+	ResourceIDs []string `json:"ResourceIDs"`
 }
 
 // Resource represents a single resource in the data dictionary.
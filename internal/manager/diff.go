@@ -0,0 +1,260 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/example/dsl-go/internal/ast"
+	"github.com/example/dsl-go/internal/print"
+)
+
+// RequestDiff lists the semantic differences between two requests. Items are
+// matched by id; an item present in both with different content is listed
+// under Changed with one Change per differing field. An added item is also
+// listed under Changed, with every field it has as a Change with no Old, so
+// a diff holds everything ApplyPatch needs to recreate it.
+type RequestDiff struct {
+	Entities  ItemDiff `json:"entities"`
+	Resources ItemDiff `json:"resources"`
+	Flows     ItemDiff `json:"flows"`
+}
+
+// ItemDiff is the difference of one kind of item, ids in lexical order.
+type ItemDiff struct {
+	Added   []string      `json:"added"`
+	Removed []string      `json:"removed"`
+	Changed []ItemChanges `json:"changed"`
+}
+
+// ItemChanges holds the changed fields of the item ID.
+type ItemChanges struct {
+	ID      string   `json:"id"`
+	Changes []Change `json:"changes"`
+}
+
+// Change is one field that differs. Field is "type", "requires",
+// "attrs.<key>", "config.<key>" or "steps.<id>"; Old or New is empty when the
+// field only exists on one side. Values are in DSL syntax.
+type Change struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// Empty reports whether the two requests had no differences.
+func (d *RequestDiff) Empty() bool {
+	return d.Entities.empty() && d.Resources.empty() && d.Flows.empty()
+}
+
+func (d ItemDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Summary renders d for people: per kind, "+ id" for added, "- id" for
+// removed and "~ id" followed by "field: old -> new" lines for changed items.
+func (d *RequestDiff) Summary() string {
+	if d.Empty() {
+		return "no differences\n"
+	}
+	var b strings.Builder
+	for _, kind := range []struct {
+		name string
+		diff ItemDiff
+	}{{"entities", d.Entities}, {"resources", d.Resources}, {"flows", d.Flows}} {
+		if kind.diff.empty() {
+			continue
+		}
+		fmt.Fprintf(&b, "%s:\n", kind.name)
+		added := map[string]bool{}
+		for _, id := range kind.diff.Added {
+			added[id] = true
+			fmt.Fprintf(&b, "  + %s\n", id)
+		}
+		for _, id := range kind.diff.Removed {
+			fmt.Fprintf(&b, "  - %s\n", id)
+		}
+		for _, item := range kind.diff.Changed {
+			if added[item.ID] {
+				continue
+			}
+			fmt.Fprintf(&b, "  ~ %s\n", item.ID)
+			for _, c := range item.Changes {
+				fmt.Fprintf(&b, "      %s: %s -> %s\n", c.Field, orNone(c.Old), orNone(c.New))
+			}
+		}
+	}
+	return b.String()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+// Diff compares the entities, resources and flows of two DSL documents.
+func (m *Manager) Diff(fromText, toText string) (*RequestDiff, error) {
+	from, err := m.parser.Parse(fromText)
+	if err != nil {
+		return nil, fmt.Errorf("from: %w", err)
+	}
+	to, err := m.parser.Parse(toText)
+	if err != nil {
+		return nil, fmt.Errorf("to: %w", err)
+	}
+	return diffRequests(from, to), nil
+}
+
+func diffRequests(from, to *ast.Request) *RequestDiff {
+	return &RequestDiff{
+		Entities:  diffItems(entityFields(from), entityFields(to)),
+		Resources: diffItems(resourceFields(from), resourceFields(to)),
+		Flows:     diffItems(flowFields(from), flowFields(to)),
+	}
+}
+
+// diffItems compares two sets of items, each given as id -> field -> value.
+func diffItems(from, to map[string]map[string]string) ItemDiff {
+	d := ItemDiff{Added: []string{}, Removed: []string{}, Changed: []ItemChanges{}}
+	for _, id := range sortedIDs(to) {
+		if _, ok := from[id]; !ok {
+			d.Added = append(d.Added, id)
+		}
+	}
+	for _, id := range sortedIDs(from) {
+		if _, ok := to[id]; !ok {
+			d.Removed = append(d.Removed, id)
+		}
+	}
+	for _, id := range sortedIDs(to) {
+		fromFields, toFields := from[id], to[id]
+		var changes []Change
+		for _, field := range sortedKeys(fromFields, toFields) {
+			if fromFields[field] != toFields[field] {
+				changes = append(changes, Change{Field: field, Old: fromFields[field], New: toFields[field]})
+			}
+		}
+		if len(changes) > 0 {
+			d.Changed = append(d.Changed, ItemChanges{ID: id, Changes: changes})
+		}
+	}
+	return d
+}
+
+func sortedIDs(items map[string]map[string]string) []string {
+	ids := make([]string, 0, len(items))
+	for id := range items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// sortedKeys returns the keys of both maps, deduplicated and sorted.
+func sortedKeys(a, b map[string]string) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range []map[string]string{a, b} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// entityFields flattens each entity to its type and the current value of
+// every attribute. Superseded values are history and not compared.
+func entityFields(req *ast.Request) map[string]map[string]string {
+	items := map[string]map[string]string{}
+	if req.Orchestrator == nil {
+		return items
+	}
+	for _, e := range req.Orchestrator.Entities {
+		fields := map[string]string{"type": e.Typ}
+		if len(e.Tags) > 0 {
+			fields["tags"] = strings.Join(e.Tags, " ")
+		}
+		for _, a := range e.Attrs {
+			if !a.Superseded() {
+				fields["attrs."+a.Key] = print.Value(a.Value)
+			}
+		}
+		items[e.ID] = fields
+	}
+	return items
+}
+
+// resourceFields flattens each resource to its type, requires and config.
+func resourceFields(req *ast.Request) map[string]map[string]string {
+	items := map[string]map[string]string{}
+	if req.Orchestrator == nil {
+		return items
+	}
+	for _, r := range req.Orchestrator.Resources {
+		fields := map[string]string{"type": r.Typ}
+		var requires []string
+		for _, item := range r.Requires {
+			requires = append(requires, fmt.Sprintf("(%s %q)", item.Kind, item.ID))
+		}
+		if len(requires) > 0 {
+			fields["requires"] = strings.Join(requires, " ")
+		}
+		for _, kv := range r.Config {
+			fields["config."+kv.Key] = print.Value(kv.Value)
+		}
+		items[r.ID] = fields
+	}
+	return items
+}
+
+// flowFields flattens each flow to its doc string and its steps by id.
+func flowFields(req *ast.Request) map[string]map[string]string {
+	items := map[string]map[string]string{}
+	if req.Orchestrator == nil {
+		return items
+	}
+	for _, f := range req.Orchestrator.Flows {
+		fields := map[string]string{}
+		if f.Doc != nil {
+			fields["doc"] = fmt.Sprintf("%q", *f.Doc)
+		}
+		for _, s := range f.Steps {
+			fields["steps."+planStepID(s)] = stepText(s)
+		}
+		items[f.ID] = fields
+	}
+	return items
+}
+
+// stepText renders a step without its id, for comparison and display.
+func stepText(s *ast.Step) string {
+	switch {
+	case s.Task != nil:
+		t := s.Task
+		var args []string
+		for _, kv := range t.Args {
+			args = append(args, fmt.Sprintf("(%s %s)", kv.Key, print.Value(kv.Value)))
+		}
+		text := fmt.Sprintf("task :on %q :op %s (args %s)", t.On, t.Op, strings.Join(args, " "))
+		if len(t.Needs) > 0 {
+			text += fmt.Sprintf(" (needs %s)", strings.Join(t.Needs, " "))
+		}
+		if len(t.Produces) > 0 {
+			text += fmt.Sprintf(" (produces %s)", strings.Join(t.Produces, " "))
+		}
+		return text
+	case s.Gate != nil:
+		return fmt.Sprintf("gate (when %q)", s.Gate.Condition)
+	case s.Fork != nil:
+		return fmt.Sprintf("fork (branches %s)", strings.Join(s.Fork.Branches, " "))
+	case s.Join != nil:
+		return fmt.Sprintf("join (after %s)", strings.Join(s.Join.After, " "))
+	}
+	return ""
+}
@@ -0,0 +1,56 @@
+package manager
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name  string
+		to    string
+		want  []Change
+		lines []string
+	}{
+		{"changed value", strings.Replace(minimalDoc, "(country GB)", "(country FR)", 1),
+			[]Change{{Field: "attrs.country", Old: "GB", New: "FR"}},
+			[]string{"entities:", "  ~ le:A", "      attrs.country: GB -> FR"}},
+		{"renamed attribute", strings.Replace(minimalDoc, "(country GB)", "(jurisdiction GB)", 1),
+			[]Change{{Field: "attrs.country", Old: "GB"}, {Field: "attrs.jurisdiction", New: "GB"}},
+			[]string{"      attrs.country: GB -> (none)", "      attrs.jurisdiction: (none) -> GB"}},
+	}
+	m := newTestManager(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := m.Diff(minimalDoc, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(d.Entities.Added) != 0 || len(d.Entities.Removed) != 0 || !d.Resources.empty() || !d.Flows.empty() {
+				t.Errorf("diff = %+v, want only le:A changed", d)
+			}
+			want := []ItemChanges{{ID: "le:A", Changes: tt.want}}
+			if !reflect.DeepEqual(d.Entities.Changed, want) {
+				t.Errorf("entity changes = %+v, want %+v", d.Entities.Changed, want)
+			}
+			summary := d.Summary()
+			for _, line := range tt.lines {
+				if !strings.Contains(summary, line+"\n") {
+					t.Errorf("summary lacks %q:\n%s", line, summary)
+				}
+			}
+		})
+	}
+
+	d, err := m.Diff(minimalDoc, minimalDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Empty() || d.Summary() != "no differences\n" {
+		t.Errorf("diff of a document with itself = %+v", d)
+	}
+	if _, err := m.Diff(minimalDoc, "(onboarding-request"); err == nil || !strings.HasPrefix(err.Error(), "to: ") {
+		t.Errorf("diff against bad text: err = %v, want a to: error", err)
+	}
+}
@@ -6,26 +6,49 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/example/dsl-go/internal/ast"
 	"github.com/example/dsl-go/internal/parse"
 	"github.com/example/dsl-go/internal/print"
 	"github.com/example/dsl-go/internal/storage"
+	"github.com/example/dsl-go/internal/validate"
 )
 
 type Config struct {
 	RegistryDir string
 	DataDir     string
+	// Tenant scopes all storage to that tenant's part of the store. Empty
+	// means DefaultTenant.
+	Tenant string
+	// Store, if set, is used instead of a FileStore in DataDir.
+	Store storage.Store
 }
 
+// DefaultTenant is the tenant of a Manager whose Config names none.
+const DefaultTenant = "default"
+
+// Manager is safe for concurrent use. Operations that derive a new version
+// from the latest one hold a per-request lock, so concurrent changes to one
+// request are applied one after the other rather than overwriting each other.
+// The lock is per process; it does not guard against another process writing
+// to the same store.
 type Manager struct {
-	store          *storage.FileStore
+	// base is the unscoped store; store is base scoped to cfg.Tenant.
+	base           storage.Store
+	store          storage.Store
 	parser         parse.Parser
 	cfg            Config
 	dataDictionary *DataDictionary
+	// locks maps tenant and request id to a *sync.Mutex. Tenant managers
+	// share it.
+	locks *sync.Map
 }
 
 func New(cfg Config) (*Manager, error) {
@@ -33,10 +56,30 @@ func New(cfg Config) (*Manager, error) {
 	if err != nil {
 		return nil, err
 	}
+	base := cfg.Store
+	if base == nil {
+		// Index versions by the hash CreateRequest and UpdateRequest return.
+		base = storage.NewFileStore(cfg.DataDir).WithHasher(func(text string) string {
+			req, err := parser.Parse(text)
+			if err != nil {
+				return storage.TextHash(text)
+			}
+			return requestHash(req)
+		})
+	}
+	if cfg.Tenant == "" {
+		cfg.Tenant = DefaultTenant
+	}
+	store, err := base.ForTenant(cfg.Tenant)
+	if err != nil {
+		return nil, err
+	}
 	m := &Manager{
-		store:  storage.NewFileStore(cfg.DataDir),
+		base:   base,
+		store:  store,
 		parser: parser,
 		cfg:    cfg,
+		locks:  &sync.Map{},
 	}
 	if err := m.LoadDataDictionary(); err != nil {
 		// For now, we'll just log the error. In a real application, you might want to handle this more gracefully.
@@ -45,6 +88,61 @@ func New(cfg Config) (*Manager, error) {
 	return m, nil
 }
 
+// Close releases the store, flushing any writes a buffered store holds back.
+// Callers should defer it on the Manager returned by New. Managers from
+// ForTenant share that store, so closing one of them closes it for all. The
+// store is closed only if it implements io.Closer.
+func (m *Manager) Close() error {
+	if c, ok := m.base.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// lock locks request id for a read-modify-write of its versions and returns
+// the unlock function.
+func (m *Manager) lock(id string) func() {
+	l, _ := m.locks.LoadOrStore(m.cfg.Tenant+"/"+id, &sync.Mutex{})
+	mu := l.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// ForTenant returns a Manager sharing m's parser and data dictionary whose
+// storage is scoped to tenant, so requests of different tenants never collide.
+// An empty tenant is DefaultTenant.
+func (m *Manager) ForTenant(tenant string) (*Manager, error) {
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+	store, err := m.base.ForTenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+	t := *m
+	t.store = store
+	t.cfg.Tenant = tenant
+	return &t, nil
+}
+
+// CreateRequestForTenant is CreateRequest within tenant's storage.
+func (m *Manager) CreateRequestForTenant(tenant, id, template string) (version uint64, canonicalHash string, err error) {
+	t, err := m.ForTenant(tenant)
+	if err != nil {
+		return 0, "", err
+	}
+	return t.CreateRequest(id, template)
+}
+
+// GetCurrentTextForTenant is GetCurrentText within tenant's storage.
+func (m *Manager) GetCurrentTextForTenant(tenant, id string) (version uint64, text string, err error) {
+	t, err := m.ForTenant(tenant)
+	if err != nil {
+		return 0, "", err
+	}
+	return t.GetCurrentText(id)
+}
+
 func (m *Manager) LoadDataDictionary() error {
 	path := filepath.Join(m.cfg.RegistryDir, "data-dictionary.json")
 	data, err := os.ReadFile(path)
@@ -67,6 +165,9 @@ func (m *Manager) GetDataDictionary() *DataDictionary {
 }
 
 func (m *Manager) GetAttribute(id string) (Attribute, bool) {
+	if m.dataDictionary == nil {
+		return Attribute{}, false
+	}
 	for _, attr := range m.dataDictionary.Attributes {
 		if attr.AttributeID == id {
 			return attr, true
@@ -75,17 +176,91 @@ func (m *Manager) GetAttribute(id string) (Attribute, bool) {
 	return Attribute{}, false
 }
 
+// GetProduct returns the data dictionary entry of product id.
+func (m *Manager) GetProduct(id string) (Product, bool) {
+	if m.dataDictionary == nil {
+		return Product{}, false
+	}
+	for _, p := range m.dataDictionary.Products {
+		if p.ProductID == id {
+			return p, true
+		}
+	}
+	return Product{}, false
+}
+
+// GetService returns the data dictionary entry of service id.
+func (m *Manager) GetService(id string) (Service, bool) {
+	if m.dataDictionary == nil {
+		return Service{}, false
+	}
+	for _, s := range m.dataDictionary.Services {
+		if s.ServiceID == id {
+			return s, true
+		}
+	}
+	return Service{}, false
+}
+
+// GetResource returns the data dictionary entry of resource id.
+func (m *Manager) GetResource(id string) (Resource, bool) {
+	if m.dataDictionary == nil {
+		return Resource{}, false
+	}
+	for _, r := range m.dataDictionary.Resources {
+		if r.ResourceID == id {
+			return r, true
+		}
+	}
+	return Resource{}, false
+}
+
+// CreateOptions tunes how CreateRequestWithOptions treats an id that is
+// already stored.
+type CreateOptions struct {
+	// Idempotent makes a repeated create of the same document, comments
+	// included but layout aside, return the stored version and hash instead
+	// of ErrAlreadyExists.
+	Idempotent bool
+}
+
 func (m *Manager) CreateRequest(id string, template string) (version uint64, canonicalHash string, err error) {
+	return m.CreateRequestWithOptions(id, template, CreateOptions{})
+}
+
+func (m *Manager) CreateRequestWithOptions(id string, template string, opts CreateOptions) (version uint64, canonicalHash string, err error) {
+	if err := checkID(id); err != nil {
+		return 0, "", err
+	}
 	req, err := m.parser.Parse(template) // strict
 	if err != nil {
 		return 0, "", err
 	}
-
-	now := time.Now().UTC()
 	if req.Meta == nil {
 		req.Meta = &ast.Meta{}
 	}
 	req.Meta.RequestID = id
+
+	defer m.lock(id)()
+	prevVersion, prevText, err := m.store.GetLatest(id)
+	switch {
+	case err == nil:
+		if !opts.Idempotent {
+			return 0, "", fmt.Errorf("request %s: %w", id, ErrAlreadyExists)
+		}
+		prev, err := m.parser.Parse(prevText)
+		if err != nil {
+			return 0, "", fmt.Errorf("failed to parse stored request %s: %w", id, err)
+		}
+		if versionText(prev) != versionText(req) {
+			return 0, "", fmt.Errorf("request %s exists with different content: %w", id, ErrAlreadyExists)
+		}
+		return prevVersion, requestHash(prev), nil
+	case !errors.Is(err, fs.ErrNotExist):
+		return 0, "", fmt.Errorf("failed to read existing request: %w", err)
+	}
+
+	now := time.Now().UTC()
 	req.Meta.Version = 1
 	if req.Meta.CreatedAt.IsZero() {
 		req.Meta.CreatedAt = now
@@ -96,25 +271,404 @@ func (m *Manager) CreateRequest(id string, template string) (version uint64, can
 	if err := m.store.Put(id, 1, txt); err != nil {
 		return 0, "", fmt.Errorf("failed to store request: %w", err)
 	}
-	return 1, hash(txt), nil
+	return 1, requestHash(req), nil
+}
+
+// UpdateRequest stores template as the next version of the existing request
+// id, keeping its original creation time. It returns ErrNotFound if id has
+// never been created. If template differs from the latest version only in
+// layout or meta version and timestamps, no new version is written and the latest version and hash are returned with
+// unchanged set.
+func (m *Manager) UpdateRequest(id string, template string) (version uint64, canonicalHash string, unchanged bool, err error) {
+	if err := checkID(id); err != nil {
+		return 0, "", false, err
+	}
+	req, err := m.parser.Parse(template) // strict
+	if err != nil {
+		return 0, "", false, err
+	}
+	defer m.lock(id)()
+	prev, prevReq, err := m.latest(id)
+	if err != nil {
+		return 0, "", false, err
+	}
+	if req.Meta == nil {
+		req.Meta = &ast.Meta{}
+	}
+	req.Meta.RequestID = id
+	req.Meta.CreatedAt = prevReq.Meta.CreatedAt
+
+	version, unchanged, err = m.putNext(id, prev, req, time.Now().UTC())
+	if err != nil {
+		return 0, "", false, err
+	}
+	txt, err := m.store.Get(id, version)
+	if err != nil {
+		return 0, "", false, fmt.Errorf("failed to read version %d of %s: %w", version, id, err)
+	}
+	stored, err := m.parser.Parse(txt)
+	if err != nil {
+		return 0, "", false, fmt.Errorf("failed to parse stored request %s: %w", id, err)
+	}
+	return version, requestHash(stored), unchanged, nil
+}
+
+// ContentHash hashes the substance of text: it is canonicalized with the meta
+// version and timestamps cleared, so two versions that differ only in those
+// fields share a content hash. The hash returned by CreateRequest still
+// covers the whole document.
+func (m *Manager) ContentHash(text string) (string, error) {
+	req, err := m.parser.Parse(text)
+	if err != nil {
+		return "", err
+	}
+	return RequestContentHash(req), nil
+}
+
+// Format returns text re-printed in the canonical layout of print.ToSexpr,
+// keeping the order of everything and its comments. Formatting the result
+// again returns it unchanged.
+func (m *Manager) Format(text string) (string, error) {
+	req, err := m.parser.Parse(text)
+	if err != nil {
+		return "", err
+	}
+	return print.ToSexpr(req), nil
+}
+
+// FormatCompact returns text re-printed on one line by
+// print.ToSexprCompact, without its comments.
+func (m *Manager) FormatCompact(text string) (string, error) {
+	req, err := m.parser.Parse(text)
+	if err != nil {
+		return "", err
+	}
+	return print.ToSexprCompact(req) + "\n", nil
+}
+
+// Redact returns text re-printed by print.ToSexprRedacted, with the values
+// of the attributes named in piiKeys or marked :pii true in its catalog
+// replaced.
+func (m *Manager) Redact(text string, piiKeys []string) (string, error) {
+	req, err := m.parser.Parse(text)
+	if err != nil {
+		return "", err
+	}
+	keys := map[string]bool{}
+	for _, k := range piiKeys {
+		keys[k] = true
+	}
+	return print.ToSexprRedacted(req, keys), nil
+}
+
+// Verify reports whether text is already in the canonical layout of Format.
+// If it is not, it returns a unified diff from text, under the name name, to
+// the formatted text.
+func (m *Manager) Verify(name, text string) (diff string, err error) {
+	formatted, err := m.Format(text)
+	if err != nil {
+		return "", err
+	}
+	return unifiedDiff(name, name+" (formatted)", text, formatted), nil
+}
+
+// RequestContentHash is ContentHash for an already parsed request.
+func RequestContentHash(req *ast.Request) string {
+	return hash(contentText(req))
 }
 
 func (m *Manager) GetCurrentText(id string) (version uint64, text string, err error) {
+	if err := checkID(id); err != nil {
+		return 0, "", err
+	}
 	return m.store.GetLatest(id)
 }
 
+// GetByHash returns the request id, version and text of the stored version
+// whose hash, as CreateRequest and UpdateRequest return it, is hash. It
+// returns ErrNotFound if no version has that hash or the store keeps no hash
+// index.
+func (m *Manager) GetByHash(hash string) (id string, version uint64, text string, err error) {
+	idx, ok := m.store.(interface {
+		GetByHash(hash string) (string, uint64, string, error)
+	})
+	if !ok {
+		return "", 0, "", fmt.Errorf("hash %s: %w", hash, ErrNotFound)
+	}
+	id, version, text, err = idx.GetByHash(hash)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", 0, "", fmt.Errorf("hash %s: %w", hash, ErrNotFound)
+	}
+	return id, version, text, err
+}
+
+// GetVersion returns the text of the given stored version of request id, or
+// ErrNotFound if that version was never written.
+func (m *Manager) GetVersion(id string, version uint64) (string, error) {
+	if err := checkID(id); err != nil {
+		return "", err
+	}
+	text, err := m.store.Get(id, version)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("request %s version %d: %w", id, version, ErrNotFound)
+	} else if err != nil {
+		return "", err
+	}
+	return text, nil
+}
+
+// History returns the stored versions of request id in ascending order, or
+// ErrNotFound if id has never been created.
+func (m *Manager) History(id string) ([]uint64, error) {
+	if err := checkID(id); err != nil {
+		return nil, err
+	}
+	versions, err := m.store.Versions(id)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && len(versions) == 0) {
+		return nil, fmt.Errorf("request %s: %w", id, ErrNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// Rollback stores the content of version toVersion of request id as a new
+// latest version, keeping every version in between. It returns ErrNotFound if
+// toVersion was never written. If the latest version already has that
+// content, nothing is written and the latest version is returned.
+func (m *Manager) Rollback(id string, toVersion uint64) (newVersion uint64, err error) {
+	text, err := m.GetVersion(id, toVersion)
+	if err != nil {
+		return 0, err
+	}
+	req, err := m.parser.Parse(text)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse stored request %s: %w", id, err)
+	}
+	defer m.lock(id)()
+	latest, err := m.store.LatestVersion(id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read latest version of %s: %w", id, err)
+	}
+	newVersion, _, err = m.putNext(id, latest, req, time.Now().UTC())
+	return newVersion, err
+}
+
+// RequestInfo identifies a stored request and its latest version. UpdatedAt
+// is only filled in by ListRequestsSince.
+type RequestInfo struct {
+	ID        string    `json:"id"`
+	Latest    uint64    `json:"latest"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ListRequests returns every stored request with its latest version, ordered
+// by id.
+func (m *Manager) ListRequests() ([]RequestInfo, error) {
+	ids, err := m.store.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list requests: %w", err)
+	}
+	infos := make([]RequestInfo, 0, len(ids))
+	for _, id := range ids {
+		v, err := m.store.LatestVersion(id)
+		if err != nil {
+			continue // removed or rewritten since List
+		}
+		infos = append(infos, RequestInfo{ID: id, Latest: v})
+	}
+	return infos, nil
+}
+
+// ListRequestsSince returns the stored requests whose latest version was
+// updated at or after since, most recently updated first. A request that was
+// never updated counts as updated when it was created. Each latest version is
+// read and parsed once.
+func (m *Manager) ListRequestsSince(since time.Time) ([]RequestInfo, error) {
+	ids, err := m.store.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list requests: %w", err)
+	}
+	var infos []RequestInfo
+	for _, id := range ids {
+		v, req, err := m.latest(id)
+		if errors.Is(err, ErrNotFound) {
+			continue // removed since List
+		} else if err != nil {
+			return nil, err
+		}
+		var updated time.Time
+		if req.Meta != nil {
+			updated = req.Meta.UpdatedAt
+			if updated.IsZero() {
+				updated = req.Meta.CreatedAt
+			}
+		}
+		if updated.Before(since) {
+			continue
+		}
+		infos = append(infos, RequestInfo{ID: id, Latest: v, UpdatedAt: updated})
+	}
+	sort.SliceStable(infos, func(i, j int) bool { return infos[i].UpdatedAt.After(infos[j].UpdatedAt) })
+	return infos, nil
+}
+
+// latest loads and parses the latest stored version of request id.
+func (m *Manager) latest(id string) (uint64, *ast.Request, error) {
+	if err := checkID(id); err != nil {
+		return 0, nil, err
+	}
+	version, text, err := m.store.GetLatest(id)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil, fmt.Errorf("request %s: %w", id, ErrNotFound)
+	} else if err != nil {
+		return 0, nil, err
+	}
+	req, err := m.parser.Parse(text)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to parse stored request %s: %w", id, err)
+	}
+	return version, req, nil
+}
+
+// putNext stores req as the version after prev, stamping its meta. If req
+// prints the same as the stored prev (see versionText), nothing is written and prev is returned with unchanged set, so redundant versions are
+// never created.
+func (m *Manager) putNext(id string, prev uint64, req *ast.Request, now time.Time) (version uint64, unchanged bool, err error) {
+	if req.Meta == nil {
+		req.Meta = &ast.Meta{RequestID: id}
+	}
+	prevText, err := m.store.Get(id, prev)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read version %d of %s: %w", prev, id, err)
+	}
+	prevReq, err := m.parser.Parse(prevText)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to parse stored request %s: %w", id, err)
+	}
+	if versionText(prevReq) == versionText(req) {
+		return prev, true, nil
+	}
+
+	req.Meta.Version = prev + 1
+	req.Meta.UpdatedAt = now
+	if err := m.store.Put(id, prev+1, print.ToSexpr(req)); err != nil {
+		return 0, false, fmt.Errorf("failed to store request: %w", err)
+	}
+	return prev + 1, false, nil
+}
+
 func (m *Manager) ValidateText(text string) (issues []string, err error) {
-	_, err = m.parser.Parse(text)
+	issues, _, err = m.ValidateTextWithOptions(text, ValidateOptions{})
+	return issues, err
+}
+
+// ValidateOptions enables the optional checks of ValidateTextWithOptions.
+type ValidateOptions struct {
+	// Dictionary checks entity attribute keys against the AttributeIDs of
+	// the loaded data dictionary. Unknown keys are warnings.
+	Dictionary bool
+	// Strict reports unknown attribute keys as issues instead of warnings.
+	Strict bool
+}
+
+// ValidateTextWithOptions is ValidateText with the optional checks of opts.
+// Warnings describe problems that do not make text invalid.
+func (m *Manager) ValidateTextWithOptions(text string, opts ValidateOptions) (issues, warnings []string, err error) {
+	req, err := m.parser.Parse(text)
+	if err != nil {
+		return []string{err.Error()}, nil, nil
+	}
+	for _, issue := range validate.Duplicates(req) {
+		issues = append(issues, issue.String())
+	}
+	for _, issue := range validate.Lifecycle(req) {
+		issues = append(issues, issue.String())
+	}
+	for _, issue := range validate.Steps(req) {
+		issues = append(issues, issue.String())
+	}
+	for _, issue := range validate.Conditions(req) {
+		issues = append(issues, issue.String())
+	}
+	for _, issue := range validate.Reachability(req) {
+		issues = append(issues, issue.String())
+	}
+	for _, issue := range validate.Catalog(req) {
+		issues = append(issues, issue.String())
+	}
+	for _, issue := range validate.References(req) {
+		issues = append(issues, issue.String())
+	}
+	for _, issue := range validate.OrphanResources(req) {
+		warnings = append(warnings, issue.String())
+	}
+	if req.Orchestrator != nil && req.Orchestrator.Lifecycle != nil {
+		lc := req.Orchestrator.Lifecycle
+		report := AnalyzeLifecycle(lc)
+		for _, st := range report.Unreachable {
+			warnings = append(warnings, validate.Issue{Pos: lc.Pos, Message: fmt.Sprintf("lifecycle: state %q is unreachable from initial state %q", st, lc.Initial)}.String())
+		}
+		for _, st := range report.DeadEnds {
+			warnings = append(warnings, validate.Issue{Pos: lc.Pos, Message: fmt.Sprintf("lifecycle: no transition leaves non-terminal state %q", st)}.String())
+		}
+	}
+	if opts.Dictionary {
+		if m.dataDictionary == nil {
+			return nil, nil, errors.New("no data dictionary loaded")
+		}
+		known := map[string]bool{}
+		for _, a := range m.dataDictionary.Attributes {
+			known[a.AttributeID] = true
+		}
+		for _, issue := range validate.Dictionary(req, known) {
+			if opts.Strict {
+				issues = append(issues, issue.String())
+			} else {
+				warnings = append(warnings, issue.String())
+			}
+		}
+	}
+	return issues, warnings, nil
+}
+
+// ValidateTextDetailed is ValidateText for authoring tools: a syntax error is
+// returned as a *parse.ParseError carrying the position, the offending token
+// and the tokens that were expected there. It returns nil for valid text.
+func (m *Manager) ValidateTextDetailed(text string) (*parse.ParseError, error) {
+	_, err := m.parser.Parse(text)
+	if err == nil {
+		return nil, nil
+	}
+	var perr *parse.ParseError
+	if errors.As(err, &perr) {
+		return perr, nil
+	}
+	return nil, err
+}
+
+// ValidateMulti reports as many structural problems as it can find in one
+// pass. It checks the generic S-expression tree rather than the strict AST, so
+// it keeps going past the first error; only unbalanced parentheses or lexical
+// errors stop it early.
+func (m *Manager) ValidateMulti(text string) []validate.Issue {
+	root, err := parse.ParseRaw(text)
 	if err != nil {
-		return []string{err.Error()}, nil
+		var perr *parse.ParseError
+		if errors.As(err, &perr) {
+			return []validate.Issue{{Pos: perr.Position, Message: perr.Message}}
+		}
+		return []validate.Issue{{Message: err.Error()}}
 	}
-	return nil, nil
+	return validate.Structure(root)
 }
 
-// Compile/Plan/Delta are stubs (parity with Rust baseline)
+// Plan is an ordered list of executable steps; PlanHash identifies it.
+// Diagnostics name the steps that can never run.
 type Plan struct {
-	Steps    []PlanStep `json:"steps"`
-	PlanHash string     `json:"plan_hash"`
+	Steps       []PlanStep `json:"steps"`
+	PlanHash    string     `json:"plan_hash"`
+	Diagnostics []string   `json:"diagnostics,omitempty"`
 }
 type PlanStep struct {
 	ID     string      `json:"id"`
@@ -123,30 +677,78 @@ type PlanStep struct {
 	After  []string    `json:"after"`
 }
 
+// CompilePlan compiles the flows of text into an execution plan; see
+// compilePlan for how steps are ordered.
 func (m *Manager) CompilePlan(text string) (*Plan, error) {
-	_, err := m.parser.Parse(text)
+	req, err := m.parser.Parse(text)
 	if err != nil {
 		return nil, err
 	}
-	return &Plan{Steps: []PlanStep{}, PlanHash: "todo"}, nil
+	return compilePlan(req)
 }
 
+// PlanDelta lists the differences between two plans, matching steps by id.
+// Added and Changed are in the order of the new plan, Removed in the order
+// of the old one.
 type PlanDelta struct {
 	Added   []PlanStep    `json:"added"`
 	Removed []PlanStep    `json:"removed"`
-	Changed [][2]PlanStep `json:"changed"`
+	Changed []ChangedStep `json:"changed"`
 }
 
+// ChangedStep is a step in both plans that differs. Changes has one entry
+// per differing field, "action", "inputs" or "after", with the old and new
+// values as PlanToText shows them.
+type ChangedStep struct {
+	ID      string   `json:"id"`
+	Changes []Change `json:"changes"`
+}
+
+// PlanDelta compiles the plans of two DSL documents and compares them.
 func (m *Manager) PlanDelta(fromText, toText string) (*PlanDelta, error) {
-	_, err := m.parser.Parse(fromText)
+	from, err := m.CompilePlan(fromText)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("from: %w", err)
 	}
-	_, err = m.parser.Parse(toText)
+	to, err := m.CompilePlan(toText)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("to: %w", err)
+	}
+	return planDelta(from, to), nil
+}
+
+// contentText prints req canonically with the volatile meta fields (version
+// and timestamps) cleared, so two requests can be compared on substance alone.
+func contentText(req *ast.Request) string {
+	return print.ToCanonicalSexpr(withoutVolatileMeta(req))
+}
+
+// versionText prints req as it would be stored, comments and order included,
+// with the volatile meta fields cleared. Requests with equal versionText are
+// the same version: storing one after the other would change nothing but
+// its stamps.
+func versionText(req *ast.Request) string {
+	return print.ToSexpr(withoutVolatileMeta(req))
+}
+
+// withoutVolatileMeta returns a shallow copy of req with the meta version
+// and timestamps cleared.
+func withoutVolatileMeta(req *ast.Request) *ast.Request {
+	if req.Meta == nil {
+		return req
 	}
-	return &PlanDelta{Added: nil, Removed: nil, Changed: nil}, nil
+	meta := *req.Meta
+	meta.Version = 0
+	meta.CreatedAt, meta.UpdatedAt = time.Time{}, time.Time{}
+	cp := *req
+	cp.Meta = &meta
+	return &cp
+}
+
+// requestHash hashes the canonical form of req, which does not depend on the
+// order entities, resources, attributes or config pairs were written in.
+func requestHash(req *ast.Request) string {
+	return hash(print.ToCanonicalSexpr(req))
 }
 
 func hash(s string) string {
@@ -154,7 +756,19 @@ func hash(s string) string {
 	return "sha256:" + hex.EncodeToString(h[:])
 }
 
-var ErrNotFound = errors.New("not found")
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+)
+
+// checkID rejects request ids that could escape the store's directory, such
+// as "../other/x" (see storage.ValidRequestID).
+func checkID(id string) error {
+	if !storage.ValidRequestID(id) {
+		return fmt.Errorf("%w %q", storage.ErrInvalidID, id)
+	}
+	return nil
+}
 
 // expose AST type to CLI (for ast-json)
 type Request = ast.Request
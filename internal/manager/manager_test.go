@@ -0,0 +1,647 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/example/dsl-go/internal/storage"
+)
+
+const minimalDoc = `(onboarding-request
+  (:meta (request-id "x") (version 1))
+  (:orchestrator
+    (:lifecycle (states draft done) (initial draft) (transitions (-> draft done)))
+    (:entities
+      (entity :id "le:A" :type LegalEntity
+        (attrs (name "A" :provenance "registry") (country GB))))
+    (:resources
+      (resource :id "acct" :type Account (requires (entity "le:A"))))
+    (:flows
+      (flow :id "main"
+        (steps (task :id "open" :on "acct" :op open-account (args)))))))
+`
+
+// newTestManager returns a manager over a fresh in-memory store.
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	m, err := New(Config{Store: storage.NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestEmptyTenantIsDefaultTenant(t *testing.T) {
+	store := storage.NewMemStore()
+	m, err := New(Config{Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.CreateRequest("r", minimalDoc); err != nil {
+		t.Fatal(err)
+	}
+	explicit, err := New(Config{Store: store, Tenant: DefaultTenant})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := explicit.GetCurrentText("r"); err != nil {
+		t.Errorf("request missing from tenant %q: %v", DefaultTenant, err)
+	}
+	if _, err := store.LatestVersion("r"); err == nil {
+		t.Error("request stored outside any tenant")
+	}
+	other, err := m.ForTenant("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := other.GetCurrentText("r"); err == nil {
+		t.Error("request visible to another tenant")
+	}
+}
+
+func TestRejectsEscapingRequestIDs(t *testing.T) {
+	m := newTestManager(t)
+	if _, _, err := m.CreateRequest("ok", minimalDoc); err != nil {
+		t.Fatal(err)
+	}
+	calls := []struct {
+		name string
+		call func(id string) error
+	}{
+		{"CreateRequest", func(id string) error { _, _, err := m.CreateRequest(id, minimalDoc); return err }},
+		{"UpdateRequest", func(id string) error { _, _, _, err := m.UpdateRequest(id, minimalDoc); return err }},
+		{"GetCurrentText", func(id string) error { _, _, err := m.GetCurrentText(id); return err }},
+		{"GetVersion", func(id string) error { _, err := m.GetVersion(id, 1); return err }},
+		{"History", func(id string) error { _, err := m.History(id); return err }},
+		{"Rollback", func(id string) error { _, err := m.Rollback(id, 1); return err }},
+	}
+	for _, c := range calls {
+		for _, id := range []string{"../b/x", `a\b`, "", "hashes"} {
+			if err := c.call(id); !errors.Is(err, storage.ErrInvalidID) {
+				t.Errorf("%s(%q) = %v, want ErrInvalidID", c.name, id, err)
+			}
+		}
+	}
+}
+
+func TestUpdateRequestDetectsNoOp(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		wantVersion   uint64
+		wantUnchanged bool
+	}{
+		{"identical text", minimalDoc, 1, true},
+		{"only version differs", strings.Replace(minimalDoc, "(version 1)", "(version 7)", 1), 1, true},
+		{"only layout differs", strings.ReplaceAll(minimalDoc, "\n", " "), 1, true},
+		{"only a comment differs", "; a comment\n" + minimalDoc, 2, false},
+		{"content differs", strings.Replace(minimalDoc, "(country GB)", "(country FR)", 1), 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			_, createHash, err := m.CreateRequest("r", minimalDoc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			version, hash, unchanged, err := m.UpdateRequest("r", tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != tt.wantVersion || unchanged != tt.wantUnchanged {
+				t.Errorf("UpdateRequest = version %d, unchanged %v; want %d, %v",
+					version, unchanged, tt.wantVersion, tt.wantUnchanged)
+			}
+			if unchanged && hash != createHash {
+				t.Errorf("unchanged update returned hash %s, want %s", hash, createHash)
+			}
+			versions, err := m.History("r")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if uint64(len(versions)) != tt.wantVersion {
+				t.Errorf("stored versions %v, want %d", versions, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestCreateRequestExisting(t *testing.T) {
+	changed := strings.Replace(minimalDoc, "(country GB)", "(country FR)", 1)
+	tests := []struct {
+		name       string
+		second     string
+		idempotent bool
+		wantErr    error
+	}{
+		{"plain create fails", minimalDoc, false, ErrAlreadyExists},
+		{"idempotent identical content", minimalDoc, true, nil},
+		{"idempotent after reformatting", strings.ReplaceAll(minimalDoc, "\n", " "), true, nil},
+		{"idempotent with a new comment", "; comment\n" + minimalDoc, true, ErrAlreadyExists},
+		{"idempotent different content", changed, true, ErrAlreadyExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			_, firstHash, err := m.CreateRequest("r", minimalDoc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			version, hash, err := m.CreateRequestWithOptions("r", tt.second, CreateOptions{Idempotent: tt.idempotent})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if version != 1 || hash != firstHash {
+					t.Errorf("got version %d hash %s, want 1 %s", version, hash, firstHash)
+				}
+			}
+			_, text, err := m.GetCurrentText("r")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(text, "(country GB)") {
+				t.Errorf("stored request was overwritten:\n%s", text)
+			}
+		})
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	withMeta := func(meta string) string {
+		return strings.Replace(minimalDoc, `(:meta (request-id "x") (version 1))`, `(:meta (request-id "x") `+meta+`)`, 1)
+	}
+	tests := []struct {
+		name     string
+		a, b     string
+		wantSame bool
+	}{
+		{"identical", minimalDoc, minimalDoc, true},
+		{"updated-at differs",
+			withMeta(`(version 1) (updated-at "2025-01-01T00:00:00Z")`),
+			withMeta(`(version 1) (updated-at "2025-06-01T12:30:00Z")`), true},
+		{"created-at and version differ",
+			withMeta(`(version 1) (created-at "2025-01-01T00:00:00Z")`),
+			withMeta(`(version 2) (created-at "2024-01-01T00:00:00Z")`), true},
+		{"attribute differs", minimalDoc, strings.Replace(minimalDoc, "(country GB)", "(country FR)", 1), false},
+	}
+	m := newTestManager(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := m.ContentHash(tt.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := m.ContentHash(tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (a == b) != tt.wantSame {
+				t.Errorf("hashes %s and %s: same = %v, want %v", a, b, a == b, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestUpdateRequest(t *testing.T) {
+	updated := strings.Replace(minimalDoc, "(country GB)", "(country FR)", 1)
+	tests := []struct {
+		name        string
+		create      bool
+		wantErr     error
+		wantVersion uint64
+	}{
+		{"existing request", true, nil, 2},
+		{"unknown request", false, ErrNotFound, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.NewMemStore()
+			m, err := New(Config{Store: store})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.create {
+				if _, _, err := m.CreateRequest("r", minimalDoc); err != nil {
+					t.Fatal(err)
+				}
+			}
+			version, _, _, err := m.UpdateRequest("r", updated)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if version != tt.wantVersion {
+				t.Errorf("version = %d, want %d", version, tt.wantVersion)
+			}
+			tenant, err := store.ForTenant(DefaultTenant)
+			if err != nil {
+				t.Fatal(err)
+			}
+			latest, text, err := tenant.GetLatest("r")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if latest != tt.wantVersion || !strings.Contains(text, "(country FR)") {
+				t.Errorf("GetLatest = %d\n%s", latest, text)
+			}
+			v1, err := m.GetVersion("r", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			first, _ := m.parser.Parse(v1)
+			second, _ := m.parser.Parse(text)
+			if !first.Meta.CreatedAt.Equal(second.Meta.CreatedAt) {
+				t.Errorf("created-at changed from %v to %v", first.Meta.CreatedAt, second.Meta.CreatedAt)
+			}
+			if second.Meta.Version != tt.wantVersion {
+				t.Errorf("stored meta version = %d, want %d", second.Meta.Version, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestRequestHashIgnoresOrder(t *testing.T) {
+	doc := func(entities, resources string) string {
+		return `(onboarding-request
+  (:meta (request-id "x") (version 1) (created-at "2025-01-01T00:00:00Z"))
+  (:orchestrator
+    (:lifecycle (states draft) (initial draft) (transitions))
+    (:entities ` + entities + `)
+    (:resources ` + resources + `)
+    (:flows)))`
+	}
+	const (
+		entA  = `(entity :id "le:A" :type LegalEntity (attrs (name "A" :provenance "registry") (country GB)))`
+		entA2 = `(entity :id "le:A" :type LegalEntity (attrs (country GB) (name "A" :provenance "registry")))`
+		entB  = `(entity :id "le:B" :type LegalEntity (attrs (lei "X")))`
+		resA  = `(resource :id "a" :type Account (config (currency EUR) (limit 10)))`
+		resA2 = `(resource :id "a" :type Account (config (limit 10) (currency EUR)))`
+		resB  = `(resource :id "b" :type Account)`
+	)
+	tests := []struct {
+		name     string
+		a, b     string
+		wantSame bool
+	}{
+		{"entities reordered", doc(entA+entB, ""), doc(entB+entA, ""), true},
+		{"attributes reordered", doc(entA, ""), doc(entA2, ""), true},
+		{"resources reordered", doc("", resA+resB), doc("", resB+resA), true},
+		{"config reordered", doc("", resA), doc("", resA2), true},
+		{"everything reordered", doc(entA+entB, resA+resB), doc(entB+entA2, resB+resA2), true},
+		{"value changed", doc(entA, ""), doc(strings.Replace(entA, "GB", "FR", 1), ""), false},
+	}
+	m := newTestManager(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := m.parser.Parse(tt.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := m.parser.Parse(tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if same := requestHash(a) == requestHash(b); same != tt.wantSame {
+				t.Errorf("same hash = %v, want %v", same, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestConcurrentUpdatesGetDistinctVersions(t *testing.T) {
+	const writers = 12
+	m := newTestManager(t)
+	if _, _, err := m.CreateRequest("r", minimalDoc); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	versions := make(chan uint64, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			text := strings.Replace(minimalDoc, `(country GB)`, fmt.Sprintf("(country GB) (seq %d)", i), 1)
+			v, _, _, err := m.UpdateRequest("r", text)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			versions <- v
+		}(i)
+	}
+	wg.Wait()
+	close(versions)
+	seen := map[uint64]bool{}
+	for v := range versions {
+		if seen[v] {
+			t.Errorf("version %d returned twice", v)
+		}
+		seen[v] = true
+	}
+	history, err := m.History("r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != writers+1 || history[len(history)-1] != writers+1 {
+		t.Errorf("history = %v, want versions 1 to %d", history, writers+1)
+	}
+}
+
+func TestIdempotentCreateWritesNothing(t *testing.T) {
+	dir := t.TempDir()
+	m, err := New(Config{Store: storage.NewFileStore(dir)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, hash, err := m.CreateRequestWithOptions("r", minimalDoc, CreateOptions{Idempotent: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := snapshot(t, dir)
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"same text", minimalDoc},
+		{"same document reformatted", strings.ReplaceAll(minimalDoc, "\n", " ")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, h, err := m.CreateRequestWithOptions("r", tt.text, CreateOptions{Idempotent: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != version || h != hash {
+				t.Errorf("got version %d hash %s, want %d %s", v, h, version, hash)
+			}
+			if after := snapshot(t, dir); after != before {
+				t.Errorf("store changed:\nbefore:\n%s\nafter:\n%s", before, after)
+			}
+		})
+	}
+}
+
+// snapshot lists every file under dir with its size and modification time.
+func snapshot(t *testing.T, dir string) string {
+	t.Helper()
+	var b strings.Builder
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s %d %s\n", strings.TrimPrefix(path, dir), info.Size(), info.ModTime().Format(time.RFC3339Nano))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestOrphanResourceIsAWarning(t *testing.T) {
+	tests := []struct {
+		name         string
+		text         string
+		wantWarnings int
+	}{
+		{"referenced resource", minimalDoc, 0},
+		{"orphaned resource", strings.Replace(minimalDoc,
+			`(resource :id "acct" :type Account (requires (entity "le:A"))))`,
+			`(resource :id "acct" :type Account (requires (entity "le:A")))
+      (resource :id "spare" :type Account))`, 1), 1},
+	}
+	m := newTestManager(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, warnings, err := m.ValidateTextWithOptions(tt.text, ValidateOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(issues) != 0 {
+				t.Errorf("issues = %q, want none", issues)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("warnings = %q, want %d", warnings, tt.wantWarnings)
+			}
+			for _, w := range warnings {
+				if !strings.Contains(w, `resource "spare" looks orphaned`) {
+					t.Errorf("unexpected warning %q", w)
+				}
+			}
+		})
+	}
+}
+
+func TestListRequestsSince(t *testing.T) {
+	store := storage.NewMemStore()
+	m, err := New(Config{Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenant, err := store.ForTenant(DefaultTenant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []struct{ id, created, updated string }{
+		{"old", "2024-01-01T00:00:00Z", "2024-01-02T00:00:00Z"},
+		{"recent", "2024-01-01T00:00:00Z", "2025-03-01T12:00:00Z"},
+		{"created-only", "2024-07-01T00:00:00Z", ""},
+	} {
+		meta := `(:meta (request-id "` + r.id + `") (version 1) (created-at "` + r.created + `")`
+		if r.updated != "" {
+			meta += ` (updated-at "` + r.updated + `")`
+		}
+		text := strings.Replace(minimalDoc, `(:meta (request-id "x") (version 1)`, meta, 1)
+		if err := tenant.Put(r.id, 1, text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	infos, err := m.ListRequestsSince(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, info := range infos {
+		got = append(got, fmt.Sprintf("%s v%d %s", info.ID, info.Latest, info.UpdatedAt.Format(time.RFC3339)))
+	}
+	want := []string{"recent v1 2025-03-01T12:00:00Z", "created-only v1 2024-07-01T00:00:00Z"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ListRequestsSince = %q, want %q", got, want)
+	}
+}
+
+// closingStore is a MemStore that records Close calls, standing in for a
+// buffered backend.
+type closingStore struct {
+	*storage.MemStore
+	closed int
+	err    error
+}
+
+func (s *closingStore) Close() error {
+	s.closed++
+	return s.err
+}
+
+func TestClose(t *testing.T) {
+	store := &closingStore{MemStore: storage.NewMemStore()}
+	m, err := New(Config{Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); err != nil || store.closed != 1 {
+		t.Fatalf("Close = %v with the store closed %d times; want nil, 1", err, store.closed)
+	}
+	tm, err := m.ForTenant("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.err = errors.New("flush failed")
+	if err := tm.Close(); err != store.err || store.closed != 2 {
+		t.Errorf("tenant Close = %v with the store closed %d times; want the store's error, 2", err, store.closed)
+	}
+	if err := newTestManager(t).Close(); err != nil {
+		t.Errorf("Close over a store without Close = %v", err)
+	}
+}
+
+func TestDictionaryLookups(t *testing.T) {
+	dir := t.TempDir()
+	dict := `{
+  "products": [{"ProductID": "custody", "ServiceIDs": ["safekeeping", "settlement"]}],
+  "services": [{"ServiceID": "safekeeping", "ResourceIDs": ["custody-account"]}],
+  "resources": [{"ResourceID": "custody-account", "Description": "Securities account"}]
+}`
+	if err := os.WriteFile(filepath.Join(dir, "data-dictionary.json"), []byte(dict), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(Config{RegistryDir: dir, Store: storage.NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p, ok := m.GetProduct("custody"); !ok || strings.Join(p.ServiceIDs, " ") != "safekeeping settlement" {
+		t.Errorf("GetProduct(custody) = %+v, %v; want its services", p, ok)
+	}
+	if s, ok := m.GetService("safekeeping"); !ok || strings.Join(s.ResourceIDs, " ") != "custody-account" {
+		t.Errorf("GetService(safekeeping) = %+v, %v; want its resources", s, ok)
+	}
+	if r, ok := m.GetResource("custody-account"); !ok || r.Description != "Securities account" {
+		t.Errorf("GetResource(custody-account) = %+v, %v", r, ok)
+	}
+	for _, unknown := range []struct {
+		name string
+		ok   bool
+	}{
+		{"product", func() bool { _, ok := m.GetProduct("nope"); return ok }()},
+		{"service", func() bool { _, ok := m.GetService("nope"); return ok }()},
+		{"resource", func() bool { _, ok := m.GetResource("nope"); return ok }()},
+		{"product without a dictionary", func() bool { _, ok := newTestManager(t).GetProduct("custody"); return ok }()},
+	} {
+		if unknown.ok {
+			t.Errorf("unknown %s found", unknown.name)
+		}
+	}
+}
+
+func TestValidateDictionary(t *testing.T) {
+	dir := t.TempDir()
+	dict := `{"attributes": [{"AttributeID": "name"}]}`
+	if err := os.WriteFile(filepath.Join(dir, "data-dictionary.json"), []byte(dict), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(Config{RegistryDir: dir, Store: storage.NewMemStore()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const unknown = `7:50: entity "le:A": attribute country is not in the data dictionary`
+	tests := []struct {
+		name         string
+		opts         ValidateOptions
+		wantIssues   []string
+		wantWarnings []string
+	}{
+		{"off", ValidateOptions{}, nil, nil},
+		{"warning", ValidateOptions{Dictionary: true}, nil, []string{unknown}},
+		{"strict", ValidateOptions{Dictionary: true, Strict: true}, []string{unknown}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, warnings, err := m.ValidateTextWithOptions(minimalDoc, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(issues) != fmt.Sprint(tt.wantIssues) || fmt.Sprint(warnings) != fmt.Sprint(tt.wantWarnings) {
+				t.Errorf("issues %q, warnings %q; want %q, %q", issues, warnings, tt.wantIssues, tt.wantWarnings)
+			}
+		})
+	}
+	if _, _, err := newTestManager(t).ValidateTextWithOptions(minimalDoc, ValidateOptions{Dictionary: true}); err == nil {
+		t.Error("dictionary check without a dictionary succeeded")
+	}
+}
+
+func TestValidateTextDuplicateIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{"entity", strings.Replace(minimalDoc, "(:entities\n", `(:entities
+      (entity :id "le:A" :type Individual (attrs (name "B")))
+`, 1), `7:7: duplicate entity id "le:A" (first declared at 6:7)`},
+		{"resource", strings.Replace(minimalDoc, "(:resources\n", `(:resources
+      (resource :id "acct" :type Account)
+`, 1), `10:7: duplicate resource id "acct" (first declared at 9:7)`},
+	}
+	m := newTestManager(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, err := m.ValidateText(tt.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			found := false
+			for _, issue := range issues {
+				found = found || issue == tt.want
+			}
+			if !found {
+				t.Errorf("issues = %q, want %q among them", issues, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTextDetailed(t *testing.T) {
+	m := newTestManager(t)
+	perr, err := m.ValidateTextDetailed(minimalDoc)
+	if perr != nil || err != nil {
+		t.Fatalf("valid text: ValidateTextDetailed = %v, %v", perr, err)
+	}
+	perr, err = m.ValidateTextDetailed(strings.TrimSuffix(minimalDoc, ")\n"))
+	if err != nil || perr == nil {
+		t.Fatalf("truncated text: ValidateTextDetailed = %v, %v; want a parse error", perr, err)
+	}
+	if perr.Found != "EOF" || len(perr.Expected) != 1 || perr.Expected[0] != `")"` {
+		t.Errorf("found %q, expected %q; want EOF, [\")\"]", perr.Found, perr.Expected)
+	}
+}
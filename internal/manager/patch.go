@@ -0,0 +1,282 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/example/dsl-go/internal/ast"
+	"github.com/example/dsl-go/internal/parse"
+)
+
+// ErrPatchConflict is returned by ApplyPatch when a patch does not fit the
+// latest version: it names an item that is missing, adds one that exists or
+// expects a field value the request no longer has.
+var ErrPatchConflict = errors.New("patch does not apply")
+
+// ApplyPatch applies the entity and resource changes of patch, in the form
+// Diff produces, to the latest version of request id and stores the result
+// as a new version. Removed items are deleted. Changed items have each field
+// set to its New value, or removed when New is empty, after checking that
+// the field still holds Old. An added item is built from its entry in
+// Changed, which must at least give its type. Flow changes are not supported.
+func (m *Manager) ApplyPatch(id string, patch RequestDiff) (newVersion uint64, err error) {
+	if !patch.Flows.empty() {
+		return 0, errors.New("patching flows is not supported")
+	}
+	defer m.lock(id)()
+	prev, req, err := m.latest(id)
+	if err != nil {
+		return 0, err
+	}
+	if req.Orchestrator == nil {
+		req.Orchestrator = &ast.Orchestrator{}
+	}
+	orch := req.Orchestrator
+
+	entities := map[string]*ast.Entity{}
+	for _, e := range orch.Entities {
+		entities[e.ID] = e
+	}
+	added, changes, err := patchPlan("entity", patch.Entities, entityFields(req))
+	if err != nil {
+		return 0, err
+	}
+	for _, eid := range patch.Entities.Removed {
+		delete(entities, eid)
+	}
+	for _, eid := range added {
+		e := &ast.Entity{ID: eid}
+		entities[eid] = e
+		orch.Entities = append(orch.Entities, e)
+	}
+	for eid, cs := range changes {
+		if err := patchEntity(entities[eid], cs); err != nil {
+			return 0, err
+		}
+	}
+	kept := orch.Entities[:0]
+	for _, e := range orch.Entities {
+		if entities[e.ID] == e {
+			kept = append(kept, e)
+		}
+	}
+	orch.Entities = kept
+
+	resources := map[string]*ast.Resource{}
+	for _, r := range orch.Resources {
+		resources[r.ID] = r
+	}
+	added, changes, err = patchPlan("resource", patch.Resources, resourceFields(req))
+	if err != nil {
+		return 0, err
+	}
+	for _, rid := range patch.Resources.Removed {
+		delete(resources, rid)
+	}
+	for _, rid := range added {
+		r := &ast.Resource{ID: rid}
+		resources[rid] = r
+		orch.Resources = append(orch.Resources, r)
+	}
+	for rid, cs := range changes {
+		if err := patchResource(resources[rid], cs); err != nil {
+			return 0, err
+		}
+	}
+	keptResources := orch.Resources[:0]
+	for _, r := range orch.Resources {
+		if resources[r.ID] == r {
+			keptResources = append(keptResources, r)
+		}
+	}
+	orch.Resources = keptResources
+
+	version, _, err := m.putNext(id, prev, req, time.Now().UTC())
+	return version, err
+}
+
+// patchPlan checks d against the current items, given as id -> field ->
+// value like entityFields, and returns the ids to add and the changes of
+// every added or changed item by id.
+func patchPlan(kind string, d ItemDiff, current map[string]map[string]string) ([]string, map[string][]Change, error) {
+	changes := map[string][]Change{}
+	for _, item := range d.Changed {
+		if changes[item.ID] != nil {
+			return nil, nil, fmt.Errorf("%s %s is changed twice: %w", kind, item.ID, ErrPatchConflict)
+		}
+		changes[item.ID] = item.Changes
+	}
+	isAdded := map[string]bool{}
+	for _, id := range d.Added {
+		if _, ok := current[id]; ok || isAdded[id] {
+			return nil, nil, fmt.Errorf("cannot add %s %s: it already exists: %w", kind, id, ErrPatchConflict)
+		}
+		isAdded[id] = true
+		if !hasField(changes[id], "type") {
+			return nil, nil, fmt.Errorf("cannot add %s %s: the patch gives no type for it", kind, id)
+		}
+	}
+	for _, id := range d.Removed {
+		if _, ok := current[id]; !ok {
+			return nil, nil, fmt.Errorf("cannot remove %s %s: it does not exist: %w", kind, id, ErrPatchConflict)
+		}
+		if changes[id] != nil {
+			return nil, nil, fmt.Errorf("%s %s is both removed and changed: %w", kind, id, ErrPatchConflict)
+		}
+	}
+	for id, cs := range changes {
+		fields, ok := current[id]
+		if !ok && !isAdded[id] {
+			return nil, nil, fmt.Errorf("cannot change %s %s: it does not exist: %w", kind, id, ErrPatchConflict)
+		}
+		for _, c := range cs {
+			if fields[c.Field] != c.Old {
+				return nil, nil, fmt.Errorf("%s %s: %s is %s, patch expects %s: %w",
+					kind, id, c.Field, orNone(fields[c.Field]), orNone(c.Old), ErrPatchConflict)
+			}
+		}
+	}
+	return d.Added, changes, nil
+}
+
+func hasField(changes []Change, field string) bool {
+	for _, c := range changes {
+		if c.Field == field && c.New != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// patchEntity applies changes to e. The new values are parsed as the body of
+// an entity form, so they are checked exactly as in a document.
+func patchEntity(e *ast.Entity, changes []Change) error {
+	typ := e.Typ
+	var tags, attrs []string
+	for _, c := range changes {
+		switch {
+		case c.Field == "type":
+			typ = c.New
+		case c.Field == "tags":
+			tags = append(tags, fmt.Sprintf("(tags %s)", c.New))
+		case strings.HasPrefix(c.Field, "attrs."):
+			if c.New != "" {
+				attrs = append(attrs, fmt.Sprintf("(%s %s)", strings.TrimPrefix(c.Field, "attrs."), c.New))
+			}
+		default:
+			return fmt.Errorf("entity %s: cannot patch field %q", e.ID, c.Field)
+		}
+	}
+	text := fmt.Sprintf("(:entities (entity :id %q :type %s %s (attrs %s)))",
+		e.ID, typ, strings.Join(tags, " "), strings.Join(attrs, " "))
+	parsed, err := parse.ParseSection(text, ":entities")
+	if err != nil {
+		return fmt.Errorf("entity %s: invalid patch: %w", e.ID, err)
+	}
+	p := parsed.([]*ast.Entity)[0]
+	if len(p.Attrs) != len(attrs) {
+		return fmt.Errorf("entity %s: invalid patch: an attribute value is not a single value", e.ID)
+	}
+
+	e.Typ = p.Typ
+	for _, c := range changes {
+		switch {
+		case c.Field == "tags":
+			e.Tags = p.Tags
+		case strings.HasPrefix(c.Field, "attrs.") && c.New == "":
+			key := strings.TrimPrefix(c.Field, "attrs.")
+			if a, ok := ast.GetAttr(e, key); ok {
+				e.Attrs = removeAttr(e.Attrs, a)
+			}
+		}
+	}
+	// A diff carries no provenance, so a changed value keeps the one it had.
+	for _, a := range p.Attrs {
+		var provenance *string
+		if cur, ok := ast.GetAttr(e, a.Key); ok {
+			provenance = cur.Provenance
+		}
+		ast.SetAttr(e, a.Key, a.Value, provenance)
+	}
+	return nil
+}
+
+func removeAttr(attrs []*ast.AttrVal, a *ast.AttrVal) []*ast.AttrVal {
+	for i, x := range attrs {
+		if x == a {
+			return append(attrs[:i], attrs[i+1:]...)
+		}
+	}
+	return attrs
+}
+
+// patchResource applies changes to r, parsing the new values as the body of
+// a resource form.
+func patchResource(r *ast.Resource, changes []Change) error {
+	typ := r.Typ
+	var requires, config []string
+	for _, c := range changes {
+		switch {
+		case c.Field == "type":
+			typ = c.New
+		case c.Field == "requires":
+			requires = append(requires, fmt.Sprintf("(requires %s)", c.New))
+		case strings.HasPrefix(c.Field, "config."):
+			if c.New != "" {
+				config = append(config, fmt.Sprintf("(%s %s)", strings.TrimPrefix(c.Field, "config."), c.New))
+			}
+		default:
+			return fmt.Errorf("resource %s: cannot patch field %q", r.ID, c.Field)
+		}
+	}
+	text := fmt.Sprintf("(:resources (resource :id %q :type %s %s (config %s)))",
+		r.ID, typ, strings.Join(requires, " "), strings.Join(config, " "))
+	parsed, err := parse.ParseSection(text, ":resources")
+	if err != nil {
+		return fmt.Errorf("resource %s: invalid patch: %w", r.ID, err)
+	}
+	p := parsed.([]*ast.Resource)[0]
+	if len(p.Config) != len(config) {
+		return fmt.Errorf("resource %s: invalid patch: a config value is not a single value", r.ID)
+	}
+
+	r.Typ = p.Typ
+	for _, c := range changes {
+		switch {
+		case c.Field == "requires":
+			r.Requires = p.Requires
+		case strings.HasPrefix(c.Field, "config."):
+			key := strings.TrimPrefix(c.Field, "config.")
+			r.Config = setConfig(r.Config, key, p.Config)
+		}
+	}
+	return nil
+}
+
+// setConfig replaces the entry key of config with the one in from, keeping
+// its position, appends it if config has none, or removes it if from has
+// none.
+func setConfig(config []*ast.KVPair, key string, from []*ast.KVPair) []*ast.KVPair {
+	var kv *ast.KVPair
+	for _, x := range from {
+		if x.Key == key {
+			kv = x
+		}
+	}
+	for i, x := range config {
+		if x.Key != key {
+			continue
+		}
+		if kv == nil {
+			return append(config[:i], config[i+1:]...)
+		}
+		config[i] = kv
+		return config
+	}
+	if kv != nil {
+		config = append(config, kv)
+	}
+	return config
+}
@@ -0,0 +1,125 @@
+package manager
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/example/dsl-go/internal/ast"
+)
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   RequestDiff
+		wantErr error
+		check   func(t *testing.T, req *ast.Request)
+	}{
+		{
+			name: "changed attribute keeps its provenance",
+			patch: RequestDiff{Entities: ItemDiff{Changed: []ItemChanges{{ID: "le:A", Changes: []Change{
+				{Field: "attrs.name", Old: `"A"`, New: `"B"`},
+			}}}}},
+			check: func(t *testing.T, req *ast.Request) {
+				a, ok := ast.GetAttr(req.Orchestrator.Entities[0], "name")
+				if !ok || a.Value.String == nil || *a.Value.String != "B" {
+					t.Fatalf("name = %+v, want \"B\"", a)
+				}
+				if a.Provenance == nil || *a.Provenance != "registry" {
+					t.Errorf("provenance = %v, want registry", a.Provenance)
+				}
+			},
+		},
+		{
+			name: "removed attribute",
+			patch: RequestDiff{Entities: ItemDiff{Changed: []ItemChanges{{ID: "le:A", Changes: []Change{
+				{Field: "attrs.country", Old: "GB"},
+			}}}}},
+			check: func(t *testing.T, req *ast.Request) {
+				if _, ok := ast.GetAttr(req.Orchestrator.Entities[0], "country"); ok {
+					t.Error("country is still set")
+				}
+			},
+		},
+		{
+			name: "added entity",
+			patch: RequestDiff{Entities: ItemDiff{Added: []string{"le:B"}, Changed: []ItemChanges{{ID: "le:B", Changes: []Change{
+				{Field: "type", New: "LegalEntity"},
+				{Field: "attrs.name", New: `"B"`},
+			}}}}},
+			check: func(t *testing.T, req *ast.Request) {
+				if n := len(req.Orchestrator.Entities); n != 2 {
+					t.Fatalf("%d entities, want 2", n)
+				}
+				if e := req.Orchestrator.Entities[1]; e.ID != "le:B" || e.Typ != "LegalEntity" {
+					t.Errorf("added entity = %s %s", e.ID, e.Typ)
+				}
+			},
+		},
+		{
+			name: "resource config change",
+			patch: RequestDiff{Resources: ItemDiff{Changed: []ItemChanges{{ID: "acct", Changes: []Change{
+				{Field: "config.currency", New: "GBP"},
+			}}}}},
+			check: func(t *testing.T, req *ast.Request) {
+				if c := req.Orchestrator.Resources[0].Config; len(c) != 1 || c[0].Key != "currency" {
+					t.Errorf("config = %+v", c)
+				}
+			},
+		},
+		{
+			name: "stale old value",
+			patch: RequestDiff{Entities: ItemDiff{Changed: []ItemChanges{{ID: "le:A", Changes: []Change{
+				{Field: "attrs.country", Old: "FR", New: "DE"},
+			}}}}},
+			wantErr: ErrPatchConflict,
+		},
+		{
+			name:    "remove missing entity",
+			patch:   RequestDiff{Entities: ItemDiff{Removed: []string{"le:Z"}}},
+			wantErr: ErrPatchConflict,
+		},
+		{
+			name:    "add existing entity",
+			patch:   RequestDiff{Entities: ItemDiff{Added: []string{"le:A"}}},
+			wantErr: ErrPatchConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			if _, _, err := m.CreateRequest("r", minimalDoc); err != nil {
+				t.Fatal(err)
+			}
+			v, err := m.ApplyPatch("r", tt.patch)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != 2 {
+				t.Errorf("version = %d, want 2", v)
+			}
+			_, req, err := m.latest("r")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, req)
+		})
+	}
+}
+
+func TestApplyPatchRejectsFlows(t *testing.T) {
+	m := newTestManager(t)
+	if _, _, err := m.CreateRequest("r", minimalDoc); err != nil {
+		t.Fatal(err)
+	}
+	_, err := m.ApplyPatch("r", RequestDiff{Flows: ItemDiff{Removed: []string{"main"}}})
+	if err == nil || !strings.Contains(err.Error(), "flows") {
+		t.Errorf("err = %v, want flows not supported", err)
+	}
+}
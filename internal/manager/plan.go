@@ -0,0 +1,408 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/example/dsl-go/internal/ast"
+	"github.com/example/dsl-go/internal/parse"
+	"github.com/example/dsl-go/internal/print"
+)
+
+// compilePlan emits one PlanStep per task and gate of every flow, ordered so
+// that each step comes after everything in its After list. A step runs after:
+//
+//   - the tasks producing anything it needs (for a gate, the predicates of
+//     its condition);
+//   - the step before its fork, if it is a fork branch;
+//   - the steps a join waits on, if it directly follows the join;
+//   - for a gate, every step before it in its flow, and for any other step,
+//     the last gate before it in its flow, so a gate holds back the rest of
+//     the flow until everything ahead of it has run.
+//
+// Forks and joins only order other steps and are not emitted themselves.
+// Steps that do not depend on each other keep their source order. A cycle
+// among the dependencies is an error; steps that can never run are reported
+// in the plan's Diagnostics (see unreachable).
+func compilePlan(req *ast.Request) (*Plan, error) {
+	steps := []PlanStep{}
+	flowOf := map[string]*ast.Flow{}
+	producers := map[string][]string{}
+	if req.Orchestrator != nil {
+		for _, f := range req.Orchestrator.Flows {
+			for _, s := range f.Steps {
+				id := planStepID(s)
+				if flowOf[id] != nil {
+					return nil, fmt.Errorf("flow %q: duplicate step id %q", f.ID, id)
+				}
+				flowOf[id] = f
+				if s.Task != nil {
+					for _, p := range s.Task.Produces {
+						producers[p] = append(producers[p], id)
+					}
+				}
+			}
+		}
+		for _, f := range req.Orchestrator.Flows {
+			steps = append(steps, flowSteps(f, producers)...)
+		}
+	}
+
+	ordered, err := topoSort(steps)
+	if err != nil {
+		return nil, err
+	}
+	canonical, err := json.Marshal(ordered)
+	if err != nil {
+		return nil, err
+	}
+	return &Plan{
+		Steps:       ordered,
+		PlanHash:    hash(string(canonical)),
+		Diagnostics: unreachable(ordered, flowOf, producers),
+	}, nil
+}
+
+// unreachable describes the steps of ordered that can never run: tasks that
+// need something no task produces, and steps running after such a step.
+// Gate predicates are not checked, as most are satisfied outside the flows.
+// flowOf maps step ids to their flows.
+func unreachable(ordered []PlanStep, flowOf map[string]*ast.Flow, producers map[string][]string) []string {
+	var diags []string
+	blocked := map[string]bool{}
+	for _, step := range ordered {
+		f := flowOf[step.ID]
+		reason := ""
+		for _, s := range f.Steps {
+			if s.Task == nil || s.Task.ID != step.ID {
+				continue
+			}
+			for _, n := range s.Task.Needs {
+				if len(producers[n]) == 0 {
+					reason = fmt.Sprintf("needs %q, which no task produces", n)
+					break
+				}
+			}
+		}
+		if reason == "" {
+			for _, a := range step.After {
+				if blocked[a] {
+					reason = fmt.Sprintf("runs after unreachable step %q", a)
+					break
+				}
+			}
+		}
+		if reason != "" {
+			blocked[step.ID] = true
+			diags = append(diags, fmt.Sprintf("flow %q: step %q can never run: %s", f.ID, step.ID, reason))
+		}
+	}
+	return diags
+}
+
+// flowSteps returns the plan steps of f in source order with their After
+// lists filled in.
+func flowSteps(f *ast.Flow, producers map[string][]string) []PlanStep {
+	var steps []PlanStep
+	// deps holds, for forks and joins, the emitted steps they stand for.
+	deps := map[string][]string{}
+	resolve := func(ids []string) []string {
+		var out []string
+		for _, id := range ids {
+			if d, ok := deps[id]; ok {
+				out = append(out, d...)
+			} else {
+				out = append(out, id)
+			}
+		}
+		return out
+	}
+	forkOf := map[string]string{}
+	for _, s := range f.Steps {
+		if s.Fork != nil {
+			for _, b := range s.Fork.Branches {
+				forkOf[b] = s.Fork.ID
+			}
+		}
+	}
+
+	// carry holds what the next step runs after, set by the step before it;
+	// prev is the step before it if that was emitted. gate is the last gate
+	// emitted and sinceGate the steps emitted after it (or from the start).
+	var carry []string
+	prev := ""
+	gate := ""
+	var sinceGate []string
+	for _, s := range f.Steps {
+		id := planStepID(s)
+		after := carry
+		if fork := forkOf[id]; fork != "" {
+			after = append(append([]string{}, after...), deps[fork]...)
+		}
+		carry = nil
+		before := prev
+		prev = ""
+
+		switch {
+		case s.Fork != nil:
+			deps[id] = after
+			if before != "" {
+				deps[id] = append(deps[id], before)
+			}
+			continue
+		case s.Join != nil:
+			deps[id] = resolve(s.Join.After)
+			carry = deps[id]
+			continue
+		}
+
+		step := PlanStep{ID: id, Inputs: [][2]string{}}
+		var needs []string
+		if s.Task != nil {
+			step.Action = s.Task.Op
+			for _, arg := range s.Task.Args {
+				step.Inputs = append(step.Inputs, [2]string{arg.Key, print.Value(arg.Value)})
+			}
+			needs = s.Task.Needs
+		} else {
+			step.Action = "gate"
+			step.Inputs = append(step.Inputs, [2]string{"when", s.Gate.Condition})
+			needs = gateNeeds(s.Gate.Condition)
+			after = append(after, sinceGate...)
+		}
+		if gate != "" {
+			after = append(after, gate)
+		}
+		for _, n := range needs {
+			after = append(after, producers[n]...)
+		}
+		step.After = uniqueExcept(after, id)
+		steps = append(steps, step)
+		prev = id
+		if s.Gate != nil {
+			gate, sinceGate = id, nil
+		} else {
+			sinceGate = append(sinceGate, id)
+		}
+	}
+	return steps
+}
+
+// gateNeeds returns the predicates of a gate condition, or the whole
+// condition as a single name if it does not parse.
+func gateNeeds(condition string) []string {
+	cond, err := parse.ParseGateCondition(condition)
+	if err != nil {
+		return []string{condition}
+	}
+	return cond.Predicates()
+}
+
+// uniqueExcept returns ids sorted and deduplicated, without self.
+func uniqueExcept(ids []string, self string) []string {
+	out := []string{}
+	seen := map[string]bool{self: true}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// topoSort orders steps so every step follows those in its After list,
+// breaking ties by input order. After entries that name no step are ignored.
+func topoSort(steps []PlanStep) ([]PlanStep, error) {
+	index := map[string]int{}
+	for i, s := range steps {
+		index[s.ID] = i
+	}
+	pending := make([]int, len(steps))
+	dependents := make([][]int, len(steps))
+	for i, s := range steps {
+		for _, a := range s.After {
+			if j, ok := index[a]; ok {
+				pending[i]++
+				dependents[j] = append(dependents[j], i)
+			}
+		}
+	}
+
+	ordered := make([]PlanStep, 0, len(steps))
+	done := make([]bool, len(steps))
+	for len(ordered) < len(steps) {
+		next := -1
+		for i := range steps {
+			if !done[i] && pending[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return nil, fmt.Errorf("dependency cycle: %s", strings.Join(findCycle(steps, index, done), " -> "))
+		}
+		done[next] = true
+		ordered = append(ordered, steps[next])
+		for _, d := range dependents[next] {
+			pending[d]--
+		}
+	}
+	return ordered, nil
+}
+
+// PlanToText renders plan for people: one line per step in execution order
+// with its action, inputs and the steps it runs after, then the plan hash and
+// any diagnostics.
+func PlanToText(plan *Plan) string {
+	var b strings.Builder
+	for i, step := range plan.Steps {
+		fmt.Fprintf(&b, "%d. %s: %s", i+1, step.ID, step.Action)
+		if len(step.Inputs) > 0 {
+			fmt.Fprintf(&b, " %s", inputsText(step.Inputs))
+		}
+		if len(step.After) > 0 {
+			fmt.Fprintf(&b, " (after %s)", strings.Join(step.After, ", "))
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "plan hash: %s\n", plan.PlanHash)
+	for _, d := range plan.Diagnostics {
+		fmt.Fprintf(&b, "warning: %s\n", d)
+	}
+	return b.String()
+}
+
+// planDelta compares the steps of two plans by id.
+func planDelta(from, to *Plan) *PlanDelta {
+	d := &PlanDelta{Added: []PlanStep{}, Removed: []PlanStep{}, Changed: []ChangedStep{}}
+	old := map[string]PlanStep{}
+	for _, step := range from.Steps {
+		old[step.ID] = step
+	}
+	current := map[string]bool{}
+	for _, step := range to.Steps {
+		current[step.ID] = true
+		prev, ok := old[step.ID]
+		if !ok {
+			d.Added = append(d.Added, step)
+			continue
+		}
+		var changes []Change
+		for _, field := range []struct{ name, old, new string }{
+			{"action", prev.Action, step.Action},
+			{"inputs", inputsText(prev.Inputs), inputsText(step.Inputs)},
+			{"after", strings.Join(prev.After, ", "), strings.Join(step.After, ", ")},
+		} {
+			if field.old != field.new {
+				changes = append(changes, Change{Field: field.name, Old: field.old, New: field.new})
+			}
+		}
+		if len(changes) > 0 {
+			d.Changed = append(d.Changed, ChangedStep{ID: step.ID, Changes: changes})
+		}
+	}
+	for _, step := range from.Steps {
+		if !current[step.ID] {
+			d.Removed = append(d.Removed, step)
+		}
+	}
+	return d
+}
+
+// inputsText renders inputs as PlanToText does, "key=value" separated by
+// spaces.
+func inputsText(inputs [][2]string) string {
+	parts := make([]string, len(inputs))
+	for i, in := range inputs {
+		parts[i] = in[0] + "=" + in[1]
+	}
+	return strings.Join(parts, " ")
+}
+
+// PlanDeltaToText renders d for people: "+ id: action" for added steps,
+// "- id: action" for removed ones and "~ id" followed by "field: old -> new"
+// lines for changed ones.
+func PlanDeltaToText(d *PlanDelta) string {
+	if len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 {
+		return "no differences\n"
+	}
+	var b strings.Builder
+	for _, step := range d.Added {
+		fmt.Fprintf(&b, "+ %s: %s\n", step.ID, step.Action)
+	}
+	for _, step := range d.Removed {
+		fmt.Fprintf(&b, "- %s: %s\n", step.ID, step.Action)
+	}
+	for _, step := range d.Changed {
+		fmt.Fprintf(&b, "~ %s\n", step.ID)
+		for _, c := range step.Changes {
+			fmt.Fprintf(&b, "    %s: %s -> %s\n", c.Field, orNone(c.Old), orNone(c.New))
+		}
+	}
+	return b.String()
+}
+
+// PlanToDOT renders plan as a Graphviz digraph with one node per step,
+// labelled with its id and action, and an edge to each step from every step
+// in its After list. Gates are diamonds and tasks are boxes.
+func PlanToDOT(plan *Plan) string {
+	var b strings.Builder
+	b.WriteString("digraph plan {\n")
+	b.WriteString("  rankdir=LR;\n")
+	for _, step := range plan.Steps {
+		shape := "box"
+		if step.Action == "gate" {
+			shape = "diamond"
+		}
+		fmt.Fprintf(&b, "  %q [shape=%s, label=%q];\n", step.ID, shape, step.ID+"\n"+step.Action)
+	}
+	for _, step := range plan.Steps {
+		for _, after := range step.After {
+			fmt.Fprintf(&b, "  %q -> %q;\n", after, step.ID)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// findCycle returns the ids of one cycle among the steps not yet done, every
+// one of which is waiting on another, closing the cycle with its first id.
+func findCycle(steps []PlanStep, index map[string]int, done []bool) []string {
+	at := map[int]int{}
+	var path []string
+	i := 0
+	for done[i] {
+		i++
+	}
+	for {
+		if start, ok := at[i]; ok {
+			return append(path[start:], steps[i].ID)
+		}
+		at[i] = len(path)
+		path = append(path, steps[i].ID)
+		for _, a := range steps[i].After {
+			if j, ok := index[a]; ok && !done[j] {
+				i = j
+				break
+			}
+		}
+	}
+}
+
+func planStepID(s *ast.Step) string {
+	switch {
+	case s.Task != nil:
+		return s.Task.ID
+	case s.Gate != nil:
+		return s.Gate.ID
+	case s.Fork != nil:
+		return s.Fork.ID
+	case s.Join != nil:
+		return s.Join.ID
+	}
+	return ""
+}
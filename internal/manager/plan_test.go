@@ -0,0 +1,248 @@
+package manager
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPlanDelta(t *testing.T) {
+	open := PlanStep{ID: "open", Action: "open-account", Inputs: [][2]string{{"currency", `"EUR"`}}}
+	kyc := PlanStep{ID: "kyc", Action: "kyc-check"}
+	tests := []struct {
+		name        string
+		from, to    []PlanStep
+		wantAdded   []string
+		wantRemoved []string
+		wantChanged string
+	}{
+		{"identical", []PlanStep{kyc, open}, []PlanStep{kyc, open}, nil, nil, ""},
+		{"only after changed",
+			[]PlanStep{kyc, open},
+			[]PlanStep{kyc, withAfter(open, "kyc")},
+			nil, nil, "open: after  -> kyc"},
+		{"action and inputs changed",
+			[]PlanStep{open},
+			[]PlanStep{{ID: "open", Action: "open-cash-account", Inputs: [][2]string{{"currency", `"GBP"`}}}},
+			nil, nil, `open: action open-account -> open-cash-account; inputs currency="EUR" -> currency="GBP"`},
+		{"added and removed",
+			[]PlanStep{kyc},
+			[]PlanStep{open},
+			[]string{"open"}, []string{"kyc"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := planDelta(&Plan{Steps: tt.from}, &Plan{Steps: tt.to})
+			if got := stepIDs(d.Added); got != fmt.Sprint(tt.wantAdded) {
+				t.Errorf("added = %s, want %v", got, tt.wantAdded)
+			}
+			if got := stepIDs(d.Removed); got != fmt.Sprint(tt.wantRemoved) {
+				t.Errorf("removed = %s, want %v", got, tt.wantRemoved)
+			}
+			var changed []string
+			for _, c := range d.Changed {
+				var fields []string
+				for _, ch := range c.Changes {
+					fields = append(fields, fmt.Sprintf("%s %s -> %s", ch.Field, ch.Old, ch.New))
+				}
+				changed = append(changed, c.ID+": "+strings.Join(fields, "; "))
+			}
+			if got := strings.Join(changed, "\n"); got != tt.wantChanged {
+				t.Errorf("changed = %q, want %q", got, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestPlanDeltaToText(t *testing.T) {
+	tests := []struct {
+		name string
+		d    *PlanDelta
+		want string
+	}{
+		{"empty", &PlanDelta{}, "no differences\n"},
+		{"every kind", &PlanDelta{
+			Added:   []PlanStep{{ID: "b", Action: "open"}},
+			Removed: []PlanStep{{ID: "a", Action: "close"}},
+			Changed: []ChangedStep{{ID: "c", Changes: []Change{{Field: "after", New: "b"}}}},
+		}, "+ b: open\n- a: close\n~ c\n    after: (none) -> b\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PlanDeltaToText(tt.d); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func withAfter(s PlanStep, after ...string) PlanStep {
+	s.After = after
+	return s
+}
+
+func stepIDs(steps []PlanStep) string {
+	var ids []string
+	for _, s := range steps {
+		ids = append(ids, s.ID)
+	}
+	return fmt.Sprint(ids)
+}
+
+func TestManagerPlanDeltaReportsOnlyAfter(t *testing.T) {
+	from := `(onboarding-request
+  (:meta (request-id "x") (version 1))
+  (:orchestrator
+    (:lifecycle (states draft) (initial draft) (transitions))
+    (:entities)
+    (:resources (resource :id "acct" :type Account))
+    (:flows
+      (flow :id "main"
+        (steps
+          (task :id "open" :on "acct" :op open-account (args) (produces "acct.id"))
+          (task :id "fund" :on "acct" :op fund-account (args)))))))`
+	to := strings.Replace(from, "(task :id \"fund\" :on \"acct\" :op fund-account (args))",
+		"(task :id \"fund\" :on \"acct\" :op fund-account (args) (needs \"acct.id\"))", 1)
+	d, err := newTestManager(t).PlanDelta(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Added) != 0 || len(d.Removed) != 0 || len(d.Changed) != 1 {
+		t.Fatalf("delta = %+v, want one changed step", d)
+	}
+	c := d.Changed[0]
+	if c.ID != "fund" || len(c.Changes) != 1 || c.Changes[0] != (Change{Field: "after", New: "open"}) {
+		t.Errorf("changed = %+v, want fund with only after: -> open", c)
+	}
+}
+
+// planDoc returns a document whose main flow has the given steps, all on
+// resource "r".
+func planDoc(steps string) string {
+	return `(onboarding-request
+  (:meta (request-id "x") (version 1))
+  (:orchestrator
+    (:lifecycle (states draft) (initial draft) (transitions))
+    (:entities)
+    (:resources (resource :id "r" :type Account))
+    (:flows (flow :id "main" (steps ` + steps + `)))))`
+}
+
+func task(id string, extra ...string) string {
+	return fmt.Sprintf(`(task :id %q :on "r" :op op-%s (args) %s)`, id, id, strings.Join(extra, " "))
+}
+
+func TestCompilePlan(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps string
+		// want lists the steps in plan order as "id<after,after".
+		want    string
+		wantErr string
+	}{
+		{"independent tasks keep source order",
+			task("a") + task("b"),
+			"a< b<", ""},
+		{"needs",
+			task("b", `(needs "r.x")`) + task("a", `(produces "r.x")`),
+			"a< b<a", ""},
+		{"gate waits for every step before it and holds back the rest",
+			task("a") + task("b") + `(gate :id "g" (when "r.ready"))` + task("c") + task("d"),
+			"a< b< g<a,b c<g d<g", ""},
+		{"second gate waits for the first and the steps between",
+			task("a") + `(gate :id "g1" (when "r.ready"))` + task("b") + `(gate :id "g2" (when "r.done"))` + task("c"),
+			"a< g1<a b<g1 g2<b,g1 c<g2", ""},
+		{"gate needs a predicate produced later",
+			`(gate :id "g" (when "r.ready"))` + task("a", `(produces "r.ready")`),
+			"", "dependency cycle"},
+		{"fork branches run after the step before the fork, join after the branches",
+			task("a") + `(fork :id "f" (branches "b" "c"))` + task("b") + task("c") +
+				`(join :id "j" (after "b" "c"))` + task("d"),
+			"a< b<a c<a d<b,c", ""},
+		{"needs cycle",
+			task("a", `(needs "r.y")`, `(produces "r.x")`) + task("b", `(needs "r.x")`, `(produces "r.y")`),
+			"", "dependency cycle: "},
+		{"duplicate step id",
+			task("a") + task("a"),
+			"", `duplicate step id "a"`},
+	}
+	m := newTestManager(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := m.CompilePlan(planDoc(tt.steps))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, s := range plan.Steps {
+				got = append(got, s.ID+"<"+strings.Join(s.After, ","))
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("plan = %s, want %s", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanToDOT(t *testing.T) {
+	m := newTestManager(t)
+	plan, err := m.CompilePlan(planDoc(task("a", `(produces "r.x")`) + task("b", `(needs "r.x")`) + `(gate :id "g" (when "r.x"))`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dot := PlanToDOT(plan)
+	for _, want := range []string{
+		`  "a" [shape=box, label="a\nop-a"];`,
+		`  "g" [shape=diamond, label="g\ngate"];`,
+	} {
+		if !strings.Contains(dot, want+"\n") {
+			t.Errorf("DOT lacks %s:\n%s", want, dot)
+		}
+	}
+	var edges []string
+	for _, line := range strings.Split(dot, "\n") {
+		if strings.Contains(line, "->") {
+			edges = append(edges, strings.TrimSpace(line))
+		}
+	}
+	want := []string{`"a" -> "b";`, `"a" -> "g";`, `"b" -> "g";`}
+	if !strings.HasPrefix(dot, "digraph plan {\n") || strings.Join(edges, " ") != strings.Join(want, " ") {
+		t.Errorf("edges = %q, want %q:\n%s", edges, want, dot)
+	}
+}
+
+func TestCompilePlanDiagnostics(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps string
+		want  []string
+	}{
+		{"all needs produced",
+			task("a", `(produces "r.x")`) + task("b", `(needs "r.x")`),
+			nil},
+		{"need nothing produces",
+			task("a") + task("b", `(needs "r.missing")`, `(produces "r.y")`) + task("c", `(needs "r.y")`),
+			[]string{
+				`flow "main": step "b" can never run: needs "r.missing", which no task produces`,
+				`flow "main": step "c" can never run: runs after unreachable step "b"`,
+			}},
+	}
+	m := newTestManager(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := m.CompilePlan(planDoc(tt.steps))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(plan.Diagnostics, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("diagnostics = %q, want %q", plan.Diagnostics, tt.want)
+			}
+		})
+	}
+}
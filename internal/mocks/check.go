@@ -0,0 +1,84 @@
+package mocks
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// checkUTF8 returns an error giving the line of the first byte of data that is
+// not valid UTF-8. The decoders would otherwise turn it into U+FFFD silently.
+func checkUTF8(data []byte) error {
+	if utf8.Valid(data) {
+		return nil
+	}
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			return fmt.Errorf("invalid UTF-8 on line %d", bytes.Count(data[:i], []byte("\n"))+1)
+		}
+		i += size
+	}
+	return nil
+}
+
+// checkStrings returns an error naming the first string field of v, by its
+// JSON path, that holds a NUL byte.
+func checkStrings(v interface{}) error {
+	if field := nulField(reflect.ValueOf(v), ""); field != "" {
+		return fmt.Errorf("field %s contains a NUL byte", field)
+	}
+	return nil
+}
+
+// nulField returns the path of the first string under v holding a NUL byte,
+// or "" if there is none. at is the path of v itself.
+func nulField(v reflect.Value, at string) string {
+	switch v.Kind() {
+	case reflect.String:
+		if strings.ContainsRune(v.String(), 0) {
+			return strings.TrimPrefix(at, ".")
+		}
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			return nulField(v.Elem(), at)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			if p := nulField(v.Field(i), at+"."+name); p != "" {
+				return p
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if p := nulField(v.Index(i), fmt.Sprintf("%s[%d]", at, i)); p != "" {
+				return p
+			}
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, k := range keys {
+			key := fmt.Sprint(k)
+			if strings.ContainsRune(key, 0) {
+				return strings.TrimPrefix(at, ".")
+			}
+			if p := nulField(v.MapIndex(k), at+"."+key); p != "" {
+				return p
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,99 @@
+package mocks
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckUTF8(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"ascii", `{"name": "A"}`, ""},
+		{"multibyte", `{"name": "Société 日本"}`, ""},
+		{"bad byte on line 1", "{\"name\": \"\xff\"}", "invalid UTF-8 on line 1"},
+		{"bad byte on line 3", "{\n\"id\": \"a\",\n\"name\": \"\xc3\x28\"\n}", "invalid UTF-8 on line 3"},
+		{"truncated sequence", "{\"name\": \"\xe6\x97\"}", "invalid UTF-8 on line 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkUTF8([]byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckStrings(t *testing.T) {
+	type inner struct {
+		Name string `json:"name"`
+	}
+	type doc struct {
+		ID      string                 `json:"id"`
+		Skipped string                 `json:"-"`
+		Inner   *inner                 `json:"inner"`
+		List    []inner                `json:"list"`
+		Attrs   map[string]interface{} `json:"attrs"`
+		NoTag   string
+	}
+	tests := []struct {
+		name      string
+		v         doc
+		wantField string
+	}{
+		{"clean", doc{ID: "a", Inner: &inner{Name: "b"}, Attrs: map[string]interface{}{"k": "v"}}, ""},
+		{"top-level field", doc{ID: "a\x00"}, "id"},
+		{"ignored field", doc{Skipped: "\x00"}, ""},
+		{"untagged field", doc{NoTag: "\x00"}, "NoTag"},
+		{"pointer", doc{Inner: &inner{Name: "\x00"}}, "inner.name"},
+		{"slice element", doc{List: []inner{{"ok"}, {"x\x00"}}}, "list[1].name"},
+		{"map value", doc{Attrs: map[string]interface{}{"k": []interface{}{"\x00"}}}, "attrs.k[0]"},
+		{"map key", doc{Attrs: map[string]interface{}{"k\x00": 1}}, "attrs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkStrings(&tt.v)
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "field "+tt.wantField+" contains a NUL byte") {
+				t.Errorf("err = %v, want field %s", err, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestLoaderRejectsInvalidFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		wantErr string
+	}{
+		{"invalid byte in JSON", "bad.json", "{\"id\": \"le:A\",\n\"name\": \"A\xff\"}", "invalid entity file bad.json: invalid UTF-8 on line 2"},
+		{"invalid byte in YAML", "bad.yaml", "id: le:A\nname: \"A\xff\"\n", "invalid entity file bad.yaml: invalid UTF-8 on line 2"},
+		{"NUL escape in JSON", "nul.json", `{"id": "le:A", "name": "A\u0000"}`, "invalid entity file nul.json: field name contains a NUL byte"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, dir, "entities/"+tt.file, tt.data)
+			_, err := NewLoader(dir).LoadEntity(tt.file)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
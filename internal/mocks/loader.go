@@ -2,89 +2,208 @@ package mocks
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
-	"strings"
 
 	"github.com/example/dsl-go/internal/generator"
 )
 
-// Loader provides access to mock data from JSON files
+// Loader provides access to mock data from JSON and YAML files
 type Loader struct {
+	fsys fs.FS
+	// basePath is the directory fsys reads from, used for saving. It is
+	// empty for loaders over an arbitrary fs.FS, which are read-only.
 	basePath string
 }
 
+// ErrReadOnly is returned when saving through a loader created with
+// NewFSLoader.
+var ErrReadOnly = errors.New("mock loader is read-only")
+
 // NewLoader creates a new mock data loader with the specified base path
 func NewLoader(basePath string) *Loader {
+	if basePath == "" {
+		basePath = "."
+	}
 	return &Loader{
+		fsys:     os.DirFS(basePath),
 		basePath: basePath,
 	}
 }
 
+// NewFSLoader creates a read-only loader over fsys, such as an embed.FS,
+// whose root holds the entities, products and scenarios directories
+func NewFSLoader(fsys fs.FS) *Loader {
+	return &Loader{fsys: fsys}
+}
+
+// DefaultBasePath is the mock data directory used by NewDefaultLoader,
+// relative to the working directory.
+const DefaultBasePath = "data-mocks"
+
 // NewDefaultLoader creates a loader using the default data-mocks directory
 func NewDefaultLoader() *Loader {
-	return &Loader{
-		basePath: "",
-	}
+	return NewLoader(DefaultBasePath)
 }
 
-// LoadEntity loads a single entity from a JSON file
+// LoadEntity loads a single entity from the named file in the entities
+// directory. Files ending in .yaml or .yml are read as YAML, others as JSON
 func (l *Loader) LoadEntity(filename string) (*generator.ClientEntity, error) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read entity file %s: %w", filename, err)
-	}
+	return l.loadEntity(filename, isYAML(filename))
+}
+
+// LoadEntityYAML loads a single entity from the named YAML file in the
+// entities directory, whatever its extension
+func (l *Loader) LoadEntityYAML(filename string) (*generator.ClientEntity, error) {
+	return l.loadEntity(filename, true)
+}
 
+func (l *Loader) loadEntity(filename string, asYAML bool) (*generator.ClientEntity, error) {
 	var entity generator.ClientEntity
-	if err := json.Unmarshal(data, &entity); err != nil {
-		return nil, fmt.Errorf("failed to parse entity JSON from %s: %w", filename, err)
+	if err := l.load(path.Join("entities", filename), "entity", asYAML, &entity); err != nil {
+		return nil, err
 	}
-
 	return &entity, nil
 }
 
-// LoadProduct loads a single product from a JSON file
+// LoadProduct loads a single product from the named file in the products
+// directory. Files ending in .yaml or .yml are read as YAML, others as JSON
 func (l *Loader) LoadProduct(filename string) (*generator.ProductSpec, error) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read product file %s: %w", filename, err)
-	}
+	return l.loadProduct(filename, isYAML(filename))
+}
+
+// LoadProductYAML loads a single product from the named YAML file in the
+// products directory, whatever its extension
+func (l *Loader) LoadProductYAML(filename string) (*generator.ProductSpec, error) {
+	return l.loadProduct(filename, true)
+}
 
+func (l *Loader) loadProduct(filename string, asYAML bool) (*generator.ProductSpec, error) {
 	var product generator.ProductSpec
-	if err := json.Unmarshal(data, &product); err != nil {
-		return nil, fmt.Errorf("failed to parse product JSON from %s: %w", filename, err)
+	if err := l.load(path.Join("products", filename), "product", asYAML, &product); err != nil {
+		return nil, err
 	}
-
 	return &product, nil
 }
 
-// LoadScenario loads a complete scenario from a JSON file
+// LoadScenario loads a complete scenario from the named file in the
+// scenarios directory. Files ending in .yaml or .yml are read as YAML, others
+// as JSON
 func (l *Loader) LoadScenario(filename string) (*generator.GenerateRequest, error) {
+	return l.loadScenario(filename, isYAML(filename))
+}
+
+// LoadScenarioYAML loads a complete scenario from the named YAML file in the
+// scenarios directory, whatever its extension
+func (l *Loader) LoadScenarioYAML(filename string) (*generator.GenerateRequest, error) {
+	return l.loadScenario(filename, true)
+}
+
+func (l *Loader) loadScenario(filename string, asYAML bool) (*generator.GenerateRequest, error) {
+	var scenario generator.GenerateRequest
+	if err := l.load(path.Join("scenarios", filename), "scenario", asYAML, &scenario); err != nil {
+		return nil, err
+	}
+	return &scenario, nil
+}
+
+// load reads the named file and decodes it into v, as YAML if asYAML is set
+// and as JSON otherwise. kind names the file in errors.
+func (l *Loader) load(name, kind string, asYAML bool, v interface{}) error {
+	filename := path.Base(name)
+	data, err := fs.ReadFile(l.fsys, name)
+	if err != nil {
+		return fmt.Errorf("failed to read %s file %s: %w", kind, filename, err)
+	}
+	return decode(data, filename, kind, asYAML, v)
+}
+
+// decode decodes data, read from filename, into v as load does.
+func decode(data []byte, filename, kind string, asYAML bool, v interface{}) error {
+	if err := checkUTF8(data); err != nil {
+		return fmt.Errorf("invalid %s file %s: %w", kind, filename, err)
+	}
+	if asYAML {
+		if err := unmarshalYAML(data, v); err != nil {
+			return fmt.Errorf("failed to parse %s YAML from %s: %w", kind, filename, err)
+		}
+	} else if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s JSON from %s: %w", kind, filename, err)
+	}
+	if err := checkStrings(v); err != nil {
+		return fmt.Errorf("invalid %s file %s: %w", kind, filename, err)
+	}
+	return nil
+}
+
+// encode marshals v for saving to filename: as YAML if isYAML(filename),
+// otherwise as indented JSON.
+func encode(v interface{}, filename string) ([]byte, error) {
+	if isYAML(filename) {
+		return marshalYAML(v)
+	}
+	return json.MarshalIndent(v, "", "  ")
+}
+
+// LoadScenarioFile loads a complete scenario from filename, a path outside
+// any loader's directories such as a command-line argument, and validates it
+// with GenerateRequest.Validate. Files ending in .yaml or .yml are read as
+// YAML, others as JSON
+func LoadScenarioFile(filename string) (*generator.GenerateRequest, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read scenario file %s: %w", filename, err)
 	}
+	var scenario generator.GenerateRequest
+	if err := decode(data, filepath.Base(filename), "scenario", isYAML(filename), &scenario); err != nil {
+		return nil, err
+	}
+	if err := scenario.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
+	}
+	return &scenario, nil
+}
 
+// DecodeScenario reads a complete scenario, such as an HTTP request body,
+// from r and validates it with GenerateRequest.Validate
+func DecodeScenario(r io.Reader) (*generator.GenerateRequest, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %w", err)
+	}
+	if err := checkUTF8(data); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
+	}
 	var scenario generator.GenerateRequest
 	if err := json.Unmarshal(data, &scenario); err != nil {
-		return nil, fmt.Errorf("failed to parse scenario JSON from %s: %w", filename, err)
+		return nil, fmt.Errorf("failed to parse scenario JSON: %w", err)
+	}
+	if err := checkStrings(&scenario); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
+	}
+
+	if err := scenario.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
 	}
 
 	return &scenario, nil
 }
 
-// LoadAllEntities loads all entity JSON files from the entities directory
+// LoadAllEntities loads all entity JSON and YAML files from the entities directory
 func (l *Loader) LoadAllEntities() ([]generator.ClientEntity, error) {
-	entitiesPath := filepath.Join(l.basePath, "entities")
-	files, err := os.ReadDir(entitiesPath)
+	files, err := fs.ReadDir(l.fsys, "entities")
 	if err != nil {
 		return nil, fmt.Errorf("failed to read entities directory: %w", err)
 	}
 
 	entities := make([]generator.ClientEntity, 0, len(files))
 	for _, file := range files {
-		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+		if file.IsDir() || !isMockFile(file.Name()) {
 			continue
 		}
 
@@ -98,17 +217,16 @@ func (l *Loader) LoadAllEntities() ([]generator.ClientEntity, error) {
 	return entities, nil
 }
 
-// LoadAllProducts loads all product JSON files from the products directory
+// LoadAllProducts loads all product JSON and YAML files from the products directory
 func (l *Loader) LoadAllProducts() ([]generator.ProductSpec, error) {
-	productsPath := filepath.Join(l.basePath, "products")
-	files, err := os.ReadDir(productsPath)
+	files, err := fs.ReadDir(l.fsys, "products")
 	if err != nil {
 		return nil, fmt.Errorf("failed to read products directory: %w", err)
 	}
 
 	products := make([]generator.ProductSpec, 0, len(files))
 	for _, file := range files {
-		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+		if file.IsDir() || !isMockFile(file.Name()) {
 			continue
 		}
 
@@ -124,15 +242,14 @@ func (l *Loader) LoadAllProducts() ([]generator.ProductSpec, error) {
 
 // ListEntities returns a list of available entity mock files
 func (l *Loader) ListEntities() ([]string, error) {
-	entitiesPath := filepath.Join(l.basePath, "entities")
-	files, err := os.ReadDir(entitiesPath)
+	files, err := fs.ReadDir(l.fsys, "entities")
 	if err != nil {
 		return nil, fmt.Errorf("failed to read entities directory: %w", err)
 	}
 
 	var names []string
 	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
+		if !file.IsDir() && isMockFile(file.Name()) {
 			names = append(names, file.Name())
 		}
 	}
@@ -142,15 +259,14 @@ func (l *Loader) ListEntities() ([]string, error) {
 
 // ListProducts returns a list of available product mock files
 func (l *Loader) ListProducts() ([]string, error) {
-	productsPath := filepath.Join(l.basePath, "products")
-	files, err := os.ReadDir(productsPath)
+	files, err := fs.ReadDir(l.fsys, "products")
 	if err != nil {
 		return nil, fmt.Errorf("failed to read products directory: %w", err)
 	}
 
 	var names []string
 	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
+		if !file.IsDir() && isMockFile(file.Name()) {
 			names = append(names, file.Name())
 		}
 	}
@@ -160,15 +276,14 @@ func (l *Loader) ListProducts() ([]string, error) {
 
 // ListScenarios returns a list of available scenario mock files
 func (l *Loader) ListScenarios() ([]string, error) {
-	scenariosPath := filepath.Join(l.basePath, "scenarios")
-	files, err := os.ReadDir(scenariosPath)
+	files, err := fs.ReadDir(l.fsys, "scenarios")
 	if err != nil {
 		return nil, fmt.Errorf("failed to read scenarios directory: %w", err)
 	}
 
 	var names []string
 	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
+		if !file.IsDir() && isMockFile(file.Name()) {
 			names = append(names, file.Name())
 		}
 	}
@@ -193,23 +308,69 @@ func (l *Loader) LoadEntitiesByRole(role generator.ClientRole) ([]generator.Clie
 	return filtered, nil
 }
 
-// BuildCustomScenario builds a custom scenario by selecting specific entities and products
-func (l *Loader) BuildCustomScenario(requestID string, entityFiles []string, productFiles []string) (*generator.GenerateRequest, error) {
+// ReassignRole rewrites every entity file whose role is from to use role to,
+// returning the number of files changed
+func (l *Loader) ReassignRole(from, to generator.ClientRole) (int, error) {
+	names, err := l.ListEntities()
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, name := range names {
+		entity, err := l.LoadEntity(name)
+		if err != nil {
+			return changed, err
+		}
+		entities := []generator.ClientEntity{*entity}
+		n, err := generator.ReassignRole(entities, from, to)
+		if err != nil {
+			return changed, err
+		}
+		if n == 0 {
+			continue
+		}
+		if err := l.SaveEntity(&entities[0], name); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+
+	return changed, nil
+}
+
+// BuildCustomScenario builds a custom scenario by selecting specific entities and products.
+// An entity or product whose id an earlier file already provided is skipped,
+// with a warning naming both files.
+func (l *Loader) BuildCustomScenario(requestID string, entityFiles []string, productFiles []string) (*generator.GenerateRequest, []string, error) {
+	var warnings []string
+	seen := map[string]string{}
 	entities := make([]generator.ClientEntity, 0, len(entityFiles))
 	for _, filename := range entityFiles {
 		entity, err := l.LoadEntity(filename)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		if first, dup := seen[entity.ID]; dup {
+			warnings = append(warnings, fmt.Sprintf("entity %q in %s already loaded from %s; skipped", entity.ID, filename, first))
+			continue
 		}
+		seen[entity.ID] = filename
 		entities = append(entities, *entity)
 	}
 
+	seen = map[string]string{}
 	products := make([]generator.ProductSpec, 0, len(productFiles))
 	for _, filename := range productFiles {
 		product, err := l.LoadProduct(filename)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
+		if first, dup := seen[product.ID]; dup {
+			warnings = append(warnings, fmt.Sprintf("product %q in %s already loaded from %s; skipped", product.ID, filename, first))
+			continue
+		}
+		seen[product.ID] = filename
 		products = append(products, *product)
 	}
 
@@ -219,48 +380,60 @@ func (l *Loader) BuildCustomScenario(requestID string, entityFiles []string, pro
 		Entities:  entities,
 		Products:  products,
 		Metadata:  make(map[string]interface{}),
-	}, nil
+	}, warnings, nil
 }
 
-// SaveEntity saves an entity to a JSON file
+// SaveEntity saves entity to filename as JSON, or as YAML if filename
+// ends in .yaml or .yml
 func (l *Loader) SaveEntity(entity *generator.ClientEntity, filename string) error {
-	path := filepath.Join(l.basePath, "entities", filename)
-	data, err := json.MarshalIndent(entity, "", "  ")
+	if l.basePath == "" {
+		return ErrReadOnly
+	}
+	target := filepath.Join(l.basePath, "entities", filename)
+	data, err := encode(entity, filename)
 	if err != nil {
 		return fmt.Errorf("failed to marshal entity: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	if err := os.WriteFile(target, data, 0644); err != nil {
 		return fmt.Errorf("failed to write entity file: %w", err)
 	}
 
 	return nil
 }
 
-// SaveProduct saves a product to a JSON file
+// SaveProduct saves product to filename as JSON, or as YAML if filename
+// ends in .yaml or .yml
 func (l *Loader) SaveProduct(product *generator.ProductSpec, filename string) error {
-	path := filepath.Join(l.basePath, "products", filename)
-	data, err := json.MarshalIndent(product, "", "  ")
+	if l.basePath == "" {
+		return ErrReadOnly
+	}
+	target := filepath.Join(l.basePath, "products", filename)
+	data, err := encode(product, filename)
 	if err != nil {
 		return fmt.Errorf("failed to marshal product: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	if err := os.WriteFile(target, data, 0644); err != nil {
 		return fmt.Errorf("failed to write product file: %w", err)
 	}
 
 	return nil
 }
 
-// SaveScenario saves a scenario to a JSON file
+// SaveScenario saves scenario to filename as JSON, or as YAML if filename
+// ends in .yaml or .yml
 func (l *Loader) SaveScenario(scenario *generator.GenerateRequest, filename string) error {
-	path := filepath.Join(l.basePath, "scenarios", filename)
-	data, err := json.MarshalIndent(scenario, "", "  ")
+	if l.basePath == "" {
+		return ErrReadOnly
+	}
+	target := filepath.Join(l.basePath, "scenarios", filename)
+	data, err := encode(scenario, filename)
 	if err != nil {
 		return fmt.Errorf("failed to marshal scenario: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	if err := os.WriteFile(target, data, 0644); err != nil {
 		return fmt.Errorf("failed to write scenario file: %w", err)
 	}
 
@@ -0,0 +1,278 @@
+package mocks
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/example/dsl-go/internal/generator"
+)
+
+const scenarioJSON = `{"request_id": "r1", "entities": [{"id": "le:A", "name": "A", "role": "sicav", "entity_type": "LegalEntity"}]}`
+
+const scenarioYAML = `request_id: r1
+entities:
+  - id: le:A
+    name: A
+    role: sicav
+    entity_type: LegalEntity
+`
+
+// writeFile writes data to name under dir, creating its directory.
+func writeFile(t *testing.T, dir, name, data string) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLoaderReadsFromBasePath(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "entities/a.json", `{"id": "le:A", "name": "A", "role": "sicav", "entity_type": "LegalEntity"}`)
+	writeFile(t, dir, "entities/b.yaml", "id: le:B\nname: B\nrole: sicav\nentity_type: LegalEntity\n")
+	writeFile(t, dir, "products/p.json", `{"id": "prod:p", "product_type": "custody"}`)
+	writeFile(t, dir, "scenarios/s.yml", scenarioYAML)
+
+	l := NewLoader(dir)
+	tests := []struct {
+		name string
+		load func() (string, error)
+		want string
+	}{
+		{"json entity", func() (string, error) {
+			e, err := l.LoadEntity("a.json")
+			if err != nil {
+				return "", err
+			}
+			return e.ID, nil
+		}, "le:A"},
+		{"yaml entity", func() (string, error) {
+			e, err := l.LoadEntity("b.yaml")
+			if err != nil {
+				return "", err
+			}
+			return e.ID, nil
+		}, "le:B"},
+		{"product", func() (string, error) {
+			p, err := l.LoadProduct("p.json")
+			if err != nil {
+				return "", err
+			}
+			return p.ID, nil
+		}, "prod:p"},
+		{"scenario", func() (string, error) {
+			s, err := l.LoadScenario("s.yml")
+			if err != nil {
+				return "", err
+			}
+			return s.RequestID, nil
+		}, "r1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadScenarioJSONAndYAMLAgree(t *testing.T) {
+	const asJSON = `{
+  "request_id": "r1",
+  "entities": [{
+    "id": "le:IM", "name": "IM", "role": "investment-manager", "entity_type": "LegalEntity",
+    "attributes": {"aum": 1500000000, "regulated": true, "rating": 4.5, "offices": {"hq": "LU"}}
+  }],
+  "products": [{"id": "custody", "product_type": "custody", "currency": "EUR", "config": {"segregated": false}}],
+  "metadata": {"source": "crm", "tags": ["new", "priority"]}
+}`
+	const asYAML = `request_id: r1
+entities:
+  - id: le:IM
+    name: IM
+    role: investment-manager
+    entity_type: LegalEntity
+    attributes:
+      aum: 1500000000
+      regulated: true
+      rating: 4.5
+      offices:
+        hq: LU
+products:
+  - id: custody
+    product_type: custody
+    currency: EUR
+    config:
+      segregated: false
+metadata:
+  source: crm
+  tags: [new, priority]
+`
+	dir := t.TempDir()
+	writeFile(t, dir, "scenarios/s.json", asJSON)
+	writeFile(t, dir, "scenarios/s.yaml", asYAML)
+	writeFile(t, dir, "scenarios/s.txt", asYAML)
+	l := NewLoader(dir)
+
+	want, err := l.LoadScenario("s.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, load := range map[string]func() (*generator.GenerateRequest, error){
+		"by extension": func() (*generator.GenerateRequest, error) { return l.LoadScenario("s.yaml") },
+		"explicitly":   func() (*generator.GenerateRequest, error) { return l.LoadScenarioYAML("s.txt") },
+	} {
+		got, err := load()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: YAML scenario = %+v, want the JSON one, %+v", name, got, want)
+		}
+	}
+}
+
+func TestDecodeScenario(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"json", scenarioJSON, ""},
+		{"yaml", scenarioYAML, "failed to parse scenario JSON"},
+		{"invalid UTF-8", "{\n\"request_id\": \"r\xff\"}", "invalid scenario: invalid UTF-8 on line 2"},
+		{"NUL byte", strings.Replace(scenarioJSON, `"name": "A"`, `"name": "A\u0000"`, 1), "invalid scenario: field entities[0].name contains a NUL byte"},
+		{"invalid scenario", `{"request_id": "r1"}`, "invalid scenario"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := DecodeScenario(strings.NewReader(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.RequestID != "r1" || len(s.Entities) != 1 || s.Entities[0].ID != "le:A" {
+				t.Errorf("scenario = %+v", s)
+			}
+		})
+	}
+}
+
+func TestLoadScenarioFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		wantErr string
+	}{
+		{"json", "s.json", scenarioJSON, ""},
+		{"yaml", "s.yaml", scenarioYAML, ""},
+		{"yml", "s.yml", scenarioYAML, ""},
+		{"yaml read as json", "s.json", scenarioYAML, "failed to parse scenario JSON"},
+		{"invalid UTF-8", "s.json", "{\n\"request_id\": \"r\xff\"}", "invalid UTF-8 on line 2"},
+		{"NUL byte", "s.yaml", strings.Replace(scenarioYAML, "name: A", `name: "A\0"`, 1), "field entities[0].name contains a NUL byte"},
+		{"invalid scenario", "s.json", `{"request_id": "r1"}`, "invalid scenario"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := writeFile(t, dir, tt.file, tt.data)
+			s, err := LoadScenarioFile(p)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.RequestID != "r1" || len(s.Entities) != 1 || s.Entities[0].ID != "le:A" {
+				t.Errorf("scenario = %+v", s)
+			}
+		})
+	}
+}
+
+func TestReassignRole(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "entities/a.json", `{"id": "le:A", "name": "A", "role": "administrator", "entity_type": "LegalEntity"}`)
+	writeFile(t, dir, "entities/b.yaml", "id: le:B\nname: B\nrole: administrator\nentity_type: LegalEntity\nlei: \"0123\"\n")
+	writeFile(t, dir, "entities/c.json", `{"id": "le:C", "name": "C", "role": "sicav", "entity_type": "LegalEntity"}`)
+	l := NewLoader(dir)
+
+	if _, err := l.ReassignRole(generator.RoleAdministrator, "manco"); err == nil {
+		t.Fatal("reassigning to an unknown role succeeded")
+	}
+	n, err := l.ReassignRole(generator.RoleAdministrator, generator.RoleManagementCompany)
+	if err != nil || n != 2 {
+		t.Fatalf("ReassignRole = %d, %v; want 2, nil", n, err)
+	}
+	want := map[string]generator.ClientRole{
+		"a.json": generator.RoleManagementCompany,
+		"b.yaml": generator.RoleManagementCompany,
+		"c.json": generator.RoleSicav,
+	}
+	for name, role := range want {
+		e, err := l.LoadEntity(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Role != role {
+			t.Errorf("%s: role = %s, want %s", name, e.Role, role)
+		}
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "entities", "b.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "id: le:B\nname: B\nrole: management-company\n") || !strings.Contains(string(b), `lei: "0123"`) {
+		t.Errorf("b.yaml was not rewritten as YAML:\n%s", b)
+	}
+}
+
+func TestBuildCustomScenarioSkipsDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "entities/a.json", `{"id": "le:A", "name": "A", "role": "sicav", "entity_type": "LegalEntity"}`)
+	writeFile(t, dir, "entities/a-copy.yaml", "id: le:A\nname: A copy\nrole: sicav\nentity_type: LegalEntity\n")
+	writeFile(t, dir, "products/p.json", `{"id": "prod:p", "product_type": "custody"}`)
+	l := NewLoader(dir)
+
+	s, warnings, err := l.BuildCustomScenario("r1",
+		[]string{"a.json", "a.json", "a-copy.yaml"},
+		[]string{"p.json", "p.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entities) != 1 || s.Entities[0].Name != "A" {
+		t.Errorf("entities = %+v, want only the first le:A", s.Entities)
+	}
+	if len(s.Products) != 1 {
+		t.Errorf("products = %+v, want one", s.Products)
+	}
+	want := []string{
+		`entity "le:A" in a.json already loaded from a.json; skipped`,
+		`entity "le:A" in a-copy.yaml already loaded from a.json; skipped`,
+		`product "prod:p" in p.json already loaded from p.json; skipped`,
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("warnings = %q, want %q", warnings, want)
+	}
+}
@@ -0,0 +1,97 @@
+package mocks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// isYAML reports whether filename has a .yaml or .yml extension.
+func isYAML(filename string) bool {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// isMockFile reports whether filename is a JSON or YAML mock file.
+func isMockFile(filename string) bool {
+	return strings.HasSuffix(filename, ".json") || isYAML(filename)
+}
+
+// unmarshalYAML decodes a YAML document into v through its JSON form, so the
+// json struct tags and custom JSON decoding of the generator types apply to
+// YAML exactly as they do to JSON.
+func unmarshalYAML(data []byte, v interface{}) error {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	data, err := json.Marshal(jsonCompatible(doc))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// marshalYAML encodes v as block-style YAML through its JSON form, the
+// inverse of unmarshalYAML: keys are named and ordered as in the JSON
+// encoding.
+func marshalYAML(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	// JSON is YAML, so decoding it into a node keeps the key order.
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	blockStyle(&doc)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// blockStyle clears the flow and quoting styles the JSON syntax gave n and
+// its descendants.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// jsonCompatible converts the mappings yaml.v3 decodes with non-string keys
+// into string-keyed maps that encoding/json can marshal.
+func jsonCompatible(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = jsonCompatible(item)
+		}
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[fmt.Sprint(k)] = jsonCompatible(item)
+		}
+		return out
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonCompatible(item)
+		}
+	}
+	return v
+}
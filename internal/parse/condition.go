@@ -0,0 +1,162 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/example/dsl-go/internal/ast"
+)
+
+// ParseGateCondition parses a gate condition such as
+// "all-kyc-complete AND (all-aml-clear OR manual-approval)". Operators are
+// NOT, AND and OR in that order of precedence, matched case-insensitively;
+// parentheses group. Every other word is a predicate name. Errors are
+// *ParseError with positions relative to the condition text.
+func ParseGateCondition(text string) (*ast.Condition, error) {
+	p := &condParser{tokens: condTokens(text), end: len(text)}
+	if len(p.tokens) == 0 {
+		return nil, p.errorf(0, "EOF", []string{"predicate"}, "empty condition")
+	}
+	c, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := p.peek(); ok {
+		return nil, p.errorf(t.offset, t.text, []string{"AND", "OR"}, "unexpected %q", t.text)
+	}
+	return c, nil
+}
+
+type condToken struct {
+	text   string
+	offset int
+}
+
+// condTokens splits text into parentheses and runs of other non-space bytes.
+func condTokens(text string) []condToken {
+	var tokens []condToken
+	for i := 0; i < len(text); {
+		switch c := text[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, condToken{text: text[i : i+1], offset: i})
+			i++
+		default:
+			start := i
+			for i < len(text) && !strings.ContainsRune(" \t\n\r()", rune(text[i])) {
+				i++
+			}
+			tokens = append(tokens, condToken{text: text[start:i], offset: start})
+		}
+	}
+	return tokens
+}
+
+type condParser struct {
+	tokens []condToken
+	end    int
+}
+
+func (p *condParser) peek() (condToken, bool) {
+	if len(p.tokens) == 0 {
+		return condToken{}, false
+	}
+	return p.tokens[0], true
+}
+
+// accept consumes the next token if it is the operator op.
+func (p *condParser) accept(op ast.CondOp) bool {
+	if t, ok := p.peek(); ok && strings.EqualFold(t.text, string(op)) {
+		p.tokens = p.tokens[1:]
+		return true
+	}
+	return false
+}
+
+func (p *condParser) or() (*ast.Condition, error) {
+	return p.binary(ast.CondOr, p.and)
+}
+
+func (p *condParser) and() (*ast.Condition, error) {
+	return p.binary(ast.CondAnd, p.not)
+}
+
+// binary parses operands joined by op into one node with every operand as an
+// argument, so "a AND b AND c" has three.
+func (p *condParser) binary(op ast.CondOp, operand func() (*ast.Condition, error)) (*ast.Condition, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	args := []*ast.Condition{first}
+	for p.accept(op) {
+		next, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, next)
+	}
+	if len(args) == 1 {
+		return first, nil
+	}
+	return &ast.Condition{Op: op, Args: args}, nil
+}
+
+func (p *condParser) not() (*ast.Condition, error) {
+	if p.accept(ast.CondNot) {
+		arg, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.Condition{Op: ast.CondNot, Args: []*ast.Condition{arg}}, nil
+	}
+	return p.primary()
+}
+
+func (p *condParser) primary() (*ast.Condition, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, p.errorf(p.end, "EOF", []string{"predicate", "NOT", "("}, "condition ends where a predicate was expected")
+	}
+	switch {
+	case t.text == "(":
+		p.tokens = p.tokens[1:]
+		c, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := p.peek(); !ok || t.text != ")" {
+			found, offset := "EOF", p.end
+			if ok {
+				found, offset = t.text, t.offset
+			}
+			return nil, p.errorf(offset, found, []string{")"}, "unclosed ( in condition")
+		}
+		p.tokens = p.tokens[1:]
+		return c, nil
+	case t.text == ")" || isCondOp(t.text):
+		return nil, p.errorf(t.offset, t.text, []string{"predicate", "NOT", "("}, "unexpected %q where a predicate was expected", t.text)
+	}
+	p.tokens = p.tokens[1:]
+	return &ast.Condition{Predicate: t.text}, nil
+}
+
+func isCondOp(s string) bool {
+	for _, op := range []ast.CondOp{ast.CondNot, ast.CondAnd, ast.CondOr} {
+		if strings.EqualFold(s, string(op)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *condParser) errorf(offset int, found string, expected []string, format string, args ...interface{}) *ParseError {
+	return &ParseError{
+		Position: lexer.Position{Offset: offset, Line: 1, Column: offset + 1},
+		Found:    found,
+		Expected: expected,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
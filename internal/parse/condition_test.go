@@ -0,0 +1,78 @@
+package parse
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/example/dsl-go/internal/ast"
+)
+
+// tree renders c in prefix form, such as AND(a, NOT(b)), so tests see its
+// structure rather than its canonical text.
+func tree(c *ast.Condition) string {
+	if c.Op == ast.CondPredicate {
+		return c.Predicate
+	}
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = tree(arg)
+	}
+	return string(c.Op) + "(" + strings.Join(args, ", ") + ")"
+}
+
+func TestParseGateCondition(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"all-kyc-complete", "all-kyc-complete"},
+		{"a AND b AND c", "AND(a, b, c)"},
+		{"a OR b AND c", "OR(a, AND(b, c))"},
+		{"NOT a AND b", "AND(NOT(a), b)"},
+		{"a and (b or not c)", "AND(a, OR(b, NOT(c)))"},
+		{"(a OR (b AND (c OR d)))", "OR(a, AND(b, OR(c, d)))"},
+		{"NOT NOT (a OR b)", "NOT(NOT(OR(a, b)))"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			c, err := ParseGateCondition(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tree(c); got != tt.want {
+				t.Errorf("ParseGateCondition(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGateConditionErrors(t *testing.T) {
+	tests := []struct {
+		in        string
+		wantCol   int
+		wantFound string
+		wantMsg   string
+	}{
+		{"", 1, "EOF", "empty condition"},
+		{"a AND", 6, "EOF", "condition ends where a predicate was expected"},
+		{"AND a", 1, "AND", `unexpected "AND" where a predicate was expected`},
+		{"a OR OR b", 6, "OR", `unexpected "OR" where a predicate was expected`},
+		{"(a AND b", 9, "EOF", "unclosed ( in condition"},
+		{"a b", 3, "b", `unexpected "b"`},
+		{"a)", 2, ")", `unexpected ")"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			_, err := ParseGateCondition(tt.in)
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("err = %v, want a *ParseError", err)
+			}
+			if perr.Column() != tt.wantCol || perr.Found != tt.wantFound || perr.Message != tt.wantMsg {
+				t.Errorf("got column %d, found %q, message %q; want %d, %q, %q",
+					perr.Column(), perr.Found, perr.Message, tt.wantCol, tt.wantFound, tt.wantMsg)
+			}
+		})
+	}
+}
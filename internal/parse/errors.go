@@ -0,0 +1,29 @@
+package parse
+
+import (
+	"fmt"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// ParseError is a syntax error with enough context for authoring tools to
+// point at the problem and suggest a fix.
+type ParseError struct {
+	Position lexer.Position
+	// Found is the offending token text ("EOF" at end of input).
+	Found string
+	// Expected is a best-effort list of tokens that would have been accepted
+	// at Position, derived from the grammar context of the failure.
+	Expected []string
+	Message  string
+}
+
+// Line returns the 1-based line of the error.
+func (e *ParseError) Line() int { return e.Position.Line }
+
+// Column returns the 1-based column of the error.
+func (e *ParseError) Column() int { return e.Position.Column }
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line(), e.Column(), e.Message)
+}
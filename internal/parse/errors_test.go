@@ -0,0 +1,41 @@
+package parse
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseErrorTokens(t *testing.T) {
+	const meta = "(onboarding-request\n  (:meta (request-id \"x\") (version 1))"
+	tests := []struct {
+		name         string
+		in           string
+		wantFound    string
+		wantExpected []string
+		wantMessage  string
+	}{
+		{"missing closing paren", meta + "\n", "EOF", []string{`")"`}, `unexpected token "<EOF>" (expected ")")`},
+		{"extra closing paren", meta + ")\n)", ")", nil, `unexpected token ")"`},
+		{"misspelt section", meta + "\n  (:orchestrator (:lifecyle)))", "(:lifecyle ...)",
+			[]string{"(:lifecycle", "(:entities", "(:resources", "(:flows", "(:policies", "(:product-service-mappings"},
+			"unexpected (:lifecyle ...) in (:orchestrator ...)"},
+	}
+	p, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.Parse(tt.in)
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("err = %v, want a *ParseError", err)
+			}
+			if perr.Found != tt.wantFound || strings.Join(perr.Expected, " ") != strings.Join(tt.wantExpected, " ") || perr.Message != tt.wantMessage {
+				t.Errorf("got found %q, expected %q, message %q; want %q, %q, %q",
+					perr.Found, perr.Expected, perr.Message, tt.wantFound, tt.wantExpected, tt.wantMessage)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package parse_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/example/dsl-go/internal/parse"
+	"github.com/example/dsl-go/internal/print"
+)
+
+// addExamples seeds f with every document under examples/.
+func addExamples(f *testing.F) {
+	paths, err := filepath.Glob("../../examples/*.sexpr")
+	if err != nil {
+		f.Fatal(err)
+	}
+	if len(paths) == 0 {
+		f.Fatal("no examples found")
+	}
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(data))
+	}
+	f.Add("")
+	f.Add("(")
+	f.Add(`(onboarding-request (:meta (request-id "x")))`)
+}
+
+// FuzzParse checks that the parser returns an error rather than panicking,
+// whatever the input.
+func FuzzParse(f *testing.F) {
+	addExamples(f)
+	f.Fuzz(func(t *testing.T, text string) {
+		req, err := parse.ParseReader(strings.NewReader(text))
+		if err == nil && req == nil {
+			t.Fatal("nil request without an error")
+		}
+	})
+}
+
+// FuzzRoundTrip checks that a document that parses prints to text that
+// parses back to the same request. Positions differ between the two parses,
+// so the requests are compared by their printed form.
+func FuzzRoundTrip(f *testing.F) {
+	addExamples(f)
+	f.Fuzz(func(t *testing.T, text string) {
+		req, err := parse.ParseReader(strings.NewReader(text))
+		if err != nil {
+			return
+		}
+		printed := print.ToSexpr(req)
+		again, err := parse.ParseReader(strings.NewReader(printed))
+		if err != nil {
+			t.Fatalf("printed document does not parse: %v\n%s", err, printed)
+		}
+		if reprinted := print.ToSexpr(again); reprinted != printed {
+			t.Fatalf("round trip changed the request:\nfirst:\n%s\nsecond:\n%s", printed, reprinted)
+		}
+	})
+}
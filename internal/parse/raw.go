@@ -0,0 +1,70 @@
+package parse
+
+import (
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// Sexpr is a generic S-expression node: either a parenthesised list or a
+// single atom. It carries no DSL semantics, so it can be built for any
+// balanced input and inspected even when the strict parser would reject it.
+type Sexpr struct {
+	Pos    lexer.Position
+	EndPos lexer.Position
+
+	IsList bool
+	List   []*Sexpr
+	Atom   *Atom
+
+	// Comments are the comment lines, each with its leading ';', directly
+	// before the node.
+	Comments []string
+}
+
+// Atom is a single token. Exactly one field is set, recording the token kind.
+type Atom struct {
+	Pos lexer.Position
+
+	String   *string
+	Keyword  *string
+	Symbol   *string // identifiers and ->
+	Number   *string // integers and floats
+	Duration *string
+}
+
+// Text returns the atom's source text (unquoted for strings).
+func (a *Atom) Text() string {
+	switch {
+	case a.String != nil:
+		return *a.String
+	case a.Keyword != nil:
+		return *a.Keyword
+	case a.Symbol != nil:
+		return *a.Symbol
+	case a.Number != nil:
+		return *a.Number
+	case a.Duration != nil:
+		return *a.Duration
+	}
+	return ""
+}
+
+// Head returns the text of the first element of a list whose first element
+// is a symbol or keyword atom, or "" otherwise.
+func (s *Sexpr) Head() string {
+	if !s.IsList || len(s.List) == 0 || s.List[0].Atom == nil {
+		return ""
+	}
+	a := s.List[0].Atom
+	if a.Symbol == nil && a.Keyword == nil {
+		return ""
+	}
+	return a.Text()
+}
+
+// ParseRaw parses text into a generic S-expression tree without applying the
+// DSL grammar. Only lexical errors and unbalanced parentheses are reported.
+func ParseRaw(text string) (*Sexpr, error) {
+	return ParseRawReader(strings.NewReader(text))
+}
@@ -0,0 +1,50 @@
+package parse
+
+import (
+	"fmt"
+	"sort"
+)
+
+// sectionParsers maps each orchestrator sub-section that can be parsed on its
+// own to the function building its AST. These sections are self-contained:
+// their contents do not depend on anything declared elsewhere in the document.
+var sectionParsers = map[string]func(*Sexpr) (interface{}, error){
+	":lifecycle": func(x *Sexpr) (interface{}, error) { return parseLifecycle(x) },
+	":entities":  func(x *Sexpr) (interface{}, error) { return parseItems(x, "entity", parseEntity) },
+	":resources": func(x *Sexpr) (interface{}, error) { return parseItems(x, "resource", parseResource) },
+	":flows":     func(x *Sexpr) (interface{}, error) { return parseItems(x, "flow", parseFlow) },
+	":policies":  func(x *Sexpr) (interface{}, error) { return parseItems(x, "policy", parsePolicy) },
+	":product-service-mappings": func(x *Sexpr) (interface{}, error) {
+		return parseItems(x, "mapping", parseMapping)
+	},
+}
+
+// Sections returns the orchestrator sub-sections ParseSection accepts.
+func Sections() []string {
+	names := make([]string, 0, len(sectionParsers))
+	for name := range sectionParsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseSection parses text holding a single orchestrator sub-section, e.g.
+// "(:entities (entity ...))", without the rest of the document. It returns
+// *ast.Lifecycle for :lifecycle and a slice of the section's items
+// ([]*ast.Entity, []*ast.Resource, []*ast.Flow, []*ast.Policy or
+// []*ast.ProductServiceMapping) otherwise.
+func ParseSection(text string, section string) (interface{}, error) {
+	build, ok := sectionParsers[section]
+	if !ok {
+		return nil, fmt.Errorf("section %s cannot be parsed on its own (want one of %v)", section, Sections())
+	}
+	root, err := ParseRaw(text)
+	if err != nil {
+		return nil, err
+	}
+	if root.Head() != section {
+		return nil, errorf(root, "expected a (%s ...) form, got %s", section, found(root))
+	}
+	return build(root)
+}
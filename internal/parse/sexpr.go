@@ -1,47 +1,956 @@
 package parse
 
 import (
-	"github.com/alecthomas/participle/v2"
-	"github.com/alecthomas/participle/v2/lexer"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/example/dsl-go/internal/ast"
 )
 
-var sexprLexer = lexer.MustSimple([]lexer.SimpleRule{
-	{Name: "Whitespace", Pattern: `\s+`},
-	{Name: "Comment", Pattern: `\;[^\n]*`},
-	{Name: "LParen", Pattern: `\(`},
-	{Name: "RParen", Pattern: `\)`},
-	{Name: "Arrow", Pattern: `->`},
-	{Name: "String", Pattern: `"(?:\\.|[^\"])*"`},
-	{Name: "ColonIdent", Pattern: `:[A-Za-z][A-Za-z0-9_-]*`},
-	{Name: "Ident", Pattern: `[A-Za-z][A-Za-z0-9_-]*`},
-	{Name: "Number", Pattern: `[0-9]+(?:\.[0-9]+)?`}, // Add number support
-})
-
 // Parser interface
 type Parser interface {
 	Parse(text string) (*ast.Request, error)
 }
 
-// ParticipleParser is a parser that uses participle
-type ParticipleParser struct {
-	parser *participle.Parser[ast.Request]
-}
+// SexprParser parses text into the generic Sexpr tree and then maps that
+// tree onto the AST, so the documented grammar (see internal/ebnf) is the
+// single source of the document shape.
+type SexprParser struct{}
 
-// New creates a new participle parser
+// New creates a new S-expression parser
 func New() (Parser, error) {
-	parser, err := participle.Build[ast.Request](
-		participle.Lexer(sexprLexer),
-		participle.Unquote("String"),
-		participle.Elide("Whitespace", "Comment"),
-	)
+	return &SexprParser{}, nil
+}
+
+// Parse parses the given text into an AST; see ParseReader.
+func (p *SexprParser) Parse(text string) (*ast.Request, error) {
+	return ParseReader(strings.NewReader(text))
+}
+
+// canonicalTime applies ast.CanonicalTime, leaving unset timestamps unset.
+func canonicalTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return ast.CanonicalTime(t)
+}
+
+func errorf(x *Sexpr, format string, args ...interface{}) *ParseError {
+	return &ParseError{Position: x.Pos, Found: found(x), Message: fmt.Sprintf(format, args...)}
+}
+
+func found(x *Sexpr) string {
+	if x.IsList {
+		if h := x.Head(); h != "" {
+			return "(" + h + " ...)"
+		}
+		return "list"
+	}
+	return strconv.Quote(x.Atom.Text())
+}
+
+// parseItems maps every element after the head of form, each of which must
+// be an (item ...) form.
+func parseItems[T any](form *Sexpr, item string, mapItem func(*Sexpr) (T, error)) ([]T, error) {
+	var out []T
+	for _, x := range form.List[1:] {
+		if x.Head() != item {
+			return nil, errorf(x, "expected (%s ...) in (%s ...), got %s", item, form.Head(), found(x))
+		}
+		v, err := mapItem(x)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// fields splits the elements of form from start on into ":key value" pairs
+// and the remaining positional elements, and checks that every key in
+// required is present.
+func fields(form *Sexpr, start int, required ...string) (map[string]*Sexpr, []*Sexpr, error) {
+	kw := map[string]*Sexpr{}
+	var rest []*Sexpr
+	items := form.List[start:]
+	for i := 0; i < len(items); i++ {
+		x := items[i]
+		if x.Atom == nil || x.Atom.Keyword == nil {
+			rest = append(rest, x)
+			continue
+		}
+		if i+1 >= len(items) {
+			return nil, nil, errorf(x, "keyword %s in (%s ...) has no value", *x.Atom.Keyword, form.Head())
+		}
+		i++
+		kw[*x.Atom.Keyword] = items[i]
+	}
+	for _, r := range required {
+		if kw[r] == nil {
+			return nil, nil, errorf(form, "(%s ...) is missing %s", form.Head(), r)
+		}
+	}
+	return kw, rest, nil
+}
+
+// subForms indexes the list elements of rest by head, rejecting heads not in
+// allowed, repeated heads and any other element.
+func subForms(form *Sexpr, rest []*Sexpr, allowed ...string) (map[string]*Sexpr, error) {
+	out := map[string]*Sexpr{}
+	for _, x := range rest {
+		head := x.Head()
+		ok := false
+		for _, a := range allowed {
+			ok = ok || head == a
+		}
+		if !ok {
+			err := errorf(x, "unexpected %s in (%s ...)", found(x), form.Head())
+			for _, a := range allowed {
+				err.Expected = append(err.Expected, "("+a)
+			}
+			return nil, err
+		}
+		if out[head] != nil {
+			return nil, errorf(x, "duplicate (%s ...) in (%s ...)", head, form.Head())
+		}
+		out[head] = x
+	}
+	return out, nil
+}
+
+func str(x *Sexpr, what string) (string, error) {
+	if x.Atom == nil || x.Atom.String == nil {
+		return "", errorf(x, "%s must be a string, got %s", what, found(x))
+	}
+	return *x.Atom.String, nil
+}
+
+func ident(x *Sexpr, what string) (string, error) {
+	if x.Atom == nil || x.Atom.Symbol == nil {
+		return "", errorf(x, "%s must be an identifier, got %s", what, found(x))
+	}
+	return *x.Atom.Symbol, nil
+}
+
+// atomList maps the elements after the head of form with conv.
+func atomList(form *Sexpr, conv func(*Sexpr, string) (string, error)) ([]string, error) {
+	var out []string
+	for _, x := range form.List[1:] {
+		s, err := conv(x, "("+form.Head()+" ...) element")
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// atomValue maps a value atom. Integers become Int, numbers with a fraction
+// Float, and the identifiers true and false Bool.
+func atomValue(x *Sexpr) (*ast.Value, error) {
+	a := x.Atom
+	if a == nil {
+		return nil, errorf(x, "expected a value, got %s", found(x))
+	}
+	v := &ast.Value{Pos: x.Pos}
+	switch {
+	case a.String != nil:
+		v.String = a.String
+	case a.Number != nil:
+		if i, err := strconv.ParseInt(*a.Number, 10, 64); err == nil {
+			v.Int = &i
+		} else if f, err := strconv.ParseFloat(*a.Number, 64); err == nil {
+			v.Float = &f
+		} else {
+			return nil, errorf(x, "invalid number %s", *a.Number)
+		}
+	case a.Duration != nil:
+		d, err := ast.ParseDuration(*a.Duration)
+		if err != nil {
+			return nil, errorf(x, "%v", err)
+		}
+		v.Duration = &d
+	case a.Symbol != nil && (*a.Symbol == "true" || *a.Symbol == "false"):
+		b := *a.Symbol == "true"
+		v.Bool = &b
+	case a.Symbol != nil:
+		v.Symbol = a.Symbol
+	default:
+		return nil, errorf(x, "expected a value, got %s", found(x))
+	}
+	return v, nil
+}
+
+// parseKVs maps (key value) pairs, as used by args, config and policies.
+func parseKVs(form *Sexpr, items []*Sexpr) ([]*ast.KVPair, error) {
+	var out []*ast.KVPair
+	for _, x := range items {
+		if x.Head() == "" || len(x.List) != 2 {
+			return nil, errorf(x, "expected (key value) in (%s ...), got %s", form.Head(), found(x))
+		}
+		v, err := atomValue(x.List[1])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, &ast.KVPair{Pos: x.Pos, Key: x.Head(), Value: v})
+	}
+	return out, nil
+}
+
+// parseConfig maps the entries of (config ...): (key value) pairs, or
+// (key (sub value) ...) for a nested Map value, which may nest again.
+func parseConfig(form *Sexpr, items []*Sexpr) ([]*ast.KVPair, error) {
+	var out []*ast.KVPair
+	for _, x := range items {
+		if x.Head() == "" || len(x.List) < 2 {
+			return nil, errorf(x, "expected (key value) in (%s ...), got %s", form.Head(), found(x))
+		}
+		if !x.List[1].IsList {
+			kv, err := parseKVs(form, []*Sexpr{x})
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, kv...)
+			continue
+		}
+		m, err := parseConfig(x, x.List[1:])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, &ast.KVPair{Pos: x.Pos, Key: x.Head(), Value: &ast.Value{Pos: x.List[1].Pos, Map: m}})
+	}
+	return out, nil
+}
+
+// requireForms reports the first of names missing from subs.
+func requireForms(form *Sexpr, subs map[string]*Sexpr, names ...string) error {
+	for _, n := range names {
+		if subs[n] == nil {
+			return errorf(form, "(%s ...) is missing (%s ...)", form.Head(), n)
+		}
+	}
+	return nil
+}
+
+// single returns the only element after the head of form.
+func single(form *Sexpr) (*Sexpr, error) {
+	if len(form.List) != 2 {
+		return nil, errorf(form, "(%s ...) takes exactly one value", form.Head())
+	}
+	return form.List[1], nil
+}
+
+func boolean(x *Sexpr, what string) (bool, error) {
+	if x.Atom == nil || x.Atom.Symbol == nil || (*x.Atom.Symbol != "true" && *x.Atom.Symbol != "false") {
+		return false, errorf(x, "%s must be true or false, got %s", what, found(x))
+	}
+	return *x.Atom.Symbol == "true", nil
+}
+
+func parseRequest(root *Sexpr) (*ast.Request, error) {
+	if root.Head() != "onboarding-request" {
+		return nil, errorf(root, "document must be an (onboarding-request ...) form, got %s", found(root))
+	}
+	subs, err := subForms(root, root.List[1:], ":meta", ":orchestrator", ":catalog")
+	if err != nil {
+		return nil, err
+	}
+	if err := requireForms(root, subs, ":meta", ":orchestrator"); err != nil {
+		return nil, err
+	}
+	req := &ast.Request{Pos: root.Pos, Comments: root.Comments}
+	if req.Meta, err = parseMeta(subs[":meta"]); err != nil {
+		return nil, err
+	}
+	if req.Orchestrator, err = parseOrchestrator(subs[":orchestrator"]); err != nil {
+		return nil, err
+	}
+	if c := subs[":catalog"]; c != nil {
+		if req.Catalog, err = parseCatalog(c); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+func parseMeta(form *Sexpr) (*ast.Meta, error) {
+	subs, err := subForms(form, form.List[1:], "request-id", "version", "created-at", "updated-at")
+	if err != nil {
+		return nil, err
+	}
+	if err := requireForms(form, subs, "request-id", "version"); err != nil {
+		return nil, err
+	}
+	meta := &ast.Meta{Pos: form.Pos}
+	x, err := single(subs["request-id"])
+	if err != nil {
+		return nil, err
+	}
+	if meta.RequestID, err = str(x, "request-id"); err != nil {
+		return nil, err
+	}
+	if x, err = single(subs["version"]); err != nil {
+		return nil, err
+	}
+	if x.Atom == nil || x.Atom.Number == nil {
+		return nil, errorf(x, "version must be a number, got %s", found(x))
+	}
+	if meta.Version, err = strconv.ParseUint(*x.Atom.Number, 10, 64); err != nil {
+		return nil, errorf(x, "invalid version %s", *x.Atom.Number)
+	}
+	for key, t := range map[string]*time.Time{"created-at": &meta.CreatedAt, "updated-at": &meta.UpdatedAt} {
+		if subs[key] == nil {
+			continue
+		}
+		if *t, err = timestamp(subs[key]); err != nil {
+			return nil, err
+		}
+	}
+	return meta, nil
+}
+
+// timestamp maps a (name "RFC 3339 time") form.
+func timestamp(form *Sexpr) (time.Time, error) {
+	x, err := single(form)
+	if err != nil {
+		return time.Time{}, err
+	}
+	s, err := str(x, form.Head())
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, errorf(x, "invalid %s: %v", form.Head(), err)
+	}
+	return t, nil
+}
+
+func parseOrchestrator(form *Sexpr) (*ast.Orchestrator, error) {
+	subs, err := subForms(form, form.List[1:], ":lifecycle", ":entities", ":resources", ":flows", ":policies", ":product-service-mappings")
+	if err != nil {
+		return nil, err
+	}
+	if err := requireForms(form, subs, ":lifecycle"); err != nil {
+		return nil, err
+	}
+	o := &ast.Orchestrator{Pos: form.Pos}
+	if o.Lifecycle, err = parseLifecycle(subs[":lifecycle"]); err != nil {
+		return nil, err
+	}
+	if x := subs[":entities"]; x != nil {
+		if o.Entities, err = parseItems(x, "entity", parseEntity); err != nil {
+			return nil, err
+		}
+	}
+	if x := subs[":resources"]; x != nil {
+		if o.Resources, err = parseItems(x, "resource", parseResource); err != nil {
+			return nil, err
+		}
+	}
+	if x := subs[":flows"]; x != nil {
+		if o.Flows, err = parseItems(x, "flow", parseFlow); err != nil {
+			return nil, err
+		}
+	}
+	if x := subs[":policies"]; x != nil {
+		if o.Policies, err = parseItems(x, "policy", parsePolicy); err != nil {
+			return nil, err
+		}
+	}
+	if x := subs[":product-service-mappings"]; x != nil {
+		if o.ProductServiceMappings, err = parseItems(x, "mapping", parseMapping); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+func parseLifecycle(form *Sexpr) (*ast.Lifecycle, error) {
+	subs, err := subForms(form, form.List[1:], "states", "initial", "transitions")
+	if err != nil {
+		return nil, err
+	}
+	if err := requireForms(form, subs, "states", "initial", "transitions"); err != nil {
+		return nil, err
+	}
+	lc := &ast.Lifecycle{Pos: form.Pos}
+	if lc.States, err = atomList(subs["states"], ident); err != nil {
+		return nil, err
+	}
+	initial, err := single(subs["initial"])
+	if err != nil {
+		return nil, err
+	}
+	if lc.Initial, err = ident(initial, "initial state"); err != nil {
+		return nil, err
+	}
+	lc.Transitions, err = parseItems(subs["transitions"], "->", parseTransition)
+	if err != nil {
+		return nil, err
+	}
+	return lc, nil
+}
+
+func parseTransition(form *Sexpr) (*ast.Transition, error) {
+	if len(form.List) < 3 {
+		return nil, errorf(form, "transition must name a from and a to state")
+	}
+	t := &ast.Transition{Pos: form.Pos}
+	var err error
+	if t.From, err = ident(form.List[1], "transition source"); err != nil {
+		return nil, err
+	}
+	if t.To, err = ident(form.List[2], "transition target"); err != nil {
+		return nil, err
+	}
+	subs, err := subForms(form, form.List[3:], "when", "do")
+	if err != nil {
+		return nil, err
+	}
+	if w := subs["when"]; w != nil {
+		if t.Guard, err = parseExpr(w); err != nil {
+			return nil, err
+		}
+	}
+	if do := subs["do"]; do != nil {
+		for _, x := range do.List[1:] {
+			if x.Head() == "" {
+				return nil, errorf(x, "expected (action ...) in (do ...), got %s", found(x))
+			}
+			args, err := parseKVs(x, x.List[1:])
+			if err != nil {
+				return nil, err
+			}
+			t.Effects = append(t.Effects, &ast.ActionCall{Pos: x.Pos, Name: x.Head(), Args: args})
+		}
+	}
+	return t, nil
+}
+
+// parseExpr maps a (when kind ["path"]) guard.
+func parseExpr(form *Sexpr) (*ast.Expr, error) {
+	if len(form.List) < 2 || len(form.List) > 3 {
+		return nil, errorf(form, "(when ...) must hold a condition and an optional path")
+	}
+	e := &ast.Expr{Pos: form.List[1].Pos}
+	var err error
+	if e.Kind, err = ident(form.List[1], "condition"); err != nil {
+		return nil, err
+	}
+	if len(form.List) == 3 {
+		if e.Path, err = str(form.List[2], "condition path"); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func parseEntity(form *Sexpr) (*ast.Entity, error) {
+	kw, rest, err := fields(form, 1, ":id", ":type")
+	if err != nil {
+		return nil, err
+	}
+	if err := unknownKeys(form, kw, ":id", ":type"); err != nil {
+		return nil, err
+	}
+	e := &ast.Entity{Pos: form.Pos, Comments: form.Comments}
+	if e.ID, err = str(kw[":id"], ":id"); err != nil {
+		return nil, err
+	}
+	if e.Typ, err = ident(kw[":type"], ":type"); err != nil {
+		return nil, err
+	}
+	subs, err := subForms(form, rest, "tags", "attrs")
+	if err != nil {
+		return nil, err
+	}
+	if x := subs["tags"]; x != nil {
+		if e.Tags, err = atomList(x, ident); err != nil {
+			return nil, err
+		}
+	}
+	attrs := subs["attrs"]
+	if attrs == nil {
+		return nil, errorf(form, "(entity ...) is missing (attrs ...)")
+	}
+	for _, x := range attrs.List[1:] {
+		a, err := parseAttr(x)
+		if err != nil {
+			return nil, err
+		}
+		e.Attrs = append(e.Attrs, a)
+	}
+	return e, nil
+}
+
+func parseAttr(form *Sexpr) (*ast.AttrVal, error) {
+	if form.Head() == "" || len(form.List) < 2 {
+		return nil, errorf(form, "expected (name value) in (attrs ...), got %s", found(form))
+	}
+	v, err := atomValue(form.List[1])
+	if err != nil {
+		return nil, err
+	}
+	a := &ast.AttrVal{Pos: form.Pos, Key: form.Head(), Value: v, Comments: form.Comments}
+	kw, rest, err := fields(form, 2)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errorf(rest[0], "unexpected %s in attribute %s", found(rest[0]), a.Key)
+	}
+	if err := unknownKeys(form, kw, ":provenance", ":needed-by", ":superseded-at"); err != nil {
+		return nil, err
+	}
+	if x := kw[":provenance"]; x != nil {
+		p, err := str(x, ":provenance")
+		if err != nil {
+			return nil, err
+		}
+		a.Provenance = &p
+	}
+	if x := kw[":needed-by"]; x != nil {
+		if a.NeededBy, err = identList(x, ":needed-by"); err != nil {
+			return nil, err
+		}
+	}
+	if x := kw[":superseded-at"]; x != nil {
+		s, err := str(x, ":superseded-at")
+		if err != nil {
+			return nil, err
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, errorf(x, "invalid :superseded-at: %v", err)
+		}
+		t = canonicalTime(t)
+		a.SupersededAt = &t
+	}
+	return a, nil
+}
+
+func parseResource(form *Sexpr) (*ast.Resource, error) {
+	kw, rest, err := fields(form, 1, ":id", ":type")
+	if err != nil {
+		return nil, err
+	}
+	if err := unknownKeys(form, kw, ":id", ":type"); err != nil {
+		return nil, err
+	}
+	r := &ast.Resource{Pos: form.Pos, Comments: form.Comments}
+	if r.ID, err = str(kw[":id"], ":id"); err != nil {
+		return nil, err
+	}
+	if r.Typ, err = ident(kw[":type"], ":type"); err != nil {
+		return nil, err
+	}
+	subs, err := subForms(form, rest, "requires", "config")
+	if err != nil {
+		return nil, err
+	}
+	if req := subs["requires"]; req != nil {
+		for _, x := range req.List[1:] {
+			head := x.Head()
+			if (head != "entity" && head != "resource") || len(x.List) != 2 {
+				return nil, errorf(x, "expected (entity \"id\") or (resource \"id\") in (requires ...), got %s", found(x))
+			}
+			id, err := str(x.List[1], "required id")
+			if err != nil {
+				return nil, err
+			}
+			r.Requires = append(r.Requires, &ast.RequireItem{Pos: x.Pos, Kind: head, ID: id})
+		}
+	}
+	if cfg := subs["config"]; cfg != nil {
+		if r.Config, err = parseConfig(cfg, cfg.List[1:]); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func parseFlow(form *Sexpr) (*ast.Flow, error) {
+	kw, rest, err := fields(form, 1, ":id")
 	if err != nil {
 		return nil, err
 	}
-	return &ParticipleParser{parser: parser}, nil
+	if err := unknownKeys(form, kw, ":id"); err != nil {
+		return nil, err
+	}
+	f := &ast.Flow{Pos: form.Pos, Comments: form.Comments}
+	if f.ID, err = str(kw[":id"], ":id"); err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 && rest[0].Atom != nil && rest[0].Atom.String != nil {
+		f.Doc = rest[0].Atom.String
+		rest = rest[1:]
+	}
+	subs, err := subForms(form, rest, "steps")
+	if err != nil {
+		return nil, err
+	}
+	steps := subs["steps"]
+	if steps == nil {
+		return nil, errorf(form, "(flow ...) is missing (steps ...)")
+	}
+	for _, x := range steps.List[1:] {
+		s, err := parseStep(x)
+		if err != nil {
+			return nil, err
+		}
+		f.Steps = append(f.Steps, s)
+	}
+	return f, nil
+}
+
+func parseStep(form *Sexpr) (*ast.Step, error) {
+	s := &ast.Step{Pos: form.Pos, Comments: form.Comments}
+	var err error
+	switch form.Head() {
+	case "task":
+		s.Task, err = parseTask(form)
+	case "gate":
+		s.Gate, err = parseGate(form)
+	case "fork":
+		var id string
+		var branches []string
+		if id, branches, err = parseIDList(form, "branches"); err == nil {
+			s.Fork = &ast.Fork{Pos: form.Pos, ID: id, Branches: branches}
+		}
+	case "join":
+		var id string
+		var after []string
+		if id, after, err = parseIDList(form, "after"); err == nil {
+			s.Join = &ast.Join{Pos: form.Pos, ID: id, After: after}
+		}
+	default:
+		return nil, errorf(form, "expected (task ...), (gate ...), (fork ...) or (join ...) in (steps ...), got %s", found(form))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
 }
 
-// Parse parses the given text into an AST
-func (p *ParticipleParser) Parse(text string) (*ast.Request, error) {
-	return p.parser.ParseString("", text)
+func parseTask(form *Sexpr) (*ast.Task, error) {
+	kw, rest, err := fields(form, 1, ":id", ":on", ":op")
+	if err != nil {
+		return nil, err
+	}
+	if err := unknownKeys(form, kw, ":id", ":on", ":op"); err != nil {
+		return nil, err
+	}
+	t := &ast.Task{Pos: form.Pos}
+	if t.ID, err = str(kw[":id"], ":id"); err != nil {
+		return nil, err
+	}
+	if t.On, err = str(kw[":on"], ":on"); err != nil {
+		return nil, err
+	}
+	if t.Op, err = ident(kw[":op"], ":op"); err != nil {
+		return nil, err
+	}
+	subs, err := subForms(form, rest, "args", "needs", "produces", "labels")
+	if err != nil {
+		return nil, err
+	}
+	if args := subs["args"]; args != nil {
+		if t.Args, err = parseKVs(args, args.List[1:]); err != nil {
+			return nil, err
+		}
+	}
+	if x := subs["needs"]; x != nil {
+		if t.Needs, err = atomList(x, str); err != nil {
+			return nil, err
+		}
+	}
+	if x := subs["produces"]; x != nil {
+		if t.Produces, err = atomList(x, str); err != nil {
+			return nil, err
+		}
+	}
+	if x := subs["labels"]; x != nil {
+		if t.Labels, err = atomList(x, ident); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func parseGate(form *Sexpr) (*ast.Gate, error) {
+	kw, rest, err := fields(form, 1, ":id")
+	if err != nil {
+		return nil, err
+	}
+	if err := unknownKeys(form, kw, ":id"); err != nil {
+		return nil, err
+	}
+	g := &ast.Gate{Pos: form.Pos}
+	if g.ID, err = str(kw[":id"], ":id"); err != nil {
+		return nil, err
+	}
+	subs, err := subForms(form, rest, "when")
+	if err != nil {
+		return nil, err
+	}
+	w := subs["when"]
+	if w == nil || len(w.List) != 2 {
+		return nil, errorf(form, "(gate ...) needs a (when \"condition\")")
+	}
+	if g.Condition, err = str(w.List[1], "gate condition"); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// parseIDList maps the shared shape of fork and join: an :id and one list of
+// step ids.
+func parseIDList(form *Sexpr, list string) (string, []string, error) {
+	kw, rest, err := fields(form, 1, ":id")
+	if err != nil {
+		return "", nil, err
+	}
+	if err := unknownKeys(form, kw, ":id"); err != nil {
+		return "", nil, err
+	}
+	id, err := str(kw[":id"], ":id")
+	if err != nil {
+		return "", nil, err
+	}
+	subs, err := subForms(form, rest, list)
+	if err != nil {
+		return "", nil, err
+	}
+	if subs[list] == nil {
+		return "", nil, errorf(form, "(%s ...) is missing (%s ...)", form.Head(), list)
+	}
+	ids, err := atomList(subs[list], str)
+	if err != nil {
+		return "", nil, err
+	}
+	return id, ids, nil
+}
+
+func parsePolicy(form *Sexpr) (*ast.Policy, error) {
+	if len(form.List) < 2 {
+		return nil, errorf(form, "(policy ...) must be named")
+	}
+	name, err := ident(form.List[1], "policy name")
+	if err != nil {
+		return nil, err
+	}
+	kv, err := parseKVs(form, form.List[2:])
+	if err != nil {
+		return nil, err
+	}
+	return &ast.Policy{Pos: form.Pos, Name: name, KV: kv}, nil
+}
+
+func parseCatalog(form *Sexpr) (*ast.Catalog, error) {
+	subs, err := subForms(form, form.List[1:], ":attributes", ":actions")
+	if err != nil {
+		return nil, err
+	}
+	if err := requireForms(form, subs, ":attributes", ":actions"); err != nil {
+		return nil, err
+	}
+	c := &ast.Catalog{Pos: form.Pos}
+	for _, x := range subs[":attributes"].List[1:] {
+		d, err := parseAttrDef(x)
+		if err != nil {
+			return nil, err
+		}
+		c.Attributes = append(c.Attributes, d)
+	}
+	for _, x := range subs[":actions"].List[1:] {
+		d, err := parseActionDef(x)
+		if err != nil {
+			return nil, err
+		}
+		c.Actions = append(c.Actions, d)
+	}
+	return c, nil
+}
+
+func parseAttrDef(form *Sexpr) (*ast.AttrDef, error) {
+	if form.Head() == "" {
+		return nil, errorf(form, "expected (name :type ...) in (:attributes ...), got %s", found(form))
+	}
+	kw, rest, err := fields(form, 1, ":type")
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errorf(rest[0], "unexpected %s in attribute definition %s", found(rest[0]), form.Head())
+	}
+	d := &ast.AttrDef{Pos: form.Pos, Name: form.Head()}
+	if d.Typ, err = ident(kw[":type"], ":type"); err != nil {
+		return nil, err
+	}
+	if x := kw[":enum"]; x != nil {
+		if d.Enum, err = identList(x, ":enum"); err != nil {
+			return nil, err
+		}
+	}
+	if x := kw[":format"]; x != nil {
+		f, err := ident(x, ":format")
+		if err != nil {
+			return nil, err
+		}
+		d.Format = &f
+	}
+	if x := kw[":pii"]; x != nil {
+		b, err := boolean(x, ":pii")
+		if err != nil {
+			return nil, err
+		}
+		d.PII = &b
+	}
+	if err := unknownKeys(form, kw, ":type", ":enum", ":format", ":pii"); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func parseActionDef(form *Sexpr) (*ast.ActionDef, error) {
+	if form.Head() == "" {
+		return nil, errorf(form, "expected (name (params ...) ...) in (:actions ...), got %s", found(form))
+	}
+	subs, err := subForms(form, form.List[1:], "params", "needs", "produces")
+	if err != nil {
+		return nil, err
+	}
+	if err := requireForms(form, subs, "params", "needs", "produces"); err != nil {
+		return nil, err
+	}
+	d := &ast.ActionDef{Pos: form.Pos, Name: form.Head()}
+	for _, x := range subs["params"].List[1:] {
+		p, err := parseParamDef(x)
+		if err != nil {
+			return nil, err
+		}
+		d.Params = append(d.Params, p)
+	}
+	if d.Needs, err = atomList(subs["needs"], str); err != nil {
+		return nil, err
+	}
+	if d.Produces, err = atomList(subs["produces"], str); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func parseParamDef(form *Sexpr) (*ast.ParamDef, error) {
+	if form.Head() == "" {
+		return nil, errorf(form, "expected (name :type ...) in (params ...), got %s", found(form))
+	}
+	kw, rest, err := fields(form, 1, ":type")
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errorf(rest[0], "unexpected %s in parameter %s", found(rest[0]), form.Head())
+	}
+	p := &ast.ParamDef{Pos: form.Pos, Name: form.Head()}
+	if p.Typ, err = ident(kw[":type"], ":type"); err != nil {
+		return nil, err
+	}
+	if x := kw[":required"]; x != nil {
+		b, err := boolean(x, ":required")
+		if err != nil {
+			return nil, err
+		}
+		p.Required = &b
+	}
+	if x := kw[":enum"]; x != nil {
+		if p.Enum, err = identList(x, ":enum"); err != nil {
+			return nil, err
+		}
+	}
+	if err := unknownKeys(form, kw, ":type", ":required", ":enum"); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// parseMapping maps a (mapping :product "..." [:services (...)]
+// [:resources (...)]) form of the product-service mappings.
+func parseMapping(form *Sexpr) (*ast.ProductServiceMapping, error) {
+	kw, rest, err := fields(form, 1, ":product")
+	if err != nil {
+		return nil, err
+	}
+	if err := unknownKeys(form, kw, ":product", ":services", ":resources"); err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errorf(rest[0], "unexpected %s in (mapping ...)", found(rest[0]))
+	}
+	m := &ast.ProductServiceMapping{Pos: form.Pos}
+	if m.Product, err = str(kw[":product"], ":product"); err != nil {
+		return nil, err
+	}
+	if x := kw[":services"]; x != nil {
+		if m.Services, err = stringList(x, ":services"); err != nil {
+			return nil, err
+		}
+	}
+	if x := kw[":resources"]; x != nil {
+		if m.Resources, err = stringList(x, ":resources"); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func stringList(x *Sexpr, what string) ([]string, error) {
+	if !x.IsList {
+		return nil, errorf(x, "%s must be a list of strings, got %s", what, found(x))
+	}
+	var out []string
+	for _, n := range x.List {
+		s, err := str(n, what+" element")
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// identList maps a bare list of identifiers, as used by :enum and :needed-by.
+func identList(x *Sexpr, what string) ([]string, error) {
+	if !x.IsList {
+		return nil, errorf(x, "%s must be a list of identifiers, got %s", what, found(x))
+	}
+	var out []string
+	for _, n := range x.List {
+		s, err := ident(n, what+" element")
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// unknownKeys reports the first keyword of kw, in source order, not in known.
+func unknownKeys(form *Sexpr, kw map[string]*Sexpr, known ...string) error {
+	for _, x := range form.List[1:] {
+		if x.Atom == nil || x.Atom.Keyword == nil {
+			continue
+		}
+		key := *x.Atom.Keyword
+		ok := false
+		for _, k := range known {
+			ok = ok || key == k
+		}
+		if !ok {
+			return errorf(x, "unknown keyword %s in (%s ...)", key, form.Head())
+		}
+	}
+	return nil
 }
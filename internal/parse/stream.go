@@ -0,0 +1,550 @@
+package parse
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/example/dsl-go/internal/ast"
+)
+
+// ParseReader parses the document read from r into an AST. The raw tree is
+// built straight from the token stream, so the document is never held in
+// memory as a whole.
+func ParseReader(r io.Reader) (*ast.Request, error) {
+	root, err := ParseRawReader(r)
+	if err != nil {
+		return nil, err
+	}
+	req, err := parseRequest(root)
+	if err != nil {
+		return nil, err
+	}
+	req.Meta.CreatedAt = canonicalTime(req.Meta.CreatedAt)
+	req.Meta.UpdatedAt = canonicalTime(req.Meta.UpdatedAt)
+	return req, nil
+}
+
+// ParseRawReader is ParseRaw for a document read from r. Tokens are scanned
+// one at a time from a small buffer rather than from the whole text.
+func ParseRawReader(r io.Reader) (*Sexpr, error) {
+	p := &streamParser{s: newScanner(r)}
+	root, err := p.parse()
+	if err != nil {
+		return nil, p.firstError(err)
+	}
+	return root, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokLParen
+	tokRParen
+	tokArrow
+	tokString
+	tokKeyword
+	tokDuration
+	tokIdent
+	tokNumber
+)
+
+type token struct {
+	kind  tokenKind
+	pos   lexer.Position
+	value string // unquoted for strings
+	// comments are the comment lines between the previous token and this one.
+	comments []string
+}
+
+// text returns the token as a syntax error names it.
+func (t token) text() string {
+	if t.kind == tokEOF {
+		return "<EOF>"
+	}
+	return t.value
+}
+
+// scanner splits a document into the tokens of the DSL lexer: whitespace and
+// comments are skipped, and the rules are tried in the same order (arrow,
+// string, keyword, duration, identifier, float, number).
+type scanner struct {
+	r   *bufio.Reader
+	pos lexer.Position
+	buf []byte // text of the token being scanned
+	// comments collects the comment lines skipped since the last token.
+	comments []string
+	// pending is a token already scanned, returned by the next call to token.
+	pending *token
+	// end is the position just after the last token returned.
+	end lexer.Position
+}
+
+func newScanner(r io.Reader) *scanner {
+	return &scanner{r: bufio.NewReader(r), pos: lexer.Position{Line: 1, Column: 1}}
+}
+
+// peek returns the i-th rune ahead without consuming it, or -1 at the end of
+// the input.
+func (s *scanner) peek(i int) (rune, error) {
+	off := 0
+	for {
+		b, err := s.r.Peek(off + utf8.UTFMax)
+		if len(b) <= off {
+			if err == io.EOF || err == nil {
+				return -1, nil
+			}
+			return -1, err
+		}
+		r, size := utf8.DecodeRune(b[off:])
+		if i == 0 {
+			return r, nil
+		}
+		off += size
+		i--
+	}
+}
+
+// next consumes one rune, appending its bytes to the token text.
+func (s *scanner) next() {
+	b, _ := s.r.Peek(utf8.UTFMax)
+	r, size := utf8.DecodeRune(b)
+	s.buf = append(s.buf, b[:size]...)
+	_, _ = s.r.Discard(size)
+	s.pos.Offset += size
+	if r == '\n' {
+		s.pos.Line++
+		s.pos.Column = 1
+	} else {
+		s.pos.Column++
+	}
+}
+
+// nextWhile consumes runes while ok holds and returns how many it consumed.
+func (s *scanner) nextWhile(ok func(rune) bool) (int, error) {
+	n := 0
+	for {
+		r, err := s.peek(0)
+		if err != nil {
+			return n, err
+		}
+		if r < 0 || !ok(r) {
+			return n, nil
+		}
+		s.next()
+		n++
+	}
+}
+
+func isSpace(r rune) bool  { return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' }
+func isDigit(r rune) bool  { return r >= '0' && r <= '9' }
+func isLetter(r rune) bool { return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') }
+func isIdentRune(r rune) bool {
+	return isLetter(r) || isDigit(r) || r == '_' || r == '-'
+}
+
+// token returns the next token.
+func (s *scanner) token() (token, error) {
+	if t := s.pending; t != nil {
+		s.pending = nil
+		s.end = s.pos
+		return *t, nil
+	}
+	t, err := s.scan()
+	s.end = s.pos
+	if s.pending != nil {
+		s.end = s.pending.pos
+	}
+	return t, err
+}
+
+// scan scans the next token from the input.
+func (s *scanner) scan() (token, error) {
+	for {
+		r, err := s.peek(0)
+		if err != nil {
+			return token{}, err
+		}
+		switch {
+		case isSpace(r):
+			if _, err := s.nextWhile(isSpace); err != nil {
+				return token{}, err
+			}
+			continue
+		case r == ';':
+			s.buf = s.buf[:0]
+			if _, err := s.nextWhile(func(r rune) bool { return r != '\n' }); err != nil {
+				return token{}, err
+			}
+			s.comments = append(s.comments, strings.TrimRight(string(s.buf), "\r"))
+			continue
+		}
+		break
+	}
+	s.buf = s.buf[:0]
+	pos := s.pos
+	r, err := s.peek(0)
+	if err != nil {
+		return token{}, err
+	}
+	comments := s.comments
+	s.comments = nil
+	kind := tokEOF
+	switch {
+	case r < 0:
+		return token{kind: tokEOF, pos: pos, comments: comments}, nil
+	case r == '(':
+		s.next()
+		kind = tokLParen
+	case r == ')':
+		s.next()
+		kind = tokRParen
+	case r == '"':
+		t, err := s.str(pos)
+		t.comments = comments
+		return t, err
+	case r == ':':
+		r1, err := s.peek(1)
+		if err != nil {
+			return token{}, err
+		}
+		if !isLetter(r1) {
+			return token{}, s.invalid(pos)
+		}
+		s.next()
+		if _, err := s.nextWhile(isIdentRune); err != nil {
+			return token{}, err
+		}
+		kind = tokKeyword
+	case r == '-':
+		r1, err := s.peek(1)
+		if err != nil {
+			return token{}, err
+		}
+		switch {
+		case r1 == '>':
+			s.next()
+			s.next()
+			kind = tokArrow
+		case isDigit(r1):
+			s.next()
+			if kind, err = s.number(); err != nil {
+				return token{}, err
+			}
+		default:
+			return token{}, s.invalid(pos)
+		}
+	case isDigit(r):
+		if kind, err = s.duration(); err != nil {
+			return token{}, err
+		}
+	case isLetter(r):
+		if _, err := s.nextWhile(isIdentRune); err != nil {
+			return token{}, err
+		}
+		kind = tokIdent
+	default:
+		return token{}, s.invalid(pos)
+	}
+	return token{kind: kind, pos: pos, value: string(s.buf), comments: comments}, nil
+}
+
+// number scans the digits of a float or integer, after any sign.
+func (s *scanner) number() (tokenKind, error) {
+	if _, err := s.nextWhile(isDigit); err != nil {
+		return 0, err
+	}
+	r, err := s.peek(0)
+	if err != nil {
+		return 0, err
+	}
+	r1, err := s.peek(1)
+	if err != nil {
+		return 0, err
+	}
+	if r != '.' || !isDigit(r1) {
+		return tokNumber, nil
+	}
+	s.next()
+	if _, err := s.nextWhile(isDigit); err != nil {
+		return 0, err
+	}
+	return tokNumber, nil
+}
+
+// duration scans a duration, one or more "digits[.digits]unit" parts, or
+// a number if the first part has no unit. Parts are consumed as they are
+// read, so the lookahead stays within the reader's buffer however long the
+// digit runs are; a later part without a unit is left as a pending number.
+func (s *scanner) duration() (tokenKind, error) {
+	kind := tokNumber
+	for {
+		r, err := s.peek(0)
+		if err != nil {
+			return 0, err
+		}
+		if !isDigit(r) {
+			return kind, nil
+		}
+		pos, start := s.pos, len(s.buf)
+		if _, err := s.number(); err != nil {
+			return 0, err
+		}
+		unit, err := s.unitLen()
+		if err != nil {
+			return 0, err
+		}
+		if unit == 0 {
+			if kind == tokDuration {
+				s.pending = &token{kind: tokNumber, pos: pos, value: string(s.buf[start:])}
+				s.buf = s.buf[:start]
+			}
+			return kind, nil
+		}
+		for k := 0; k < unit; k++ {
+			s.next()
+		}
+		kind = tokDuration
+	}
+}
+
+// unitLen returns the length of the duration unit that follows, or 0.
+func (s *scanner) unitLen() (int, error) {
+	r, err := s.peek(0)
+	if err != nil {
+		return 0, err
+	}
+	r1, err := s.peek(1)
+	if err != nil {
+		return 0, err
+	}
+	if (r == 'n' || r == 'u' || r == 'm') && r1 == 's' {
+		return 2, nil
+	}
+	switch r {
+	case 's', 'm', 'h', 'd':
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// str scans a string token. As in the lexer's pattern, a backslash escapes
+// the next character; if no closing quote follows, the token ends at the
+// last escaped quote, which leaves it impossible to unquote.
+func (s *scanner) str(pos lexer.Position) (token, error) {
+	s.next()
+	lastEscapedQuote := -1
+	for {
+		r, err := s.peek(0)
+		if err != nil {
+			return token{}, err
+		}
+		switch {
+		case r < 0:
+			if lastEscapedQuote < 0 {
+				return token{}, s.invalidAt(pos, string(s.buf))
+			}
+			raw := string(s.buf[:lastEscapedQuote+1])
+			return token{}, &ParseError{Position: pos, Message: fmt.Sprintf("invalid quoted string %q: %s", raw, strconv.ErrSyntax)}
+		case r == '"':
+			s.next()
+			raw := string(s.buf)
+			value, err := unquote(raw)
+			if err != nil {
+				return token{}, &ParseError{Position: pos, Message: fmt.Sprintf("invalid quoted string %q: %s", raw, err)}
+			}
+			return token{kind: tokString, pos: pos, value: value}, nil
+		case r == '\\':
+			r1, err := s.peek(1)
+			if err != nil {
+				return token{}, err
+			}
+			s.next()
+			if r1 >= 0 && r1 != '\n' {
+				if r1 == '"' {
+					lastEscapedQuote = len(s.buf)
+				}
+				s.next()
+			}
+		default:
+			s.next()
+		}
+	}
+}
+
+// unquote decodes the escapes of a double-quoted string. The escape set is
+// Go's, so strings printed with %q read back unchanged: \a \b \f \n \r \t
+// \v \\ \", octal \ooo and hex \xhh bytes, and \uhhhh and \Uhhhhhhhh code
+// points. Other text, including UTF-8, is taken literally.
+func unquote(raw string) (string, error) {
+	s := raw[1 : len(raw)-1]
+	var out strings.Builder
+	for s != "" {
+		r, multibyte, tail, err := strconv.UnquoteChar(s, '"')
+		if err != nil {
+			return "", err
+		}
+		if r < utf8.RuneSelf || !multibyte {
+			// A byte escape such as \xff stands for the byte itself, which
+			// need not be valid UTF-8.
+			out.WriteByte(byte(r))
+		} else {
+			out.WriteRune(r)
+		}
+		s = tail
+	}
+	return out.String(), nil
+}
+
+// invalid reports the text at pos as matching no token.
+func (s *scanner) invalid(pos lexer.Position) error {
+	return s.invalidAt(pos, "")
+}
+
+// invalidAt is invalid for text whose first runes, consumed, are prefix.
+func (s *scanner) invalidAt(pos lexer.Position, prefix string) error {
+	sample := []rune(prefix)
+	for i := 0; len(sample) <= 16; i++ {
+		r, err := s.peek(i)
+		if err != nil {
+			return err
+		}
+		if r < 0 {
+			break
+		}
+		sample = append(sample, r)
+	}
+	if len(sample) > 16 {
+		sample = append(sample[:16], []rune("...")...)
+	}
+	return &ParseError{Position: pos, Message: fmt.Sprintf("invalid input text %q", string(sample))}
+}
+
+// streamParser builds the raw tree from scanner tokens.
+type streamParser struct {
+	s *scanner
+	// syntax is set once a token has been found out of place.
+	syntax bool
+}
+
+func (p *streamParser) parse() (*Sexpr, error) {
+	t, err := p.s.token()
+	if err != nil {
+		return nil, err
+	}
+	root, err := p.sexpr(t, true)
+	if err != nil {
+		return nil, err
+	}
+	if t, err = p.s.token(); err != nil {
+		return nil, err
+	}
+	if t.kind != tokEOF {
+		return nil, p.unexpected(t)
+	}
+	return root, nil
+}
+
+// noMatch reports a list that hit the end of the input before any element.
+// Like participle, which only commits to a branch once it has consumed more
+// than its opening token, the error is then raised by the enclosing list at
+// the opening parenthesis of this one.
+type noMatch struct {
+	open token
+}
+
+func (e *noMatch) Error() string { return "no match" }
+
+// sexpr parses the expression starting with t; root is set for the document.
+func (p *streamParser) sexpr(t token, root bool) (*Sexpr, error) {
+	x := &Sexpr{Pos: t.pos, Comments: t.comments}
+	switch t.kind {
+	case tokLParen:
+		open := t
+		x.IsList = true
+		for {
+			t, err := p.s.token()
+			if err != nil {
+				return nil, err
+			}
+			switch t.kind {
+			case tokRParen:
+				x.EndPos = p.s.end
+				return x, nil
+			case tokEOF:
+				if len(x.List) == 0 && !root {
+					return nil, &noMatch{open: open}
+				}
+				return nil, p.expectedClose(t)
+			}
+			item, err := p.sexpr(t, false)
+			if nm, ok := err.(*noMatch); ok {
+				if len(x.List) == 0 && !root {
+					return nil, &noMatch{open: open}
+				}
+				return nil, p.expectedClose(nm.open)
+			} else if err != nil {
+				return nil, err
+			}
+			x.List = append(x.List, item)
+		}
+	case tokEOF, tokRParen:
+		return nil, p.unexpected(t)
+	}
+	value := t.value
+	a := &Atom{Pos: t.pos}
+	switch t.kind {
+	case tokString:
+		a.String = &value
+	case tokKeyword:
+		a.Keyword = &value
+	case tokIdent, tokArrow:
+		a.Symbol = &value
+	case tokNumber:
+		a.Number = &value
+	case tokDuration:
+		a.Duration = &value
+	}
+	x.Atom = a
+	x.EndPos = p.s.end
+	return x, nil
+}
+
+// expectedClose reports t where a list's closing parenthesis was expected.
+func (p *streamParser) expectedClose(t token) *ParseError {
+	e := p.unexpected(t)
+	e.Message += ` (expected ")")`
+	e.Expected = []string{`")"`}
+	return e
+}
+
+func (p *streamParser) unexpected(t token) *ParseError {
+	p.syntax = true
+	found := t.value
+	if t.kind == tokEOF {
+		found = "EOF"
+	}
+	return &ParseError{Position: t.pos, Found: found, Message: fmt.Sprintf("unexpected token %q", t.text())}
+}
+
+// firstError returns the first lexical error after a syntax error, if there
+// is one, since an invalid token is reported ahead of the syntax it breaks.
+func (p *streamParser) firstError(err error) error {
+	if !p.syntax {
+		return err
+	}
+	for {
+		t, lexErr := p.s.token()
+		if lexErr != nil {
+			return lexErr
+		}
+		if t.kind == tokEOF {
+			return err
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// tokenKinds maps the kinds a scanner test names to their tokens.
+var tokenKinds = map[tokenKind]string{
+	tokLParen: "lparen", tokRParen: "rparen", tokArrow: "arrow", tokString: "string",
+	tokKeyword: "keyword", tokDuration: "duration", tokIdent: "ident", tokNumber: "number",
+}
+
+// scanAll returns the tokens of text as "kind:value", up to EOF.
+func scanAll(text string) ([]string, error) {
+	s := newScanner(strings.NewReader(text))
+	var out []string
+	for {
+		t, err := s.token()
+		if err != nil {
+			return out, err
+		}
+		if t.kind == tokEOF {
+			return out, nil
+		}
+		out = append(out, tokenKinds[t.kind]+":"+t.value)
+	}
+}
+
+func TestScannerNumbersAndDurations(t *testing.T) {
+	digits := strings.Repeat("7", 10000)
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"42", []string{"number:42"}},
+		{"-42.5", []string{"number:-42.5"}},
+		{"30s", []string{"duration:30s"}},
+		{"1.5h", []string{"duration:1.5h"}},
+		{"1h30m", []string{"duration:1h30m"}},
+		{"250ms", []string{"duration:250ms"}},
+		{"1h30", []string{"duration:1h", "number:30"}},
+		{"1h30.5x", []string{"duration:1h", "number:30.5", "ident:x"}},
+		{"(a 2d 3)", []string{"lparen:(", "ident:a", "duration:2d", "number:3", "rparen:)"}},
+		{digits, []string{"number:" + digits}},
+		{digits + "." + digits, []string{"number:" + digits + "." + digits}},
+		{digits + "s", []string{"duration:" + digits + "s"}},
+		{"1h" + digits, []string{"duration:1h", "number:" + digits}},
+	}
+	for _, tt := range tests {
+		name := tt.in
+		if len(name) > 20 {
+			name = name[:20] + "..."
+		}
+		t.Run(name, func(t *testing.T) {
+			got, err := scanAll(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("tokens = %.80q, want %.80q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNumberConfigValues(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"5", "int 5"},
+		{"-5", "int -5"},
+		{"0.5", "float 0.5"},
+		{"-0.5", "float -0.5"},
+		{"-12.25", "float -12.25"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			doc := `(onboarding-request
+  (:meta (request-id "x") (version 1))
+  (:orchestrator
+    (:lifecycle (states draft) (initial draft) (transitions))
+    (:entities)
+    (:resources (resource :id "r" :type Account (config (threshold ` + tt.in + `))))
+    (:flows)))`
+			req, err := ParseReader(strings.NewReader(doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			v := req.Orchestrator.Resources[0].Config[0].Value
+			var got string
+			switch {
+			case v.Int != nil:
+				got = fmt.Sprint("int ", *v.Int)
+			case v.Float != nil:
+				got = fmt.Sprint("float ", *v.Float)
+			}
+			if got != tt.want {
+				t.Errorf("(threshold %s) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSexprEndPos(t *testing.T) {
+	root, err := ParseRaw("(a 1h30)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		x       *Sexpr
+		wantEnd int
+	}{
+		{root, 8},
+		{root.List[1], 5},
+		{root.List[2], 7},
+	}
+	for _, tt := range tests {
+		if tt.x.EndPos.Offset != tt.wantEnd {
+			t.Errorf("%s ends at %d, want %d", tt.x.Pos, tt.x.EndPos.Offset, tt.wantEnd)
+		}
+	}
+}
+
+// largeDocument returns a valid document of at least size bytes, padded
+// with entities.
+func largeDocument(size int) string {
+	var b strings.Builder
+	b.WriteString(`(onboarding-request
+  (:meta (request-id "big") (version 1))
+  (:orchestrator
+    (:lifecycle (states draft done) (initial draft) (transitions (-> draft done)))
+    (:entities`)
+	for i := 0; b.Len() < size; i++ {
+		fmt.Fprintf(&b, `
+      ; entity %d
+      (entity :id "le:%d" :type LegalEntity
+        (attrs (name "Entity %d" :provenance "registry") (country GB) (employees %d) (rating 4.5)))`, i, i, i, i)
+	}
+	b.WriteString(`)
+    (:resources)
+    (:flows)))
+`)
+	return b.String()
+}
+
+func BenchmarkParseReader5MB(b *testing.B) {
+	doc := largeDocument(5 << 20)
+	b.SetBytes(int64(len(doc)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseReader(strings.NewReader(doc)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{`"plain"`, "plain", false},
+		{`"a\"b"`, `a"b`, false},
+		{`"a\\b"`, `a\b`, false},
+		{`"\a\b\f\n\r\t\v"`, "\a\b\f\n\r\t\v", false},
+		{`"\101\x42"`, "AB", false},
+		{`"\xff"`, "\xff", false},
+		{`"é\U0001F680"`, "é🚀", false},
+		{`"é literal"`, "é literal", false},
+		{`"\q"`, "", true},
+		{`"\u12"`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := scanAll(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("tokens = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0] != "string:"+tt.want {
+				t.Errorf("tokens = %q, want [string:%q]", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimestampsAreCanonical(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"whole seconds", "2025-10-28T10:05:00Z", "2025-10-28T10:05:00Z"},
+		{"fraction is truncated", "2025-10-28T10:05:00.987654321Z", "2025-10-28T10:05:00Z"},
+		{"offset becomes UTC", "2025-10-28T12:05:00.5+02:00", "2025-10-28T10:05:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := `(onboarding-request
+  (:meta (request-id "x") (version 1) (created-at "` + tt.in + `") (updated-at "` + tt.in + `"))
+  (:orchestrator
+    (:lifecycle (states draft) (initial draft) (transitions))
+    (:entities
+      (entity :id "le:A" :type LegalEntity
+        (attrs (name "A" :superseded-at "` + tt.in + `"))))
+    (:resources)
+    (:flows)))`
+			req, err := ParseReader(strings.NewReader(doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := time.Parse(time.RFC3339, tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a := req.Orchestrator.Entities[0].Attrs[0]
+			got := map[string]time.Time{
+				"created-at":    req.Meta.CreatedAt,
+				"updated-at":    req.Meta.UpdatedAt,
+				"superseded-at": *a.SupersededAt,
+			}
+			for field, g := range got {
+				if !g.Equal(want) || g.Location() != time.UTC {
+					t.Errorf("%s = %v, want %v UTC", field, g, want)
+				}
+			}
+		})
+	}
+}
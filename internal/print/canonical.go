@@ -0,0 +1,63 @@
+package print
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/example/dsl-go/internal/ast"
+)
+
+// ToCanonicalSexpr returns the S-expression form of req with the parts whose
+// order carries no meaning sorted: entities and resources by id, attributes
+// and config pairs by key, at every level of a nested config value. Two requests that differ only in those orders print
+// to the same bytes, so the result is suitable for hashing. Sorting is stable,
+// so the history of a repeated attribute key keeps its order. req is not
+// modified. Comments are left out, as they carry no meaning either.
+func ToCanonicalSexpr(req *ast.Request) string {
+	var b strings.Builder
+	if req.Orchestrator == nil {
+		_ = write(&b, req, false)
+		return b.String()
+	}
+	orch := *req.Orchestrator
+
+	orch.Entities = make([]*ast.Entity, len(req.Orchestrator.Entities))
+	for i, e := range req.Orchestrator.Entities {
+		cp := *e
+		cp.Attrs = append([]*ast.AttrVal(nil), e.Attrs...)
+		sort.SliceStable(cp.Attrs, func(i, j int) bool { return cp.Attrs[i].Key < cp.Attrs[j].Key })
+		orch.Entities[i] = &cp
+	}
+	sort.SliceStable(orch.Entities, func(i, j int) bool { return orch.Entities[i].ID < orch.Entities[j].ID })
+
+	orch.Resources = make([]*ast.Resource, len(req.Orchestrator.Resources))
+	for i, r := range req.Orchestrator.Resources {
+		cp := *r
+		cp.Config = sortedKVs(r.Config)
+		orch.Resources[i] = &cp
+	}
+	sort.SliceStable(orch.Resources, func(i, j int) bool { return orch.Resources[i].ID < orch.Resources[j].ID })
+
+	cp := *req
+	cp.Orchestrator = &orch
+	_ = write(&b, &cp, false)
+	return b.String()
+}
+
+// sortedKVs returns a copy of kvs sorted by key, with the entries of every
+// nested Map value sorted the same way.
+func sortedKVs(kvs []*ast.KVPair) []*ast.KVPair {
+	out := make([]*ast.KVPair, len(kvs))
+	for i, kv := range kvs {
+		if kv.Value != nil && kv.Value.Map != nil {
+			v := *kv.Value
+			v.Map = sortedKVs(kv.Value.Map)
+			cp := *kv
+			cp.Value = &v
+			kv = &cp
+		}
+		out[i] = kv
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
@@ -0,0 +1,85 @@
+package print_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/example/dsl-go/internal/ast"
+	"github.com/example/dsl-go/internal/parse"
+	"github.com/example/dsl-go/internal/print"
+)
+
+// doc returns a minimal document with the given entities and resources.
+func doc(entities, resources string) string {
+	return `(onboarding-request
+  (:meta (request-id "x") (version 1))
+  (:orchestrator
+    (:lifecycle (states draft) (initial draft) (transitions))
+    (:entities ` + entities + `)
+    (:resources ` + resources + `)
+    (:flows)))`
+}
+
+func mustParse(t testing.TB, text string) *ast.Request {
+	t.Helper()
+	req, err := parse.ParseReader(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestToCanonicalSexprIgnoresOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{
+			"entities and attributes",
+			doc(`(entity :id "le:A" :type LegalEntity (attrs (name "A") (country GB)))
+			     (entity :id "le:B" :type LegalEntity (attrs))`, ""),
+			doc(`(entity :id "le:B" :type LegalEntity (attrs))
+			     (entity :id "le:A" :type LegalEntity (attrs (country GB) (name "A")))`, ""),
+		},
+		{
+			"top-level config",
+			doc("", `(resource :id "r" :type Account (config (currency EUR) (limit 10)))`),
+			doc("", `(resource :id "r" :type Account (config (limit 10) (currency EUR)))`),
+		},
+		{
+			"nested config",
+			doc("", `(resource :id "r" :type Account (config (limits (daily 10) (monthly 100))))`),
+			doc("", `(resource :id "r" :type Account (config (limits (monthly 100) (daily 10))))`),
+		},
+		{
+			"deeply nested config",
+			doc("", `(resource :id "r" :type Account (config (z 1) (a (y (q 1) (p 2)) (x 3))))`),
+			doc("", `(resource :id "r" :type Account (config (a (x 3) (y (p 2) (q 1))) (z 1)))`),
+		},
+		{
+			"comments",
+			doc("; first\n(entity :id \"le:A\" :type LegalEntity (attrs))", ""),
+			doc("(entity :id \"le:A\" :type LegalEntity (attrs))", ""),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := print.ToCanonicalSexpr(mustParse(t, tt.a))
+			b := print.ToCanonicalSexpr(mustParse(t, tt.b))
+			if a != b {
+				t.Errorf("canonical forms differ:\n%s\n---\n%s", a, b)
+			}
+		})
+	}
+}
+
+func TestToCanonicalSexprLeavesRequestUnchanged(t *testing.T) {
+	text := doc(`(entity :id "le:B" :type LegalEntity (attrs)) (entity :id "le:A" :type LegalEntity (attrs))`,
+		`(resource :id "r" :type Account (config (b 1) (a (d 1) (c 2))))`)
+	req := mustParse(t, text)
+	before := print.ToSexpr(req)
+	_ = print.ToCanonicalSexpr(req)
+	if after := print.ToSexpr(req); after != before {
+		t.Errorf("request changed:\n%s\n---\n%s", before, after)
+	}
+}
@@ -0,0 +1,61 @@
+package print
+
+import (
+	"io"
+	"strings"
+
+	"github.com/example/dsl-go/internal/ast"
+)
+
+// ToSexprCompact returns the S-expression form of req on a single line, with
+// one space between atoms and none inside parentheses. It parses to the same
+// AST as ToSexpr, except that comments, which need a line of their own, are
+// left out.
+func ToSexprCompact(req *ast.Request) string {
+	var b strings.Builder
+	_ = write(&compactWriter{out: &b}, req, false)
+	return b.String()
+}
+
+// compactWriter passes S-expression text through to out with runs of
+// whitespace outside strings reduced to the single space that separates two
+// atoms, and dropped next to parentheses.
+type compactWriter struct {
+	out      io.Writer
+	last     byte // last byte written, 0 at the start
+	space    bool // whitespace seen since last
+	inString bool
+	escaped  bool
+}
+
+func (c *compactWriter) Write(p []byte) (int, error) {
+	buf := make([]byte, 0, len(p))
+	for _, b := range p {
+		switch {
+		case c.inString:
+			switch {
+			case c.escaped:
+				c.escaped = false
+			case b == '\\':
+				c.escaped = true
+			case b == '"':
+				c.inString = false
+			}
+		case b == ' ' || b == '\t' || b == '\n' || b == '\r':
+			c.space = true
+			continue
+		default:
+			if c.space && c.last != 0 && c.last != '(' && b != ')' {
+				buf = append(buf, ' ')
+			}
+			c.space = false
+			c.inString = b == '"'
+		}
+		buf = append(buf, b)
+		c.last = b
+	}
+	if _, err := c.out.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,56 @@
+package print_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/example/dsl-go/internal/print"
+)
+
+// compactDoc exercises every section the printers emit.
+const compactDoc = `(onboarding-request
+  (:meta (request-id "x") (version 3) (created-at "2025-01-02T03:04:05Z"))
+  (:orchestrator
+    (:lifecycle (states draft active) (initial draft) (transitions (-> draft active)))
+    (:entities
+      (entity :id "le:A" :type LegalEntity
+        (attrs
+          (name "A \"quoted\"" :provenance "registry" :needed-by (kyc aml))
+          (employees -12)
+          (rating 4.5)
+          (regulated true))))
+    (:resources
+      (resource :id "acct" :type Account (requires (entity "le:A")) (config (currency EUR) (timeout 30s) (limits (daily 100)))))
+    (:flows
+      (flow :id "main" "Opens the account."
+        (steps
+          (fork :id "f" (branches "a" "b"))
+          (task :id "a" :on "acct" :op open-account (args (level "full")) (produces "acct.open"))
+          (task :id "b" :on "acct" :op fund (args) (needs "acct.open"))
+          (join :id "j" (after "a" "b"))
+          (gate :id "g" (when "acct.open AND manual-approval")))))
+    (:policies (policy retention (days 30)))
+    (:product-service-mappings (mapping :product "custody" :services ("safekeeping") :resources ("acct"))))
+  (:catalog
+    (:attributes (name :type string :pii true))
+    (:actions)))`
+
+func TestToSexprCompact(t *testing.T) {
+	req := mustParse(t, compactDoc)
+	compact := print.ToSexprCompact(req)
+	if strings.Contains(strings.TrimSuffix(compact, "\n"), "\n") {
+		t.Errorf("compact output spans several lines:\n%s", compact)
+	}
+	pretty := print.ToSexpr(req)
+	if len(compact) >= len(pretty) {
+		t.Errorf("compact output is %d bytes, pretty %d", len(compact), len(pretty))
+	}
+
+	// Both forms must parse back to the same AST, which prints as the
+	// original did.
+	fromCompact := print.ToSexpr(mustParse(t, compact))
+	fromPretty := print.ToSexpr(mustParse(t, pretty))
+	if fromCompact != fromPretty || fromPretty != pretty {
+		t.Errorf("compact and pretty forms parse to different ASTs:\ncompact:\n%s\npretty:\n%s", fromCompact, fromPretty)
+	}
+}
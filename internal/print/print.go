@@ -2,14 +2,44 @@ package print
 
 import (
 	"fmt"
+	"io"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/example/dsl-go/internal/ast"
 )
 
+// ToSexpr returns the S-expression form of req.
 func ToSexpr(req *ast.Request) string {
 	var b strings.Builder
-	w := func(s string, args ...interface{}) { fmt.Fprintf(&b, s, args...) }
+	_ = Write(&b, req) // writes to a strings.Builder cannot fail
+	return b.String()
+}
+
+// Write writes the S-expression form of req to out as it is produced, without
+// building the whole document in memory. The bytes are identical to ToSexpr.
+// It returns the first write error. Comments kept on the AST are written on
+// their own lines before the node they belong to.
+func Write(out io.Writer, req *ast.Request) error {
+	return write(out, req, true)
+}
+
+func write(out io.Writer, req *ast.Request, withComments bool) error {
+	var err error
+	w := func(s string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(out, s, args...)
+		}
+	}
+	comments := func(indent string, lines []string) {
+		if withComments {
+			for _, line := range lines {
+				w("%s%s\n", indent, line)
+			}
+		}
+	}
+	comments("", req.Comments)
 	w("(onboarding-request\n")
 	// meta
 	if req.Meta != nil {
@@ -17,10 +47,10 @@ func ToSexpr(req *ast.Request) string {
 		w("    (request-id %q)\n", req.Meta.RequestID)
 		w("    (version %d)", req.Meta.Version)
 		if !req.Meta.CreatedAt.IsZero() {
-			w("\n    (created-at %q)", req.Meta.CreatedAt.UTC().Format("2006-01-02T15:04:05Z07:00"))
+			w("\n    (created-at %q)", ast.CanonicalTime(req.Meta.CreatedAt).Format(time.RFC3339Nano))
 		}
 		if !req.Meta.UpdatedAt.IsZero() {
-			w("\n    (updated-at %q)", req.Meta.UpdatedAt.UTC().Format("2006-01-02T15:04:05Z07:00"))
+			w("\n    (updated-at %q)", ast.CanonicalTime(req.Meta.UpdatedAt).Format(time.RFC3339Nano))
 		}
 		w(")\n")
 	}
@@ -43,17 +73,51 @@ func ToSexpr(req *ast.Request) string {
 			} else {
 				w("      (initial %s)\n", req.Orchestrator.Lifecycle.Initial)
 			}
-			w("      (transitions))\n")
+			w("      (transitions")
+			for _, t := range req.Orchestrator.Lifecycle.Transitions {
+				w("\n        (-> %s %s", t.From, t.To)
+				if t.Guard != nil {
+					w(" (when %s", t.Guard.Kind)
+					if t.Guard.Path != "" {
+						w(" %q", t.Guard.Path)
+					}
+					w(")")
+				}
+				if len(t.Effects) > 0 {
+					w(" (do")
+					for _, a := range t.Effects {
+						w(" (%s%s)", a.Name, printArgs(a.Args))
+					}
+					w(")")
+				}
+				w(")")
+			}
+			w("))\n")
 		}
 
 		// entities
 		if len(req.Orchestrator.Entities) > 0 {
 			w("    (:entities\n")
 			for _, e := range req.Orchestrator.Entities {
+				comments("      ", e.Comments)
 				w("      (entity :id %q :type %s\n", e.ID, e.Typ)
+				if len(e.Tags) > 0 {
+					w("        (tags %s)\n", strings.Join(e.Tags, " "))
+				}
 				w("        (attrs\n")
 				for _, attr := range e.Attrs {
-					w("          (%s %s)\n", attr.Key, printValue(attr.Value))
+					comments("          ", attr.Comments)
+					w("          (%s %s", attr.Key, printValue(attr.Value))
+					if attr.Provenance != nil {
+						w(" :provenance %q", *attr.Provenance)
+					}
+					if len(attr.NeededBy) > 0 {
+						w(" :needed-by (%s)", strings.Join(attr.NeededBy, " "))
+					}
+					if attr.SupersededAt != nil {
+						w(" :superseded-at %q", ast.CanonicalTime(*attr.SupersededAt).Format(time.RFC3339Nano))
+					}
+					w(")\n")
 				}
 				w("        ))\n")
 			}
@@ -64,7 +128,19 @@ func ToSexpr(req *ast.Request) string {
 		if len(req.Orchestrator.Resources) > 0 {
 			w("    (:resources\n")
 			for _, r := range req.Orchestrator.Resources {
-				w("      (resource :id %q :type %s)\n", r.ID, r.Typ)
+				comments("      ", r.Comments)
+				w("      (resource :id %q :type %s", r.ID, r.Typ)
+				if len(r.Requires) > 0 {
+					w(" (requires")
+					for _, item := range r.Requires {
+						w(" (%s %q)", item.Kind, item.ID)
+					}
+					w(")")
+				}
+				if len(r.Config) > 0 {
+					w(" (config%s)", printArgs(r.Config))
+				}
+				w(")\n")
 			}
 			w("    )\n")
 		}
@@ -73,26 +149,124 @@ func ToSexpr(req *ast.Request) string {
 		if len(req.Orchestrator.Flows) > 0 {
 			w("    (:flows\n")
 			for _, f := range req.Orchestrator.Flows {
-				w("      (flow :id %q\n", f.ID)
+				comments("      ", f.Comments)
+				w("      (flow :id %q", f.ID)
+				if f.Doc != nil {
+					w(" %q", *f.Doc)
+				}
+				w("\n")
 				w("        (steps\n")
 				for _, s := range f.Steps {
+					comments("          ", s.Comments)
 					if s.Task != nil {
-						w("          (task :id %q :on %q :op %s)\n", s.Task.ID, s.Task.On, s.Task.Op)
+						t := s.Task
+						w("          (task :id %q :on %q :op %s (args%s)", t.ID, t.On, t.Op, printArgs(t.Args))
+						if len(t.Needs) > 0 {
+							w(" (needs%s)", printStrings(t.Needs))
+						}
+						if len(t.Produces) > 0 {
+							w(" (produces%s)", printStrings(t.Produces))
+						}
+						if len(t.Labels) > 0 {
+							w(" (labels %s)", strings.Join(t.Labels, " "))
+						}
+						w(")\n")
 					} else if s.Gate != nil {
 						w("          (gate :id %q (when %q))\n", s.Gate.ID, s.Gate.Condition)
+					} else if s.Fork != nil {
+						w("          (fork :id %q (branches%s))\n", s.Fork.ID, printStrings(s.Fork.Branches))
+					} else if s.Join != nil {
+						w("          (join :id %q (after%s))\n", s.Join.ID, printStrings(s.Join.After))
 					}
 				}
 				w("        ))\n")
 			}
-			w("    ))\n")
+			w("    )\n")
+		}
+
+		// policies
+		if len(req.Orchestrator.Policies) > 0 {
+			w("    (:policies\n")
+			for _, p := range req.Orchestrator.Policies {
+				w("      (policy %s%s)\n", p.Name, printArgs(p.KV))
+			}
+			w("    )\n")
+		}
+
+		// product-service mappings
+		if len(req.Orchestrator.ProductServiceMappings) > 0 {
+			w("    (:product-service-mappings\n")
+			for _, m := range req.Orchestrator.ProductServiceMappings {
+				w("      (mapping :product %q :services (%s) :resources (%s))\n",
+					m.Product, strings.TrimPrefix(printStrings(m.Services), " "), strings.TrimPrefix(printStrings(m.Resources), " "))
+			}
+			w("    )\n")
 		}
 		w("  )\n")
 	}
 
+	if c := req.Catalog; c != nil {
+		w("  (:catalog\n")
+		w("    (:attributes")
+		for _, d := range c.Attributes {
+			w("\n      (%s :type %s", d.Name, d.Typ)
+			if len(d.Enum) > 0 {
+				w(" :enum (%s)", strings.Join(d.Enum, " "))
+			}
+			if d.Format != nil {
+				w(" :format %s", *d.Format)
+			}
+			if d.PII != nil {
+				w(" :pii %t", *d.PII)
+			}
+			w(")")
+		}
+		w(")\n")
+		w("    (:actions")
+		for _, a := range c.Actions {
+			w("\n      (%s (params", a.Name)
+			for _, p := range a.Params {
+				w(" (%s :type %s", p.Name, p.Typ)
+				if p.Required != nil {
+					w(" :required %t", *p.Required)
+				}
+				if len(p.Enum) > 0 {
+					w(" :enum (%s)", strings.Join(p.Enum, " "))
+				}
+				w(")")
+			}
+			w(") (needs%s) (produces%s))", printStrings(a.Needs), printStrings(a.Produces))
+		}
+		w("))\n")
+	}
+
 	w(")\n")
+	return err
+}
+
+// printArgs renders (key value) pairs, each preceded by a space.
+func printArgs(kvs []*ast.KVPair) string {
+	var b strings.Builder
+	for _, kv := range kvs {
+		fmt.Fprintf(&b, " (%s %s)", kv.Key, printValue(kv.Value))
+	}
 	return b.String()
 }
 
+// printStrings renders quoted strings, each preceded by a space.
+func printStrings(ss []string) string {
+	var b strings.Builder
+	for _, s := range ss {
+		fmt.Fprintf(&b, " %q", s)
+	}
+	return b.String()
+}
+
+// Value returns the S-expression form of a single value.
+func Value(v *ast.Value) string {
+	return printValue(v)
+}
+
 func printValue(v *ast.Value) string {
 	if v == nil {
 		return ""
@@ -102,11 +276,20 @@ func printValue(v *ast.Value) string {
 	} else if v.Int != nil {
 		return fmt.Sprintf("%d", *v.Int)
 	} else if v.Float != nil {
-		return fmt.Sprintf("%g", *v.Float)
+		// Always print a fraction so the value reads back as a float.
+		s := strconv.FormatFloat(*v.Float, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s
+	} else if v.Duration != nil {
+		return v.Duration.String()
 	} else if v.Bool != nil {
 		return fmt.Sprintf("%t", *v.Bool)
 	} else if v.Symbol != nil {
 		return *v.Symbol
+	} else if v.Map != nil {
+		return strings.TrimPrefix(printArgs(v.Map), " ")
 	}
 	return ""
 }
@@ -0,0 +1,364 @@
+package print_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/dsl-go/internal/ast"
+	"github.com/example/dsl-go/internal/print"
+)
+
+// flowDoc returns a document whose only flow has the given text between its
+// :id and its steps.
+func flowDoc(doc string) string {
+	return `(onboarding-request
+  (:meta (request-id "x") (version 1))
+  (:orchestrator
+    (:lifecycle (states draft) (initial draft) (transitions))
+    (:entities)
+    (:resources (resource :id "r" :type Account))
+    (:flows
+      (flow :id "main" ` + doc + `
+        (steps (task :id "t" :on "r" :op open-account (args)))))))`
+}
+
+func TestFlowDocRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want *string
+	}{
+		{"no doc", "", nil},
+		{"plain doc", `"Opens the account."`, strPtr("Opens the account.")},
+		{"empty doc", `""`, strPtr("")},
+		{"doc with quotes and newline", `"Runs \"KYC\"\nthen opens."`, strPtr("Runs \"KYC\"\nthen opens.")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := mustParse(t, flowDoc(tt.doc))
+			printed := print.ToSexpr(req)
+			again := mustParse(t, printed)
+			for _, r := range []struct {
+				what string
+				doc  *string
+			}{{"parsed", req.Orchestrator.Flows[0].Doc}, {"reparsed", again.Orchestrator.Flows[0].Doc}} {
+				if (r.doc == nil) != (tt.want == nil) || (r.doc != nil && *r.doc != *tt.want) {
+					t.Errorf("%s doc = %v, want %v\n%s", r.what, deref(r.doc), deref(tt.want), printed)
+				}
+			}
+			if tt.want != nil && !strings.Contains(printed, `(flow :id "main" `+tt.doc) {
+				t.Errorf("printed flow does not carry its doc:\n%s", printed)
+			}
+		})
+	}
+}
+
+func strPtr(s string) *string { return &s }
+
+func deref(s *string) string {
+	if s == nil {
+		return "<nil>"
+	}
+	return *s
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"plain", "ACME Ltd"},
+		{"empty", ""},
+		{"double quotes", `ACME "Holdings" Ltd`},
+		{"backslashes", `C:\data\new`},
+		{"trailing backslash", `ends with \`},
+		{"newline and tab", "line one\nline\ttwo\r\n"},
+		{"accents", "Société Générale Müller Ñandú"},
+		{"non-latin", "日本語 Ελληνικά русский"},
+		{"emoji", "rocket 🚀"},
+		{"control bytes", "bell\a nul-free \x01\x1f\x7f"},
+		{"invalid UTF-8", "bad \xff\xfe bytes"},
+		{"comment and parens", "; not a comment (nor a list)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := mustParse(t, doc(`(entity :id "le:A" :type LegalEntity (attrs (name "x")))`, ""))
+			e := req.Orchestrator.Entities[0]
+			e.ID = tt.value
+			v := tt.value
+			e.Attrs[0].Value.String = &v
+			e.Attrs[0].Provenance = &v
+
+			for _, printer := range []struct {
+				name  string
+				print func(*ast.Request) string
+			}{
+				{"ToSexpr", print.ToSexpr},
+				{"ToSexprCompact", print.ToSexprCompact},
+				{"ToCanonicalSexpr", print.ToCanonicalSexpr},
+			} {
+				printed := printer.print(req)
+				again := mustParse(t, printed)
+				got := again.Orchestrator.Entities[0]
+				a := got.Attrs[0]
+				if got.ID != tt.value || *a.Value.String != tt.value || *a.Provenance != tt.value {
+					t.Errorf("%s: round trip of %q gave id %q, value %q, provenance %q",
+						printer.name, tt.value, got.ID, *a.Value.String, *a.Provenance)
+				}
+			}
+		})
+	}
+}
+
+func TestFloatRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		f    float64
+		want string
+	}{
+		{"million", 1000000.0, "1000000.0"},
+		{"ten thousandth", 0.0001, "0.0001"},
+		{"whole", 42, "42.0"},
+		{"negative", -2.5e8, "-250000000.0"},
+		{"large", 1e21, "1000000000000000000000.0"},
+		{"small", 1.5e-10, "0.00000000015"},
+		{"shortest repr", 0.30000000000000004, "0.30000000000000004"},
+		{"max", math.MaxFloat64, ""},
+		{"smallest", math.SmallestNonzeroFloat64, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.f
+			printed := print.Value(&ast.Value{Float: &f})
+			if tt.want != "" && printed != tt.want {
+				t.Errorf("printed %v as %s, want %s", tt.f, printed, tt.want)
+			}
+			if strings.ContainsAny(printed, "eE") {
+				t.Errorf("printed %v with an exponent: %s", tt.f, printed)
+			}
+			req := mustParse(t, doc("", `(resource :id "r" :type Account (config (v `+printed+`)))`))
+			got := req.Orchestrator.Resources[0].Config[0].Value
+			if got.Float == nil || *got.Float != tt.f {
+				t.Errorf("%s parsed back as %s, want float %v", printed, print.Value(got), tt.f)
+			}
+		})
+	}
+}
+
+// errWriter fails every write after the first n bytes.
+type errWriter struct{ n int }
+
+func (w *errWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return 0, errors.New("disk full")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestWrite(t *testing.T) {
+	req := mustParse(t, bigDocument(100))
+	want := print.ToSexpr(req)
+	tests := []struct {
+		name    string
+		limit   int
+		wantErr bool
+	}{
+		{"unlimited", len(want), false},
+		{"fails midway", len(want) / 2, true},
+		{"fails at once", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			err := print.Write(io.MultiWriter(&errWriter{n: tt.limit}, &b), req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && b.String() != want {
+				t.Errorf("Write output differs from ToSexpr")
+			}
+		})
+	}
+}
+
+// bigDocument returns a document with n entities, each with a resource.
+func bigDocument(n int) string {
+	var entities, resources strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&entities, `
+      ; entity %d
+      (entity :id "le:%d" :type LegalEntity
+        (attrs (name "Entity %d" :provenance "registry") (country GB) (employees %d) (rating 4.5)))`, i, i, i, i)
+		fmt.Fprintf(&resources, `
+      (resource :id "acct:%d" :type Account (requires (entity "le:%d")) (config (currency EUR) (limits (daily 100))))`, i, i)
+	}
+	return doc(entities.String(), resources.String())
+}
+
+func BenchmarkToSexpr(b *testing.B) {
+	req := mustParse(b, bigDocument(20000))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := io.WriteString(io.Discard, print.ToSexpr(req)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWrite(b *testing.B) {
+	req := mustParse(b, bigDocument(20000))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := print.Write(io.Discard, req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDurationRoundTrip(t *testing.T) {
+	tests := []struct {
+		in, printed string
+		want        time.Duration
+	}{
+		{"30m", "30m", 30 * time.Minute},
+		{"90m", "1h30m", 90 * time.Minute},
+		{"30d", "30d", 30 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			req := mustParse(t, doc("", `(resource :id "r" :type Account (config (timeout `+tt.in+`)))`))
+			v := req.Orchestrator.Resources[0].Config[0].Value
+			if v.Duration == nil || time.Duration(*v.Duration) != tt.want {
+				t.Fatalf("timeout = %+v, want duration %v", v, tt.want)
+			}
+			printed := print.ToSexpr(req)
+			if !strings.Contains(printed, "(timeout "+tt.printed+")") {
+				t.Errorf("printed config does not hold (timeout %s):\n%s", tt.printed, printed)
+			}
+			again := mustParse(t, printed).Orchestrator.Resources[0].Config[0].Value
+			if !again.Equal(v) {
+				t.Errorf("reparsed timeout = %+v, want %+v", again, v)
+			}
+		})
+	}
+}
+
+func TestResourceRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource string
+	}{
+		{"bare", `(resource :id "r" :type Account)`},
+		{"requires", `(resource :id "r" :type Account (requires (entity "le:A") (resource "base")))`},
+		{"config", `(resource :id "r" :type Account (config (currency EUR) (limit 10) (label "main") (limits (daily 100))))`},
+		{"requires and config", `(resource :id "r" :type Account (requires (entity "le:A")) (config (currency EUR)))`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := mustParse(t, doc("", `(resource :id "base" :type Account) `+tt.resource))
+			want := req.Orchestrator.Resources[1]
+			printed := print.ToSexpr(req)
+			got := mustParse(t, printed).Orchestrator.Resources[1]
+
+			if got.ID != want.ID || got.Typ != want.Typ {
+				t.Errorf("resource = %s %s, want %s %s", got.ID, got.Typ, want.ID, want.Typ)
+			}
+			if len(got.Requires) != len(want.Requires) {
+				t.Fatalf("requires = %d items, want %d:\n%s", len(got.Requires), len(want.Requires), printed)
+			}
+			for i, r := range want.Requires {
+				if got.Requires[i].Kind != r.Kind || got.Requires[i].ID != r.ID {
+					t.Errorf("requires[%d] = %s %q, want %s %q", i, got.Requires[i].Kind, got.Requires[i].ID, r.Kind, r.ID)
+				}
+			}
+			if len(got.Config) != len(want.Config) {
+				t.Fatalf("config = %d entries, want %d:\n%s", len(got.Config), len(want.Config), printed)
+			}
+			for i, kv := range want.Config {
+				if got.Config[i].Key != kv.Key || !got.Config[i].Value.Equal(kv.Value) {
+					t.Errorf("config[%d] %s does not round-trip:\n%s", i, kv.Key, printed)
+				}
+			}
+		})
+	}
+}
+
+func TestAttrNeededByRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		attr string
+		want []string
+	}{
+		{"none", `(name "x")`, nil},
+		{"one", `(name "x" :needed-by (kyc))`, []string{"kyc"}},
+		{"several with provenance", `(name "x" :provenance "registry" :needed-by (kyc aml onboarding))`, []string{"kyc", "aml", "onboarding"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := mustParse(t, doc(`(entity :id "le:A" :type LegalEntity (attrs `+tt.attr+`))`, ""))
+			printed := print.ToSexpr(req)
+			a := mustParse(t, printed).Orchestrator.Entities[0].Attrs[0]
+			if fmt.Sprint(a.NeededBy) != fmt.Sprint(tt.want) {
+				t.Errorf("needed-by = %v, want %v:\n%s", a.NeededBy, tt.want, printed)
+			}
+		})
+	}
+}
+
+func TestMappingRoundTrip(t *testing.T) {
+	req := mustParse(t, `(onboarding-request
+  (:meta (request-id "x") (version 1))
+  (:orchestrator
+    (:lifecycle (states draft) (initial draft) (transitions))
+    (:entities)
+    (:resources (resource :id "acct" :type Account))
+    (:flows)
+    (:product-service-mappings
+      (mapping :product "custody" :services ("safekeeping" "settlement") :resources ("acct")))))`)
+	printed := print.ToSexpr(req)
+	got := mustParse(t, printed).Orchestrator.ProductServiceMappings
+	if len(got) != 1 {
+		t.Fatalf("mappings = %d, want 1:\n%s", len(got), printed)
+	}
+	m := got[0]
+	if m.Product != "custody" || fmt.Sprint(m.Services) != "[safekeeping settlement]" || fmt.Sprint(m.Resources) != "[acct]" {
+		t.Errorf("mapping = %s %v %v, want custody [safekeeping settlement] [acct]:\n%s", m.Product, m.Services, m.Resources, printed)
+	}
+}
+
+func TestEntityTagsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		entity string
+		want   []string
+	}{
+		{"untagged", `(entity :id "le:A" :type LegalEntity (attrs (name "A")))`, nil},
+		{"tagged", `(entity :id "le:A" :type LegalEntity (tags high-risk pep) (attrs (name "A")))`, []string{"high-risk", "pep"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, printer := range []struct {
+				name  string
+				print func(*ast.Request) string
+			}{
+				{"ToSexpr", print.ToSexpr},
+				{"ToSexprCompact", print.ToSexprCompact},
+			} {
+				printed := printer.print(mustParse(t, doc(tt.entity, "")))
+				got := mustParse(t, printed).Orchestrator.Entities[0].Tags
+				if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+					t.Errorf("%s: tags = %v, want %v:\n%s", printer.name, got, tt.want, printed)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package print
+
+import (
+	"strings"
+
+	"github.com/example/dsl-go/internal/ast"
+)
+
+// Redacted is the value ToSexprRedacted prints in place of a PII value.
+const Redacted = "***"
+
+// ToSexprRedacted returns the S-expression form of req with the value of
+// every PII attribute replaced by the string "***". An attribute is PII if
+// its key is in piiKeys or the catalog defines it with :pii true. The layout
+// is that of ToSexpr, but comments are left out, as they may quote the
+// redacted values. req is not modified.
+func ToSexprRedacted(req *ast.Request, piiKeys map[string]bool) string {
+	pii := map[string]bool{}
+	for k, ok := range piiKeys {
+		pii[k] = ok
+	}
+	if req.Catalog != nil {
+		for _, d := range req.Catalog.Attributes {
+			if d.PII != nil && *d.PII {
+				pii[d.Name] = true
+			}
+		}
+	}
+
+	var b strings.Builder
+	if req.Orchestrator == nil {
+		_ = write(&b, req, false)
+		return b.String()
+	}
+	orch := *req.Orchestrator
+	orch.Entities = make([]*ast.Entity, len(req.Orchestrator.Entities))
+	for i, e := range req.Orchestrator.Entities {
+		cp := *e
+		cp.Attrs = make([]*ast.AttrVal, len(e.Attrs))
+		for j, a := range e.Attrs {
+			if pii[a.Key] {
+				redacted := *a
+				s := Redacted
+				redacted.Value = &ast.Value{String: &s}
+				a = &redacted
+			}
+			cp.Attrs[j] = a
+		}
+		orch.Entities[i] = &cp
+	}
+
+	cp := *req
+	cp.Orchestrator = &orch
+	_ = write(&b, &cp, false)
+	return b.String()
+}
@@ -0,0 +1,75 @@
+package print_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/example/dsl-go/internal/print"
+)
+
+const redactDoc = `(onboarding-request
+  (:meta (request-id "x") (version 1))
+  (:orchestrator
+    (:lifecycle (states draft) (initial draft) (transitions))
+    (:entities
+      ; passport "X123" on file
+      (entity :id "le:A" :type Individual
+        (attrs
+          (name "Jane Doe" :provenance "registry")
+          (passport "X123")
+          (dob "1980-01-01")
+          (country GB))))
+    (:resources)
+    (:flows))
+  (:catalog
+    (:attributes
+      (name :type string :pii true)
+      (passport :type string :pii true)
+      (dob :type date :pii false)
+      (country :type country))
+    (:actions)))`
+
+func TestToSexprRedacted(t *testing.T) {
+	tests := []struct {
+		name       string
+		keys       map[string]bool
+		redacted   []string
+		unredacted []string
+	}{
+		{"catalog flags", nil,
+			[]string{`(name "***" :provenance "registry")`, `(passport "***")`},
+			[]string{`(dob "1980-01-01")`, "(country GB)"}},
+		{"extra keys", map[string]bool{"dob": true},
+			[]string{`(name "***" :provenance "registry")`, `(passport "***")`, `(dob "***")`},
+			[]string{"(country GB)"}},
+		{"key set to false does not redact", map[string]bool{"country": false},
+			[]string{`(passport "***")`},
+			[]string{"(country GB)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := mustParse(t, redactDoc)
+			before := print.ToSexpr(req)
+			out := print.ToSexprRedacted(req, tt.keys)
+			for _, s := range tt.redacted {
+				if !strings.Contains(out, s) {
+					t.Errorf("output lacks %s:\n%s", s, out)
+				}
+			}
+			for _, s := range tt.unredacted {
+				if !strings.Contains(out, s) {
+					t.Errorf("output lacks unredacted %s:\n%s", s, out)
+				}
+			}
+			for _, secret := range []string{"Jane Doe", "X123"} {
+				if strings.Contains(out, secret) {
+					t.Errorf("output leaks %q:\n%s", secret, out)
+				}
+			}
+			if print.ToSexpr(req) != before {
+				t.Error("request was modified")
+			}
+			mustParse(t, out)
+		})
+	}
+}
@@ -1,20 +1,110 @@
 package storage
 
 import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
+// FileStore keeps each request in its own directory under base, one file per
+// version plus a latest file naming the newest one. It is safe for concurrent
+// use within a process: writes to one request id are serialized with each
+// other and with its reads, while different ids proceed in parallel.
+//
+// Every Put also records the hash of the text in an index file under base, so
+// GetByHash can find the version a hash came from.
 type FileStore struct {
 	base string
+	// locks maps a request directory, or the index file, to its
+	// *sync.RWMutex. Tenant stores share their parent's map.
+	locks    *sync.Map
+	hashText func(text string) string
 }
 
 func NewFileStore(base string) *FileStore {
 	_ = os.MkdirAll(base, 0o755)
-	return &FileStore{base: base}
+	return &FileStore{base: base, locks: &sync.Map{}, hashText: TextHash}
+}
+
+// WithHasher replaces the function that hashes stored text for the index,
+// TextHash by default. Versions already indexed keep their old hashes.
+func (s *FileStore) WithHasher(fn func(text string) string) *FileStore {
+	s.hashText = fn
+	return s
+}
+
+// TextHash returns the SHA-256 of text as "sha256:<hex>".
+func TextHash(text string) string {
+	h := sha256.Sum256([]byte(text))
+	return "sha256:" + hex.EncodeToString(h[:])
+}
+
+// lock returns the mutex guarding request id.
+func (s *FileStore) lock(id string) *sync.RWMutex {
+	l, _ := s.locks.LoadOrStore(s.reqDir(id), &sync.RWMutex{})
+	return l.(*sync.RWMutex)
+}
+
+var tenantIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ValidTenantID reports whether tenant can safely name a directory: letters,
+// digits, '_', '.' and '-', not starting with a separator or dot, and never
+// "." or ".." or the index file name "hashes".
+func ValidTenantID(tenant string) bool {
+	return tenantIDPattern.MatchString(tenant) && tenant != "." && tenant != ".." &&
+		tenant != "hashes"
+}
+
+// tenantsDir is the directory under a store's base that holds its tenants'
+// stores, one subdirectory each.
+const tenantsDir = "tenants"
+
+// ErrInvalidID is wrapped by the errors FileStore returns for a request id
+// that cannot safely name a directory under its base (see ValidRequestID).
+var ErrInvalidID = errors.New("invalid request id")
+
+// ValidRequestID reports whether id can safely name a request directory: it
+// is not empty, contains no path separator, NUL or "..", and is not "." or
+// the index file name "hashes" or the tenants directory "tenants". Unlike
+// tenant ids, request ids may use any other characters.
+func ValidRequestID(id string) bool {
+	return id != "" && id != "." && id != "hashes" && id != tenantsDir &&
+		!strings.ContainsAny(id, "/\\\x00") && !strings.Contains(id, "..")
+}
+
+func checkID(id string) error {
+	if !ValidRequestID(id) {
+		return fmt.Errorf("%w %q", ErrInvalidID, id)
+	}
+	return nil
+}
+
+// ForTenant returns a store holding only tenant's requests, under
+// base/tenants/<tenant>/<id>. Every operation on it is scoped to that tenant.
+func (s *FileStore) ForTenant(tenant string) (Store, error) {
+	if !ValidTenantID(tenant) {
+		return nil, fmt.Errorf("invalid tenant id %q", tenant)
+	}
+	base := filepath.Join(s.base, tenantsDir, tenant)
+	if err := os.MkdirAll(base, 0o755); err != nil {
+		return nil, fmt.Errorf("tenant %s: %w", tenant, err)
+	}
+	return &FileStore{base: base, locks: s.locks, hashText: s.hashText}, nil
+}
+
+// Close does nothing: every Put is written through before it returns.
+func (s *FileStore) Close() error {
+	return nil
 }
 
 func (s *FileStore) reqDir(id string) string {
@@ -26,26 +116,117 @@ func (s *FileStore) verPath(id string, version uint64) string {
 func (s *FileStore) latestPath(id string) string {
 	return filepath.Join(s.reqDir(id), "latest")
 }
+func (s *FileStore) indexPath() string {
+	return filepath.Join(s.base, "hashes")
+}
+
+// indexLock returns the mutex guarding the hash index. It is never held
+// while waiting for a request lock.
+func (s *FileStore) indexLock() *sync.RWMutex {
+	l, _ := s.locks.LoadOrStore(s.indexPath(), &sync.RWMutex{})
+	return l.(*sync.RWMutex)
+}
 
 func (s *FileStore) Put(id string, version uint64, text string) error {
+	if err := checkID(id); err != nil {
+		return err
+	}
+	l := s.lock(id)
+	l.Lock()
+	defer l.Unlock()
 	if err := os.MkdirAll(s.reqDir(id), 0o755); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 	if err := os.WriteFile(s.verPath(id, version), []byte(text), 0o644); err != nil {
 		return fmt.Errorf("failed to write version file: %w", err)
 	}
-	if err := os.WriteFile(s.latestPath(id), []byte(fmt.Sprintf("%d", version)), 0o644); err != nil {
+	// Replace latest by renaming, so it never holds a partial write.
+	tmp := s.latestPath(id) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d", version)), 0o644); err != nil {
+		return fmt.Errorf("failed to write latest file: %w", err)
+	}
+	if err := os.Rename(tmp, s.latestPath(id)); err != nil {
 		return fmt.Errorf("failed to write latest file: %w", err)
 	}
+	if err := s.index(s.hashText(text), id, version); err != nil {
+		return fmt.Errorf("failed to update hash index: %w", err)
+	}
 	return nil
 }
 
-func (s *FileStore) GetLatest(id string) (uint64, string, error) {
-	b, err := os.ReadFile(s.latestPath(id))
+// index appends the location of hash to the index file.
+func (s *FileStore) index(hash, id string, version uint64) error {
+	l := s.indexLock()
+	l.Lock()
+	defer l.Unlock()
+	f, err := os.OpenFile(s.indexPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
 	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%s %s %d\n", hash, id, version); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// GetByHash returns the request id, version and text of the earliest stored
+// version whose text hashes to hash. Index entries whose version has since
+// been overwritten with different text are skipped. It returns an error
+// wrapping fs.ErrNotExist if no version matches.
+func (s *FileStore) GetByHash(hash string) (id string, version uint64, text string, err error) {
+	type location struct {
+		id      string
+		version uint64
+	}
+	var candidates []location
+	l := s.indexLock()
+	l.RLock()
+	f, err := os.Open(s.indexPath())
+	if err != nil {
+		l.RUnlock()
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", 0, "", fmt.Errorf("hash %s: %w", hash, fs.ErrNotExist)
+		}
+		return "", 0, "", err
+	}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 3 || fields[0] != hash {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, location{fields[1], v})
+	}
+	err = sc.Err()
+	f.Close()
+	l.RUnlock()
+	if err != nil {
+		return "", 0, "", fmt.Errorf("failed to read hash index: %w", err)
+	}
+
+	for _, c := range candidates {
+		text, err := s.Get(c.id, c.version)
+		if err != nil || s.hashText(text) != hash {
+			continue
+		}
+		return c.id, c.version, text, nil
+	}
+	return "", 0, "", fmt.Errorf("hash %s: %w", hash, fs.ErrNotExist)
+}
+
+func (s *FileStore) GetLatest(id string) (uint64, string, error) {
+	if err := checkID(id); err != nil {
 		return 0, "", err
 	}
-	v, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	l := s.lock(id)
+	l.RLock()
+	defer l.RUnlock()
+	v, err := s.latestVersion(id)
 	if err != nil {
 		return 0, "", err
 	}
@@ -56,7 +237,80 @@ func (s *FileStore) GetLatest(id string) (uint64, string, error) {
 	return v, string(txt), nil
 }
 
+// LatestVersion returns the version the latest file of id points at.
+func (s *FileStore) LatestVersion(id string) (uint64, error) {
+	if err := checkID(id); err != nil {
+		return 0, err
+	}
+	l := s.lock(id)
+	l.RLock()
+	defer l.RUnlock()
+	return s.latestVersion(id)
+}
+
+func (s *FileStore) latestVersion(id string) (uint64, error) {
+	b, err := os.ReadFile(s.latestPath(id))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+}
+
+// List returns the ids of the stored requests in lexical order. Directories
+// without a readable latest file, such as tenant directories, are skipped.
+func (s *FileStore) List() ([]string, error) {
+	entries, err := os.ReadDir(s.base)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := s.LatestVersion(e.Name()); err != nil {
+			continue
+		}
+		ids = append(ids, e.Name())
+	}
+	return ids, nil
+}
+
+// Versions returns the versions stored for id in ascending order.
+func (s *FileStore) Versions(id string) ([]uint64, error) {
+	if err := checkID(id); err != nil {
+		return nil, err
+	}
+	l := s.lock(id)
+	l.RLock()
+	defer l.RUnlock()
+	entries, err := os.ReadDir(s.reqDir(id))
+	if err != nil {
+		return nil, err
+	}
+	var versions []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, "v") || !strings.HasSuffix(name, ".sexpr") {
+			continue
+		}
+		v, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "v"), ".sexpr"), 10, 64)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions, nil
+}
+
 func (s *FileStore) Get(id string, version uint64) (string, error) {
+	if err := checkID(id); err != nil {
+		return "", err
+	}
+	l := s.lock(id)
+	l.RLock()
+	defer l.RUnlock()
 	b, err := os.ReadFile(s.verPath(id, version))
 	if err != nil {
 		return "", err
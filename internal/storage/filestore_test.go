@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"onboard-2024-q4-001", true},
+		{"le:ACME", true},
+		{"v1.2", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"hashes", false},
+		{"tenants", false},
+		{"../b/x", false},
+		{"a/b", false},
+		{`a\b`, false},
+		{"a..b", false},
+		{"a\x00b", false},
+	}
+	for _, tt := range tests {
+		if got := ValidRequestID(tt.id); got != tt.want {
+			t.Errorf("ValidRequestID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestValidTenantID(t *testing.T) {
+	tests := []struct {
+		tenant string
+		want   bool
+	}{
+		{"acme", true},
+		{"acme-eu_1.2", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{".hidden", false},
+		{"-a", false},
+		{"a/b", false},
+		{"hashes", false},
+	}
+	for _, tt := range tests {
+		if got := ValidTenantID(tt.tenant); got != tt.want {
+			t.Errorf("ValidTenantID(%q) = %v, want %v", tt.tenant, got, tt.want)
+		}
+	}
+}
+
+func TestFileStoreTenantLayout(t *testing.T) {
+	root := t.TempDir()
+	s := NewFileStore(root)
+	if err := s.Put("req", 1, "base"); err != nil {
+		t.Fatal(err)
+	}
+	tenant, err := s.ForTenant("req")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tenant.Put("req", 1, "tenant"); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{
+		filepath.Join(root, "req", "v1.sexpr"):                   "base",
+		filepath.Join(root, "tenants", "req", "req", "v1.sexpr"): "tenant",
+	} {
+		if got, err := os.ReadFile(path); err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", path, got, err, want)
+		}
+	}
+}
+
+func TestFileStoreForTenantReportsMkdirError(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "tenants"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStore(root).ForTenant("a"); err == nil {
+		t.Error("ForTenant succeeded with a file in the way of its directory")
+	}
+}
+
+func TestFileStoreRejectsEscapingIDs(t *testing.T) {
+	root := t.TempDir()
+	tenant, err := NewFileStore(root).ForTenant("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops := []struct {
+		name string
+		call func(id string) error
+	}{
+		{"Put", func(id string) error { return tenant.Put(id, 1, "x") }},
+		{"Get", func(id string) error { _, err := tenant.Get(id, 1); return err }},
+		{"GetLatest", func(id string) error { _, _, err := tenant.GetLatest(id); return err }},
+		{"LatestVersion", func(id string) error { _, err := tenant.LatestVersion(id); return err }},
+		{"Versions", func(id string) error { _, err := tenant.Versions(id); return err }},
+	}
+	for _, op := range ops {
+		for _, id := range []string{"../b/x", "hashes", ""} {
+			if err := op.call(id); !errors.Is(err, ErrInvalidID) {
+				t.Errorf("%s(%q) = %v, want ErrInvalidID", op.name, id, err)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "b")); !os.IsNotExist(err) {
+		t.Errorf("tenant a wrote outside its directory: stat b: %v", err)
+	}
+}
+
+func TestFileStorePutGet(t *testing.T) {
+	s := NewFileStore(t.TempDir())
+	for v, text := range []string{"one", "two"} {
+		if err := s.Put("req", uint64(v+1), text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	v, text, err := s.GetLatest("req")
+	if err != nil || v != 2 || text != "two" {
+		t.Fatalf("GetLatest = %d, %q, %v; want 2, \"two\", nil", v, text, err)
+	}
+	versions, err := s.Versions("req")
+	if err != nil || len(versions) != 2 || versions[0] != 1 || versions[1] != 2 {
+		t.Fatalf("Versions = %v, %v; want [1 2]", versions, err)
+	}
+}
+
+func TestFileStoreGetByHash(t *testing.T) {
+	s := NewFileStore(t.TempDir())
+	puts := []struct {
+		id      string
+		version uint64
+		text    string
+	}{
+		{"a", 1, "alpha"},
+		{"b", 1, "beta"},
+		{"b", 2, "alpha"},
+	}
+	for _, p := range puts {
+		if err := s.Put(p.id, p.version, p.text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		text        string
+		wantID      string
+		wantVersion uint64
+	}{
+		{"beta", "b", 1},
+		// The same text stored twice resolves to the earliest put.
+		{"alpha", "a", 1},
+	}
+	for _, tt := range tests {
+		id, v, text, err := s.GetByHash(TextHash(tt.text))
+		if err != nil || id != tt.wantID || v != tt.wantVersion || text != tt.text {
+			t.Errorf("GetByHash(%q) = %s v%d %q, %v; want %s v%d", tt.text, id, v, text, err, tt.wantID, tt.wantVersion)
+		}
+	}
+	if _, _, _, err := s.GetByHash(TextHash("gamma")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("GetByHash of an unknown hash: err = %v, want fs.ErrNotExist", err)
+	}
+	if _, _, _, err := NewFileStore(t.TempDir()).GetByHash(TextHash("alpha")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("GetByHash on an empty store: err = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestFileStoreConcurrentPut(t *testing.T) {
+	const writers = 16
+	all := make([]uint64, writers)
+	for i := range all {
+		all[i] = uint64(i + 1)
+	}
+	tests := []struct {
+		name string
+		// id is the request writer i puts version i+1 of.
+		id       func(i int) string
+		versions func(i int) []uint64
+	}{
+		{"distinct ids",
+			func(i int) string { return fmt.Sprintf("req-%d", i) },
+			func(i int) []uint64 { return []uint64{uint64(i + 1)} }},
+		{"same id",
+			func(int) string { return "req" },
+			func(int) []uint64 { return all }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewFileStore(t.TempDir())
+			var wg sync.WaitGroup
+			errs := make(chan error, 2*writers)
+			for i := 0; i < writers; i++ {
+				wg.Add(2)
+				go func(i int) {
+					defer wg.Done()
+					errs <- s.Put(tt.id(i), uint64(i+1), fmt.Sprintf("text %d", i+1))
+				}(i)
+				go func(i int) {
+					defer wg.Done()
+					// Readers may run before any write; they must only
+					// never see a latest version without its text.
+					if _, _, err := s.GetLatest(tt.id(i)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+						errs <- err
+					}
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < writers; i++ {
+				id := tt.id(i)
+				v, text, err := s.GetLatest(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := fmt.Sprintf("text %d", v); text != want {
+					t.Errorf("%s: latest is v%d with text %q, want %q", id, v, text, want)
+				}
+				hid, hv, _, err := s.GetByHash(TextHash(text))
+				if err != nil || hid != id || hv != v {
+					t.Errorf("%s: GetByHash = %s v%d, %v; want %s v%d", id, hid, hv, err, id, v)
+				}
+			}
+			for i := 0; i < writers; i++ {
+				versions, err := s.Versions(tt.id(i))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fmt.Sprint(versions) != fmt.Sprint(tt.versions(i)) {
+					t.Errorf("versions of %s = %v, want %v", tt.id(i), versions, tt.versions(i))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"sync"
+)
+
+// MemStore is a Store kept in memory, for tests and short-lived tools. It is
+// safe for concurrent use.
+type MemStore struct {
+	mu       sync.Mutex
+	requests map[string]*memRequest
+	tenants  map[string]*MemStore
+}
+
+type memRequest struct {
+	latest   uint64
+	versions map[uint64]string
+}
+
+func NewMemStore() *MemStore {
+	return &MemStore{
+		requests: map[string]*memRequest{},
+		tenants:  map[string]*MemStore{},
+	}
+}
+
+func (s *MemStore) Put(id string, version uint64, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.requests[id]
+	if r == nil {
+		r = &memRequest{versions: map[uint64]string{}}
+		s.requests[id] = r
+	}
+	r.versions[version] = text
+	r.latest = version
+	return nil
+}
+
+func (s *MemStore) GetLatest(id string) (uint64, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.requests[id]
+	if r == nil {
+		return 0, "", notExist(id)
+	}
+	return r.latest, r.versions[r.latest], nil
+}
+
+func (s *MemStore) Get(id string, version uint64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.requests[id]
+	if r == nil {
+		return "", notExist(id)
+	}
+	text, ok := r.versions[version]
+	if !ok {
+		return "", fmt.Errorf("%s version %d: %w", id, version, fs.ErrNotExist)
+	}
+	return text, nil
+}
+
+func (s *MemStore) LatestVersion(id string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.requests[id]
+	if r == nil {
+		return 0, notExist(id)
+	}
+	return r.latest, nil
+}
+
+func (s *MemStore) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.requests))
+	for id := range s.requests {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s *MemStore) Versions(id string) ([]uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.requests[id]
+	if r == nil {
+		return nil, notExist(id)
+	}
+	versions := make([]uint64, 0, len(r.versions))
+	for v := range r.versions {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions, nil
+}
+
+// ForTenant returns the store of tenant's requests, creating it on first use.
+// The same tenant always gets the same store.
+func (s *MemStore) ForTenant(tenant string) (Store, error) {
+	if !ValidTenantID(tenant) {
+		return nil, fmt.Errorf("invalid tenant id %q", tenant)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.tenants[tenant]
+	if t == nil {
+		t = NewMemStore()
+		s.tenants[tenant] = t
+	}
+	return t, nil
+}
+
+func notExist(id string) error {
+	return fmt.Errorf("%s: %w", id, fs.ErrNotExist)
+}
@@ -0,0 +1,24 @@
+package storage
+
+// Store persists the versions of requests. Get, GetLatest, LatestVersion and
+// Versions return an error wrapping fs.ErrNotExist for an id or version that
+// was never stored. A Store that buffers writes should also implement
+// io.Closer and flush them on Close.
+type Store interface {
+	// Put stores text as version of id and makes it the latest version.
+	Put(id string, version uint64, text string) error
+	GetLatest(id string) (uint64, string, error)
+	Get(id string, version uint64) (string, error)
+	LatestVersion(id string) (uint64, error)
+	// List returns the stored request ids in lexical order.
+	List() ([]string, error)
+	// Versions returns the stored versions of id in ascending order.
+	Versions(id string) ([]uint64, error)
+	// ForTenant returns a store holding only tenant's requests.
+	ForTenant(tenant string) (Store, error)
+}
+
+var (
+	_ Store = (*FileStore)(nil)
+	_ Store = (*MemStore)(nil)
+)
@@ -0,0 +1,133 @@
+package validate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/example/dsl-go/internal/ast"
+)
+
+// Catalog cross-checks entity attributes against the attribute definitions
+// in the request's catalog: a value must be one of its definition's enum
+// members, and an attribute defined as :pii true must carry provenance.
+// Attributes without a definition are not checked. When the catalog declares
+// actions, every task :op must name one, with the action's required params
+// among its args and enum params given a member (see actions).
+func Catalog(req *ast.Request) []Issue {
+	if req.Catalog == nil || req.Orchestrator == nil {
+		return nil
+	}
+	defs := map[string]*ast.AttrDef{}
+	for _, d := range req.Catalog.Attributes {
+		defs[d.Name] = d
+	}
+
+	var issues []Issue
+	for _, e := range req.Orchestrator.Entities {
+		for _, a := range e.Attrs {
+			def := defs[a.Key]
+			if def == nil {
+				continue
+			}
+			if len(def.Enum) > 0 && !inEnum(a.Value, def.Enum) {
+				issues = append(issues, Issue{
+					Pos: a.Pos,
+					Message: fmt.Sprintf("entity %q: attribute %s has value %s, want one of %s",
+						e.ID, a.Key, valueText(a.Value), strings.Join(def.Enum, ", ")),
+				})
+			}
+			if def.PII != nil && *def.PII && a.Provenance == nil {
+				issues = append(issues, Issue{
+					Pos:     a.Pos,
+					Message: fmt.Sprintf("entity %q: attribute %s is PII but has no :provenance", e.ID, a.Key),
+				})
+			}
+		}
+	}
+	return append(issues, actions(req)...)
+}
+
+// actions checks each task against the catalog action its :op names.
+func actions(req *ast.Request) []Issue {
+	if len(req.Catalog.Actions) == 0 {
+		return nil
+	}
+	defs := map[string]*ast.ActionDef{}
+	known := map[string]bool{}
+	for _, d := range req.Catalog.Actions {
+		defs[d.Name] = d
+		known[d.Name] = true
+	}
+
+	var issues []Issue
+	ast.Walk(req, ast.Visitor{Task: func(f *ast.Flow, t *ast.Task) bool {
+		def := defs[t.Op]
+		if def == nil {
+			issues = append(issues, Issue{
+				Pos: t.Pos,
+				Message: fmt.Sprintf("flow %q: task %q has op %s, which is not a catalog action%s",
+					f.ID, t.ID, t.Op, hint(t.Op, known)),
+			})
+			return true
+		}
+		args := map[string]*ast.KVPair{}
+		for _, kv := range t.Args {
+			args[kv.Key] = kv
+		}
+		for _, p := range def.Params {
+			arg := args[p.Name]
+			if arg == nil {
+				if p.Required != nil && *p.Required {
+					issues = append(issues, Issue{
+						Pos:     t.Pos,
+						Message: fmt.Sprintf("flow %q: task %q is missing param %s, required by action %s", f.ID, t.ID, p.Name, def.Name),
+					})
+				}
+				continue
+			}
+			if len(p.Enum) > 0 && !inEnum(arg.Value, p.Enum) {
+				issues = append(issues, Issue{
+					Pos: arg.Pos,
+					Message: fmt.Sprintf("flow %q: task %q: param %s has value %s, want one of %s",
+						f.ID, t.ID, p.Name, valueText(arg.Value), strings.Join(p.Enum, ", ")),
+				})
+			}
+		}
+		return true
+	}})
+	return issues
+}
+
+// inEnum reports whether v is a string or identifier naming one of members.
+func inEnum(v *ast.Value, members []string) bool {
+	if v == nil {
+		return false
+	}
+	var s string
+	switch {
+	case v.Symbol != nil:
+		s = *v.Symbol
+	case v.String != nil:
+		s = *v.String
+	default:
+		return false
+	}
+	for _, m := range members {
+		if s == m {
+			return true
+		}
+	}
+	return false
+}
+
+func valueText(v *ast.Value) string {
+	switch {
+	case v == nil:
+		return "nothing"
+	case v.String != nil:
+		return fmt.Sprintf("%q", *v.String)
+	case v.Symbol != nil:
+		return *v.Symbol
+	}
+	return "of another kind"
+}
@@ -0,0 +1,101 @@
+package validate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/example/dsl-go/internal/parse"
+)
+
+// catalogDoc returns a document whose single entity, le:A, has the given
+// attrs and whose catalog defines the given attributes.
+func catalogDoc(attrs, defs string) string {
+	return `(onboarding-request
+  (:meta (request-id "x") (version 1))
+  (:orchestrator
+    (:lifecycle (states draft) (initial draft) (transitions))
+    (:entities (entity :id "le:A" :type LegalEntity (attrs ` + attrs + `)))
+    (:resources)
+    (:flows))
+  (:catalog (:attributes ` + defs + `) (:actions)))`
+}
+
+func TestCatalog(t *testing.T) {
+	tests := []struct {
+		name  string
+		attrs string
+		defs  string
+		want  []string
+	}{
+		{"enum member", `(risk low)`, `(risk :type enum :enum (low high))`, nil},
+		{"enum member as string", `(risk "high")`, `(risk :type enum :enum (low high))`, nil},
+		{"out-of-enum value", `(risk medium)`, `(risk :type enum :enum (low high))`,
+			[]string{`entity "le:A": attribute risk has value medium, want one of low, high`}},
+		{"PII with provenance", `(name "Jane" :provenance "registry")`, `(name :type string :pii true)`, nil},
+		{"PII without provenance", `(name "Jane")`, `(name :type string :pii true)`,
+			[]string{`entity "le:A": attribute name is PII but has no :provenance`}},
+		{"pii false", `(dob "1980-01-01")`, `(dob :type date :pii false)`, nil},
+		{"undefined attribute", `(colour blue)`, `(risk :type enum :enum (low high))`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := parse.ParseReader(strings.NewReader(catalogDoc(tt.attrs, tt.defs)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, issue := range Catalog(req) {
+				got = append(got, issue.Message)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Catalog = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCatalogActions(t *testing.T) {
+	const actions = `(open-account
+        (params (currency :type string :required true) (kind :type enum :enum (cash securities)) (note :type string))
+        (needs) (produces))`
+	tests := []struct {
+		name    string
+		task    string
+		actions string
+		want    []string
+	}{
+		{"matching task", `(task :id "t" :on "r" :op open-account (args (currency "EUR") (kind cash)))`, actions, nil},
+		{"unknown op", `(task :id "t" :on "r" :op close-account (args))`, actions,
+			[]string{`flow "main": task "t" has op close-account, which is not a catalog action`}},
+		{"op differing in case", `(task :id "t" :on "r" :op Open-Account (args (currency "EUR")))`, actions,
+			[]string{`flow "main": task "t" has op Open-Account, which is not a catalog action (did you mean "open-account"?)`}},
+		{"missing required param", `(task :id "t" :on "r" :op open-account (args (kind cash)))`, actions,
+			[]string{`flow "main": task "t" is missing param currency, required by action open-account`}},
+		{"param outside its enum", `(task :id "t" :on "r" :op open-account (args (currency "EUR") (kind gold)))`, actions,
+			[]string{`flow "main": task "t": param kind has value gold, want one of cash, securities`}},
+		{"no actions declared", `(task :id "t" :on "r" :op anything (args))`, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := `(onboarding-request
+  (:meta (request-id "x") (version 1))
+  (:orchestrator
+    (:lifecycle (states draft) (initial draft) (transitions))
+    (:entities)
+    (:resources (resource :id "r" :type Account))
+    (:flows (flow :id "main" (steps ` + tt.task + `))))
+  (:catalog (:attributes) (:actions ` + tt.actions + `)))`
+			req, err := parse.ParseReader(strings.NewReader(doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, issue := range Catalog(req) {
+				got = append(got, issue.Message)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Catalog = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package validate
+
+import (
+	"fmt"
+
+	"github.com/example/dsl-go/internal/ast"
+)
+
+// Dictionary flags every entity attribute whose key is not in known, the
+// attribute ids of a data dictionary. Each key is reported once per entity.
+func Dictionary(req *ast.Request, known map[string]bool) []Issue {
+	if req.Orchestrator == nil {
+		return nil
+	}
+	var issues []Issue
+	for _, e := range req.Orchestrator.Entities {
+		reported := map[string]bool{}
+		for _, a := range e.Attrs {
+			if known[a.Key] || reported[a.Key] {
+				continue
+			}
+			reported[a.Key] = true
+			issues = append(issues, Issue{
+				Pos:     a.Pos,
+				Message: fmt.Sprintf("entity %q: attribute %s is not in the data dictionary", e.ID, a.Key),
+			})
+		}
+	}
+	return issues
+}
@@ -0,0 +1,48 @@
+package validate
+
+import (
+	"fmt"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/example/dsl-go/internal/ast"
+)
+
+// Duplicates reports entity, resource and flow ids that are declared more
+// than once. Every repeat is reported at its own position, naming the
+// position of the first declaration.
+func Duplicates(req *ast.Request) []Issue {
+	if req.Orchestrator == nil {
+		return nil
+	}
+	o := req.Orchestrator
+	d := &duplicates{}
+	first := map[string]lexer.Position{}
+	for _, e := range o.Entities {
+		d.check(first, "entity", e.ID, e.Pos)
+	}
+	first = map[string]lexer.Position{}
+	for _, r := range o.Resources {
+		d.check(first, "resource", r.ID, r.Pos)
+	}
+	first = map[string]lexer.Position{}
+	for _, f := range o.Flows {
+		d.check(first, "flow", f.ID, f.Pos)
+	}
+	return d.issues
+}
+
+type duplicates struct {
+	issues []Issue
+}
+
+func (d *duplicates) check(first map[string]lexer.Position, kind, id string, pos lexer.Position) {
+	prev, ok := first[id]
+	if !ok {
+		first[id] = pos
+		return
+	}
+	d.issues = append(d.issues, Issue{
+		Pos:     pos,
+		Message: fmt.Sprintf("duplicate %s id %q (first declared at %d:%d)", kind, id, prev.Line, prev.Column),
+	})
+}
@@ -0,0 +1,215 @@
+package validate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/example/dsl-go/internal/ast"
+	"github.com/example/dsl-go/internal/parse"
+)
+
+// Reachability reports the steps of each flow that can never execute when the
+// flow starts at its first step. Steps run in order; a fork's branches run
+// only if the fork does, a join only once every step it waits on can run, and
+// nothing after a gate whose condition can never hold ("false" or empty) runs.
+func Reachability(req *ast.Request) []Issue {
+	if req.Orchestrator == nil {
+		return nil
+	}
+	var issues []Issue
+	for _, f := range req.Orchestrator.Flows {
+		issues = append(issues, flowReachability(f)...)
+	}
+	return issues
+}
+
+func flowReachability(f *ast.Flow) []Issue {
+	ids := map[string]bool{}
+	branchOf := map[string]string{}
+	for _, s := range f.Steps {
+		ids[stepID(s)] = true
+		if s.Fork != nil {
+			for _, b := range s.Fork.Branches {
+				branchOf[b] = s.Fork.ID
+			}
+		}
+	}
+
+	var issues []Issue
+	reachable := map[string]bool{}
+	for i, s := range f.Steps {
+		id := stepID(s)
+		var reason string
+		switch {
+		case i == 0:
+		case branchOf[id] != "":
+			if !reachable[branchOf[id]] {
+				reason = fmt.Sprintf("it is a branch of unreachable fork %q", branchOf[id])
+			}
+		case s.Join != nil:
+			for _, after := range s.Join.After {
+				if !ids[after] {
+					reason = fmt.Sprintf("it is a join that waits on nonexistent step %q", after)
+					break
+				}
+				if !reachable[after] {
+					reason = fmt.Sprintf("it is a join that waits on unreachable step %q", after)
+					break
+				}
+			}
+		default:
+			prev := f.Steps[i-1]
+			if !reachable[stepID(prev)] {
+				reason = fmt.Sprintf("it follows unreachable step %q", stepID(prev))
+			} else if prev.Gate != nil && unsatisfiable(prev.Gate.Condition) {
+				reason = fmt.Sprintf("it follows gate %q whose condition can never hold", prev.Gate.ID)
+			}
+		}
+
+		if reason != "" {
+			issues = append(issues, Issue{
+				Pos:     s.Pos,
+				Message: fmt.Sprintf("flow %q: step %q is unreachable: %s", f.ID, id, reason),
+			})
+			continue
+		}
+		reachable[id] = true
+	}
+	return issues
+}
+
+// Steps reports step ids that are declared twice within a flow, and fork
+// branches and join after-ids that do not name a task or gate of the same
+// flow.
+func Steps(req *ast.Request) []Issue {
+	if req.Orchestrator == nil {
+		return nil
+	}
+	var issues []Issue
+	for _, f := range req.Orchestrator.Flows {
+		issues = append(issues, flowSteps(f)...)
+	}
+	return issues
+}
+
+func flowSteps(f *ast.Flow) []Issue {
+	var issues []Issue
+	steps := map[string]*ast.Step{}
+	for _, s := range f.Steps {
+		id := stepID(s)
+		if first, ok := steps[id]; ok {
+			issues = append(issues, Issue{
+				Pos:     s.Pos,
+				Message: fmt.Sprintf("flow %q: duplicate step id %q (first declared at %d:%d)", f.ID, id, first.Pos.Line, first.Pos.Column),
+			})
+			continue
+		}
+		steps[id] = s
+	}
+	check := func(s *ast.Step, kind string, refs []string) {
+		for _, ref := range refs {
+			target, ok := steps[ref]
+			switch {
+			case !ok:
+				issues = append(issues, Issue{
+					Pos:     s.Pos,
+					Message: fmt.Sprintf("flow %q: %s %q references nonexistent step %q", f.ID, kind, stepID(s), ref),
+				})
+			case target.Task == nil && target.Gate == nil:
+				issues = append(issues, Issue{
+					Pos:     s.Pos,
+					Message: fmt.Sprintf("flow %q: %s %q references step %q, which is not a task or gate", f.ID, kind, stepID(s), ref),
+				})
+			}
+		}
+	}
+	for _, s := range f.Steps {
+		switch {
+		case s.Fork != nil:
+			check(s, "fork", s.Fork.Branches)
+		case s.Join != nil:
+			check(s, "join", s.Join.After)
+		}
+	}
+	return issues
+}
+
+// builtinPredicates are the gate predicates the executor evaluates itself.
+// Any other predicate must be produced by a task of the request or name an
+// output of a declared resource or entity as "<id>.<output>".
+var builtinPredicates = map[string]bool{
+	"true":                true,
+	"false":               true,
+	"manual-approval":     true,
+	"all-kyc-complete":    true,
+	"all-aml-clear":       true,
+	"all-sanctions-clear": true,
+}
+
+// Conditions reports gate conditions that do not parse and predicates that
+// are not recognized (see builtinPredicates).
+func Conditions(req *ast.Request) []Issue {
+	if req.Orchestrator == nil {
+		return nil
+	}
+	produced := map[string]bool{}
+	declared := map[string]bool{}
+	ast.Walk(req, ast.Visitor{
+		Entity:   func(e *ast.Entity) bool { declared[e.ID] = true; return true },
+		Resource: func(r *ast.Resource) bool { declared[r.ID] = true; return true },
+		Task: func(_ *ast.Flow, t *ast.Task) bool {
+			for _, p := range t.Produces {
+				produced[p] = true
+			}
+			return true
+		},
+	})
+	recognized := func(name string) bool {
+		if builtinPredicates[name] || produced[name] {
+			return true
+		}
+		i := strings.LastIndex(name, ".")
+		return i > 0 && declared[name[:i]]
+	}
+	var issues []Issue
+	ast.Walk(req, ast.Visitor{Gate: func(f *ast.Flow, g *ast.Gate) bool {
+		cond, err := parse.ParseGateCondition(g.Condition)
+		if err != nil {
+			issues = append(issues, Issue{
+				Pos:     g.Pos,
+				Message: fmt.Sprintf("flow %q: gate %q: invalid condition %q: %v", f.ID, g.ID, g.Condition, err),
+			})
+			return true
+		}
+		for _, name := range cond.Predicates() {
+			if !recognized(name) {
+				issues = append(issues, Issue{
+					Pos:     g.Pos,
+					Message: fmt.Sprintf("flow %q: gate %q: unknown predicate %q", f.ID, g.ID, name),
+				})
+			}
+		}
+		return true
+	}})
+	return issues
+}
+
+// unsatisfiable reports whether a gate condition can never hold.
+func unsatisfiable(cond string) bool {
+	cond = strings.TrimSpace(cond)
+	return cond == "" || strings.EqualFold(cond, "false")
+}
+
+func stepID(s *ast.Step) string {
+	switch {
+	case s.Task != nil:
+		return s.Task.ID
+	case s.Gate != nil:
+		return s.Gate.ID
+	case s.Fork != nil:
+		return s.Fork.ID
+	case s.Join != nil:
+		return s.Join.ID
+	}
+	return ""
+}
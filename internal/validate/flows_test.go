@@ -0,0 +1,85 @@
+package validate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/example/dsl-go/internal/parse"
+)
+
+func TestSteps(t *testing.T) {
+	const (
+		a = `(task :id "a" :on "r" :op open (args))`
+		b = `(task :id "b" :on "r" :op open (args))`
+	)
+	tests := []struct {
+		name  string
+		steps string
+		want  []string
+	}{
+		{"well formed",
+			`(fork :id "f" (branches "a" "b")) ` + a + b + ` (join :id "j" (after "a" "b"))`,
+			nil},
+		{"join on a nonexistent step",
+			a + ` (join :id "j" (after "a" "missing"))`,
+			[]string{`flow "main": join "j" references nonexistent step "missing"`}},
+		{"fork branch that does not exist",
+			`(fork :id "f" (branches "a" "nope")) ` + a,
+			[]string{`flow "main": fork "f" references nonexistent step "nope"`}},
+		{"join on a fork",
+			`(fork :id "f" (branches "a")) ` + a + ` (join :id "j" (after "f"))`,
+			[]string{`flow "main": join "j" references step "f", which is not a task or gate`}},
+		{"duplicate step id",
+			a + ` (gate :id "a" (when "le:A.name"))`,
+			[]string{`flow "main": duplicate step id "a" (first declared at 7:37)`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := parse.ParseReader(strings.NewReader(orchestrator(`(resource :id "r" :type Account)`, "", tt.steps)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, issue := range Steps(req) {
+				got = append(got, issue.Message)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Steps = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditions(t *testing.T) {
+	const produces = `(task :id "a" :on "r" :op open (args) (produces "account-open")) `
+	tests := []struct {
+		name string
+		when string
+		want []string
+	}{
+		{"builtin, produced and declared output",
+			"all-kyc-complete AND (account-open OR NOT le:A.name)", nil},
+		{"unknown predicates",
+			"all-kyc-complete AND (kyc-done OR nope.ready)",
+			[]string{`flow "main": gate "g": unknown predicate "kyc-done"`, `flow "main": gate "g": unknown predicate "nope.ready"`}},
+		{"dangling AND",
+			"all-kyc-complete AND",
+			[]string{`flow "main": gate "g": invalid condition "all-kyc-complete AND": 1:21: condition ends where a predicate was expected`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps := produces + `(gate :id "g" (when "` + tt.when + `"))`
+			req, err := parse.ParseReader(strings.NewReader(orchestrator(`(resource :id "r" :type Account)`, "", steps)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, issue := range Conditions(req) {
+				got = append(got, issue.Message)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Conditions = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
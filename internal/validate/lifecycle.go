@@ -0,0 +1,39 @@
+package validate
+
+import (
+	"fmt"
+
+	"github.com/example/dsl-go/internal/ast"
+)
+
+// Lifecycle reports an initial state that is not among the declared states,
+// and transitions from or to an undeclared state.
+func Lifecycle(req *ast.Request) []Issue {
+	if req.Orchestrator == nil || req.Orchestrator.Lifecycle == nil {
+		return nil
+	}
+	lc := req.Orchestrator.Lifecycle
+	states := map[string]bool{}
+	for _, s := range lc.States {
+		states[s] = true
+	}
+
+	var issues []Issue
+	if !states[lc.Initial] {
+		issues = append(issues, Issue{
+			Pos:     lc.Pos,
+			Message: fmt.Sprintf("lifecycle: initial state %q is not a declared state%s", lc.Initial, hint(lc.Initial, states)),
+		})
+	}
+	for _, t := range lc.Transitions {
+		for _, s := range []string{t.From, t.To} {
+			if !states[s] {
+				issues = append(issues, Issue{
+					Pos:     t.Pos,
+					Message: fmt.Sprintf("lifecycle: transition %s -> %s uses undeclared state %q%s", t.From, t.To, s, hint(s, states)),
+				})
+			}
+		}
+	}
+	return issues
+}
@@ -0,0 +1,57 @@
+package validate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/example/dsl-go/internal/parse"
+)
+
+func TestLifecycle(t *testing.T) {
+	tests := []struct {
+		name      string
+		lifecycle string
+		want      []string
+	}{
+		{"valid",
+			`(states draft validated) (initial draft) (transitions (-> draft validated))`,
+			nil},
+		{"misspelt initial",
+			`(states draft validated) (initial drat) (transitions (-> draft validated))`,
+			[]string{`lifecycle: initial state "drat" is not a declared state`}},
+		{"initial differing in case",
+			`(states draft validated) (initial Draft) (transitions (-> draft validated))`,
+			[]string{`lifecycle: initial state "Draft" is not a declared state (did you mean "draft"?)`}},
+		{"transition to an undeclared state",
+			`(states draft validated) (initial draft) (transitions (-> draft validated) (-> validated archived))`,
+			[]string{`lifecycle: transition validated -> archived uses undeclared state "archived"`}},
+		{"transition between undeclared states",
+			`(states draft) (initial draft) (transitions (-> new old))`,
+			[]string{
+				`lifecycle: transition new -> old uses undeclared state "new"`,
+				`lifecycle: transition new -> old uses undeclared state "old"`,
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := `(onboarding-request
+  (:meta (request-id "x") (version 1))
+  (:orchestrator
+    (:lifecycle ` + tt.lifecycle + `)
+    (:entities)
+    (:resources)
+    (:flows)))`
+			req, err := parse.ParseReader(strings.NewReader(doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, issue := range Lifecycle(req) {
+				got = append(got, issue.Message)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Lifecycle = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package validate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/example/dsl-go/internal/ast"
+)
+
+// References reports ids that do not resolve: a resource's (requires ...)
+// naming an undeclared entity or resource, and a task whose :on names
+// neither a declared resource nor a declared entity. IDs are case-sensitive;
+// an id that only differs in case from a declared one is reported with a
+// hint.
+func References(req *ast.Request) []Issue {
+	if req.Orchestrator == nil {
+		return nil
+	}
+	entities := map[string]bool{}
+	for _, e := range req.Orchestrator.Entities {
+		entities[e.ID] = true
+	}
+	resources := map[string]bool{}
+	for _, r := range req.Orchestrator.Resources {
+		resources[r.ID] = true
+	}
+
+	var issues []Issue
+	for _, r := range req.Orchestrator.Resources {
+		for _, item := range r.Requires {
+			declared := entities
+			if item.Kind == "resource" {
+				declared = resources
+			}
+			if !declared[item.ID] {
+				issues = append(issues, Issue{
+					Pos:     item.Pos,
+					Message: fmt.Sprintf("resource %q requires undeclared %s %q%s", r.ID, item.Kind, item.ID, hint(item.ID, declared)),
+				})
+			}
+		}
+	}
+	for _, f := range req.Orchestrator.Flows {
+		for _, s := range f.Steps {
+			if s.Task == nil || resources[s.Task.On] || entities[s.Task.On] {
+				continue
+			}
+			issues = append(issues, Issue{
+				Pos:     s.Task.Pos,
+				Message: fmt.Sprintf("flow %q: task %q runs on undeclared resource %q%s", f.ID, s.Task.ID, s.Task.On, hint(s.Task.On, resources, entities)),
+			})
+		}
+	}
+	return issues
+}
+
+// hint suggests a declared id that matches id ignoring case.
+func hint(id string, declared ...map[string]bool) string {
+	for _, ids := range declared {
+		for d := range ids {
+			if strings.EqualFold(d, id) {
+				return fmt.Sprintf(" (did you mean %q?)", d)
+			}
+		}
+	}
+	return ""
+}
+
+// OrphanResources reports resources that nothing connects to the request:
+// they require nothing, no other resource requires them, no product-service
+// mapping lists them and no task runs :on them. These are usually leftovers,
+// but a standalone resource can be intended, so callers treat the issues as
+// warnings.
+func OrphanResources(req *ast.Request) []Issue {
+	if req.Orchestrator == nil {
+		return nil
+	}
+	o := req.Orchestrator
+	linked := map[string]bool{}
+	for _, r := range o.Resources {
+		for _, item := range r.Requires {
+			if item.Kind == "resource" {
+				linked[item.ID] = true
+			}
+		}
+	}
+	for _, m := range o.ProductServiceMappings {
+		for _, id := range m.Resources {
+			linked[id] = true
+		}
+	}
+	for _, f := range o.Flows {
+		for _, s := range f.Steps {
+			if s.Task != nil {
+				linked[s.Task.On] = true
+			}
+		}
+	}
+
+	var issues []Issue
+	for _, r := range o.Resources {
+		if len(r.Requires) > 0 || linked[r.ID] {
+			continue
+		}
+		issues = append(issues, Issue{
+			Pos:     r.Pos,
+			Message: fmt.Sprintf("resource %q looks orphaned: it requires nothing, and no resource, mapping or task refers to it", r.ID),
+		})
+	}
+	return issues
+}
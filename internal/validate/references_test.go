@@ -0,0 +1,71 @@
+package validate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/example/dsl-go/internal/parse"
+)
+
+// orchestrator returns a document with the given resources, mappings and
+// flow steps; it has one entity, le:A.
+func orchestrator(resources, mappings, steps string) string {
+	return `(onboarding-request
+  (:meta (request-id "x") (version 1))
+  (:orchestrator
+    (:lifecycle (states draft) (initial draft) (transitions))
+    (:entities (entity :id "le:A" :type LegalEntity (attrs)))
+    (:resources ` + resources + `)
+    (:flows (flow :id "main" (steps ` + steps + `)))
+    (:product-service-mappings ` + mappings + `)))`
+}
+
+func TestOrphanResources(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources string
+		mappings  string
+		steps     string
+		want      []string
+	}{
+		{"task target is not orphaned",
+			`(resource :id "used" :type Account) (resource :id "spare" :type Account)`, "",
+			`(task :id "t" :on "used" :op open (args))`,
+			[]string{"spare"}},
+		{"requiring an entity is not orphaned",
+			`(resource :id "acct" :type Account (requires (entity "le:A")))`, "",
+			`(gate :id "g" (when "le:A.name"))`,
+			nil},
+		{"required by another resource is not orphaned",
+			`(resource :id "base" :type Account) (resource :id "top" :type Account (requires (resource "base")))`, "",
+			`(gate :id "g" (when "le:A.name"))`,
+			nil},
+		{"mapped resource is not orphaned",
+			`(resource :id "mapped" :type Account)`,
+			`(mapping :product "custody" :resources ("mapped"))`,
+			`(gate :id "g" (when "le:A.name"))`,
+			nil},
+		{"every unlinked resource is reported",
+			`(resource :id "a" :type Account) (resource :id "b" :type Account)`, "",
+			`(gate :id "g" (when "le:A.name"))`,
+			[]string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := parse.ParseReader(strings.NewReader(orchestrator(tt.resources, tt.mappings, tt.steps)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, issue := range OrphanResources(req) {
+				if !strings.Contains(issue.Message, "looks orphaned") {
+					t.Errorf("unexpected message %q", issue.Message)
+				}
+				got = append(got, strings.Split(issue.Message, `"`)[1])
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("orphans = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package validate
+
+import (
+	"fmt"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/example/dsl-go/internal/parse"
+)
+
+// Issue is a single problem found in a DSL document.
+type Issue struct {
+	Pos     lexer.Position
+	Message string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%d:%d: %s", i.Pos.Line, i.Pos.Column, i.Message)
+}
+
+// Structure checks a raw tree against the shape the DSL grammar requires and
+// returns every problem it can find (unknown forms and keywords, missing
+// required forms, malformed values) rather than stopping at the first one.
+func Structure(root *parse.Sexpr) []Issue {
+	c := &checker{}
+	c.request(root)
+	return c.issues
+}
+
+type checker struct {
+	issues []Issue
+}
+
+func (c *checker) addf(pos lexer.Position, format string, args ...interface{}) {
+	c.issues = append(c.issues, Issue{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// atomKind names the token kinds a keyword or form may require.
+type atomKind int
+
+const (
+	kindString atomKind = iota
+	kindSymbol
+	kindNumber
+	kindValue
+)
+
+func (k atomKind) String() string {
+	switch k {
+	case kindString:
+		return "string"
+	case kindSymbol:
+		return "identifier"
+	case kindNumber:
+		return "number"
+	}
+	return "value"
+}
+
+func isKind(x *parse.Sexpr, k atomKind) bool {
+	if x.Atom == nil {
+		return false
+	}
+	switch k {
+	case kindString:
+		return x.Atom.String != nil
+	case kindSymbol:
+		return x.Atom.Symbol != nil
+	case kindNumber:
+		return x.Atom.Number != nil
+	}
+	return x.Atom.Keyword == nil
+}
+
+// children checks that every element after the head of form is a sub-form
+// named in forms, runs its check, and reports required sub-forms that are
+// missing. A nil check accepts the sub-form without looking inside.
+func (c *checker) children(form *parse.Sexpr, where string, forms map[string]func(*parse.Sexpr), required ...string) {
+	seen := map[string]bool{}
+	for _, child := range form.List[1:] {
+		c.child(child, where, forms, seen)
+	}
+	c.required(form, where, seen, required)
+}
+
+func (c *checker) child(child *parse.Sexpr, where string, forms map[string]func(*parse.Sexpr), seen map[string]bool) {
+	head := child.Head()
+	if head == "" {
+		c.addf(child.Pos, "unexpected %s in %s", describe(child), where)
+		return
+	}
+	check, ok := forms[head]
+	if !ok {
+		c.addf(child.Pos, "unknown form (%s ...) in %s", head, where)
+		return
+	}
+	seen[head] = true
+	if check != nil {
+		check(child)
+	}
+}
+
+func (c *checker) required(form *parse.Sexpr, where string, seen map[string]bool, required []string) {
+	for _, r := range required {
+		if !seen[r] {
+			c.addf(form.Pos, "%s is missing (%s ...)", where, r)
+		}
+	}
+}
+
+// keywords checks the ":key value" pairs after the head of form against spec
+// and reports missing required keys. Positional elements are returned in
+// order for the caller to check.
+func (c *checker) keywords(form *parse.Sexpr, spec map[string]atomKind, required ...string) []*parse.Sexpr {
+	where := "(" + form.Head() + " ...)"
+	seen := map[string]bool{}
+	var rest []*parse.Sexpr
+	items := form.List[1:]
+	for i := 0; i < len(items); i++ {
+		item := items[i]
+		if item.Atom == nil || item.Atom.Keyword == nil {
+			rest = append(rest, item)
+			continue
+		}
+		key := *item.Atom.Keyword
+		kind, ok := spec[key]
+		if !ok {
+			c.addf(item.Pos, "unknown keyword %s in %s", key, where)
+		}
+		seen[key] = true
+		if i+1 >= len(items) {
+			c.addf(item.Pos, "keyword %s in %s has no value", key, where)
+			break
+		}
+		i++
+		if ok && !isKind(items[i], kind) {
+			c.addf(items[i].Pos, "%s in %s must be a %s, got %s", key, where, kind, describe(items[i]))
+		}
+	}
+	for _, r := range required {
+		if !seen[r] {
+			c.addf(form.Pos, "%s is missing %s", where, r)
+		}
+	}
+	return rest
+}
+
+// atoms checks that every element after the head of form is an atom of kind,
+// and that there are at least min and (if max >= 0) at most max of them.
+func (c *checker) atoms(form *parse.Sexpr, kind atomKind, min, max int) {
+	where := "(" + form.Head() + " ...)"
+	n := len(form.List) - 1
+	if n < min || (max >= 0 && n > max) {
+		c.addf(form.Pos, "%s has %d values", where, n)
+	}
+	for _, x := range form.List[1:] {
+		if !isKind(x, kind) {
+			c.addf(x.Pos, "%s expects a %s, got %s", where, kind, describe(x))
+		}
+	}
+}
+
+// pairs checks that every element after the head of form is a (key value)
+// pair, as used by args, config and policies.
+func (c *checker) pairs(form *parse.Sexpr, items []*parse.Sexpr) {
+	for _, kv := range items {
+		if kv.Head() == "" || len(kv.List) < 2 {
+			c.addf(kv.Pos, "expected (key value) in (%s ...), got %s", form.Head(), describe(kv))
+		}
+	}
+}
+
+func describe(x *parse.Sexpr) string {
+	if x.IsList {
+		if h := x.Head(); h != "" {
+			return "(" + h + " ...)"
+		}
+		return "list"
+	}
+	return fmt.Sprintf("%q", x.Atom.Text())
+}
+
+func (c *checker) request(root *parse.Sexpr) {
+	if root.Head() != "onboarding-request" {
+		c.addf(root.Pos, "document must be an (onboarding-request ...) form")
+		return
+	}
+	c.children(root, "(onboarding-request ...)", map[string]func(*parse.Sexpr){
+		":meta":         c.meta,
+		":orchestrator": c.orchestrator,
+		":catalog":      c.catalog,
+	}, ":meta", ":orchestrator")
+}
+
+func (c *checker) meta(form *parse.Sexpr) {
+	c.children(form, "(:meta ...)", map[string]func(*parse.Sexpr){
+		"request-id": func(x *parse.Sexpr) { c.atoms(x, kindString, 1, 1) },
+		"version":    func(x *parse.Sexpr) { c.atoms(x, kindNumber, 1, 1) },
+		"created-at": func(x *parse.Sexpr) { c.atoms(x, kindString, 1, 1) },
+		"updated-at": func(x *parse.Sexpr) { c.atoms(x, kindString, 1, 1) },
+	}, "request-id", "version")
+}
+
+func (c *checker) orchestrator(form *parse.Sexpr) {
+	c.children(form, "(:orchestrator ...)", map[string]func(*parse.Sexpr){
+		":lifecycle":                c.lifecycle,
+		":entities":                 c.section("entity", c.entity),
+		":resources":                c.section("resource", c.resource),
+		":flows":                    c.section("flow", c.flow),
+		":policies":                 c.section("policy", c.policy),
+		":product-service-mappings": c.section("mapping", c.mapping),
+	}, ":lifecycle")
+}
+
+// section returns a check for a list section whose items are all item forms.
+func (c *checker) section(item string, check func(*parse.Sexpr)) func(*parse.Sexpr) {
+	return func(form *parse.Sexpr) {
+		c.children(form, "("+form.Head()+" ...)", map[string]func(*parse.Sexpr){item: check})
+	}
+}
+
+func (c *checker) lifecycle(form *parse.Sexpr) {
+	c.children(form, "(:lifecycle ...)", map[string]func(*parse.Sexpr){
+		"states":      func(x *parse.Sexpr) { c.atoms(x, kindSymbol, 1, -1) },
+		"initial":     func(x *parse.Sexpr) { c.atoms(x, kindSymbol, 1, 1) },
+		"transitions": c.section("->", c.transition),
+	}, "states", "initial", "transitions")
+}
+
+func (c *checker) transition(form *parse.Sexpr) {
+	if len(form.List) < 3 || !isKind(form.List[1], kindSymbol) || !isKind(form.List[2], kindSymbol) {
+		c.addf(form.Pos, "transition must name a from and a to state")
+		return
+	}
+	seen := map[string]bool{}
+	for _, x := range form.List[3:] {
+		c.child(x, "(-> ...)", map[string]func(*parse.Sexpr){
+			"when": nil,
+			"do":   nil,
+		}, seen)
+	}
+}
+
+func (c *checker) entity(form *parse.Sexpr) {
+	rest := c.keywords(form, map[string]atomKind{":id": kindString, ":type": kindSymbol}, ":id", ":type")
+	seen := map[string]bool{}
+	for _, x := range rest {
+		c.child(x, "(entity ...)", map[string]func(*parse.Sexpr){
+			"tags":  func(a *parse.Sexpr) { c.atoms(a, kindSymbol, 0, -1) },
+			"attrs": c.attrs,
+		}, seen)
+	}
+	c.required(form, "(entity ...)", seen, []string{"attrs"})
+}
+
+func (c *checker) attrs(form *parse.Sexpr) {
+	for _, attr := range form.List[1:] {
+		if attr.Head() == "" || len(attr.List) < 2 {
+			c.addf(attr.Pos, "expected (name value) in (attrs ...), got %s", describe(attr))
+			continue
+		}
+		items := attr.List[2:]
+		for i := 0; i < len(items); i++ {
+			kw := items[i]
+			if kw.Atom == nil || kw.Atom.Keyword == nil {
+				c.addf(kw.Pos, "unexpected %s in attribute %s", describe(kw), attr.Head())
+				continue
+			}
+			switch *kw.Atom.Keyword {
+			case ":provenance", ":needed-by", ":superseded-at":
+				i++
+			default:
+				c.addf(kw.Pos, "unknown keyword %s in attribute %s", *kw.Atom.Keyword, attr.Head())
+			}
+		}
+	}
+}
+
+func (c *checker) resource(form *parse.Sexpr) {
+	rest := c.keywords(form, map[string]atomKind{":id": kindString, ":type": kindSymbol}, ":id", ":type")
+	seen := map[string]bool{}
+	for _, x := range rest {
+		c.child(x, "(resource ...)", map[string]func(*parse.Sexpr){
+			"requires": func(r *parse.Sexpr) {
+				for _, item := range r.List[1:] {
+					head := item.Head()
+					if (head != "entity" && head != "resource") || len(item.List) != 2 || !isKind(item.List[1], kindString) {
+						c.addf(item.Pos, "expected (entity \"id\") or (resource \"id\") in (requires ...), got %s", describe(item))
+					}
+				}
+			},
+			"config": func(x *parse.Sexpr) { c.pairs(x, x.List[1:]) },
+		}, seen)
+	}
+}
+
+func (c *checker) flow(form *parse.Sexpr) {
+	rest := c.keywords(form, map[string]atomKind{":id": kindString}, ":id")
+	if len(rest) > 0 && isKind(rest[0], kindString) {
+		rest = rest[1:] // doc string
+	}
+	seen := map[string]bool{}
+	for _, x := range rest {
+		c.child(x, "(flow ...)", map[string]func(*parse.Sexpr){
+			"steps": func(s *parse.Sexpr) {
+				c.children(s, "(steps ...)", map[string]func(*parse.Sexpr){
+					"task": c.task,
+					"gate": c.gate,
+					"fork": c.forkJoin("branches"),
+					"join": c.forkJoin("after"),
+				})
+			},
+		}, seen)
+	}
+	c.required(form, "(flow ...)", seen, []string{"steps"})
+}
+
+func (c *checker) task(form *parse.Sexpr) {
+	rest := c.keywords(form, map[string]atomKind{":id": kindString, ":on": kindString, ":op": kindSymbol}, ":id", ":on", ":op")
+	seen := map[string]bool{}
+	for _, x := range rest {
+		c.child(x, "(task ...)", map[string]func(*parse.Sexpr){
+			"args":     func(a *parse.Sexpr) { c.pairs(a, a.List[1:]) },
+			"needs":    func(a *parse.Sexpr) { c.atoms(a, kindString, 0, -1) },
+			"produces": func(a *parse.Sexpr) { c.atoms(a, kindString, 0, -1) },
+			"labels":   func(a *parse.Sexpr) { c.atoms(a, kindSymbol, 0, -1) },
+		}, seen)
+	}
+}
+
+func (c *checker) gate(form *parse.Sexpr) {
+	rest := c.keywords(form, map[string]atomKind{":id": kindString}, ":id")
+	seen := map[string]bool{}
+	for _, x := range rest {
+		c.child(x, "(gate ...)", map[string]func(*parse.Sexpr){
+			"when": func(w *parse.Sexpr) { c.atoms(w, kindString, 1, 1) },
+		}, seen)
+	}
+	c.required(form, "(gate ...)", seen, []string{"when"})
+}
+
+func (c *checker) forkJoin(list string) func(*parse.Sexpr) {
+	return func(form *parse.Sexpr) {
+		where := "(" + form.Head() + " ...)"
+		rest := c.keywords(form, map[string]atomKind{":id": kindString}, ":id")
+		seen := map[string]bool{}
+		for _, x := range rest {
+			c.child(x, where, map[string]func(*parse.Sexpr){
+				list: func(a *parse.Sexpr) { c.atoms(a, kindString, 1, -1) },
+			}, seen)
+		}
+		c.required(form, where, seen, []string{list})
+	}
+}
+
+func (c *checker) policy(form *parse.Sexpr) {
+	if len(form.List) < 2 || !isKind(form.List[1], kindSymbol) {
+		c.addf(form.Pos, "(policy ...) must be named")
+		return
+	}
+	c.pairs(form, form.List[2:])
+}
+
+func (c *checker) mapping(form *parse.Sexpr) {
+	items := form.List[1:]
+	seen := map[string]bool{}
+	for i := 0; i < len(items); i++ {
+		kw := items[i]
+		if kw.Atom == nil || kw.Atom.Keyword == nil || i+1 >= len(items) {
+			c.addf(kw.Pos, "unexpected %s in (mapping ...)", describe(kw))
+			continue
+		}
+		key := *kw.Atom.Keyword
+		i++
+		seen[key] = true
+		switch key {
+		case ":product":
+			if !isKind(items[i], kindString) {
+				c.addf(items[i].Pos, ":product in (mapping ...) must be a string")
+			}
+		case ":services", ":resources":
+			if !items[i].IsList {
+				c.addf(items[i].Pos, "%s in (mapping ...) must be a list of strings", key)
+			}
+		default:
+			c.addf(kw.Pos, "unknown keyword %s in (mapping ...)", key)
+		}
+	}
+	if !seen[":product"] {
+		c.addf(form.Pos, "(mapping ...) is missing :product")
+	}
+}
+
+func (c *checker) catalog(form *parse.Sexpr) {
+	c.children(form, "(:catalog ...)", map[string]func(*parse.Sexpr){
+		":attributes": nil,
+		":actions":    nil,
+	}, ":attributes", ":actions")
+}